@@ -0,0 +1,516 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 处理动作
+const (
+	ActionDelete  = "delete"  // 只删除消息
+	ActionWarn    = "warn"    // 记一次警告，按警告阶梯处理
+	ActionMute    = "mute"    // 禁言一段时间
+	ActionUnmute  = "unmute"  // 解除禁言
+	ActionTempBan = "tempban" // 临时封禁
+	ActionBan     = "ban"     // 永久封禁
+	ActionUnban   = "unban"   // 解除封禁
+	ActionKick    = "kick"    // 移出群组，允许重新加入
+)
+
+// keywordActions 关键词可以使用的动作
+var keywordActions = []string{ActionDelete, ActionWarn, ActionMute, ActionTempBan, ActionBan, ActionKick}
+
+func isValidAction(action string) bool {
+	switch action {
+	case ActionDelete, ActionWarn, ActionMute, ActionUnmute, ActionTempBan, ActionBan, ActionUnban, ActionKick:
+		return true
+	}
+	return false
+}
+
+func isKeywordAction(action string) bool {
+	for _, a := range keywordActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// actionNeedsDuration 需要时长的动作
+func actionNeedsDuration(action string) bool {
+	return action == ActionMute || action == ActionTempBan
+}
+
+// defaultActionDuration 未指定时长时使用配置中的默认时长
+func (tb *TelegramBot) defaultActionDuration(action string) time.Duration {
+	switch action {
+	case ActionMute:
+		return time.Duration(tb.config.Settings.MuteDuration) * time.Second
+	case ActionTempBan:
+		if tb.config.Settings.BanDuration > 0 {
+			return time.Duration(tb.config.Settings.BanDuration) * time.Second
+		}
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// applyAction 对群组中的用户执行处理动作，返回动作的描述
+// duration 为 0 时禁言和临时封禁使用默认时长
+func (tb *TelegramBot) applyAction(chatID int64, user *tgbotapi.User, action string, duration time.Duration, reason string, issuedBy int64) (string, error) {
+	if actionNeedsDuration(action) && duration <= 0 {
+		duration = tb.defaultActionDuration(action)
+	}
+
+	var err error
+	var description string
+
+	switch action {
+	case ActionDelete:
+		description = "删除消息"
+	case ActionWarn:
+		description, err = tb.issueWarning(chatID, user, reason, issuedBy)
+	case ActionMute:
+		err = tb.muteUser(chatID, user.ID, duration)
+		description = fmt.Sprintf("禁言 %s", formatDuration(duration))
+	case ActionUnmute:
+		err = tb.unmuteUser(chatID, user.ID)
+		description = "解除禁言"
+	case ActionTempBan:
+		err = tb.banUser(chatID, user.ID, duration)
+		description = fmt.Sprintf("封禁 %s", formatDuration(duration))
+	case ActionBan:
+		err = tb.banUser(chatID, user.ID, 0)
+		description = "永久封禁"
+	case ActionUnban:
+		err = tb.unbanUser(chatID, user.ID)
+		description = "解除封禁"
+	case ActionKick:
+		err = tb.kickUser(chatID, user.ID)
+		description = "移出群组"
+	default:
+		return "", fmt.Errorf("未知的动作: %s", action)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("用户 %d 在群组 %d 被执行 %s，原因：%s", user.ID, chatID, description, reason)
+
+	if appealableAction(action) {
+		tb.sendAppealNotice(chatID, user, action, description, reason)
+	}
+	return description, nil
+}
+
+// muteUser 禁言用户，duration 不大于 0 时使用配置中的禁言时长
+func (tb *TelegramBot) muteUser(chatID, userID int64, duration time.Duration) error {
+	if duration <= 0 {
+		duration = tb.defaultActionDuration(ActionMute)
+	}
+
+	restrictChatMember := tgbotapi.RestrictChatMemberConfig{
+		ChatMemberConfig: tgbotapi.ChatMemberConfig{
+			ChatID: chatID,
+			UserID: userID,
+		},
+		UntilDate:   time.Now().Add(duration).Unix(),
+		Permissions: mutedPermissions(),
+	}
+
+	_, err := tb.outbox.Request(restrictChatMember)
+	if err != nil {
+		log.Printf("禁言用户失败：%v", err)
+	}
+	return err
+}
+
+func (tb *TelegramBot) unmuteUser(chatID, userID int64) error {
+	restrictChatMember := tgbotapi.RestrictChatMemberConfig{
+		ChatMemberConfig: tgbotapi.ChatMemberConfig{
+			ChatID: chatID,
+			UserID: userID,
+		},
+		Permissions: memberPermissions(),
+	}
+
+	_, err := tb.outbox.Request(restrictChatMember)
+	if err != nil {
+		log.Printf("解除禁言失败：%v", err)
+	}
+	return err
+}
+
+// banUser 封禁用户，duration 为 0 时永久封禁
+func (tb *TelegramBot) banUser(chatID, userID int64, duration time.Duration) error {
+	banConfig := tgbotapi.BanChatMemberConfig{
+		ChatMemberConfig: tgbotapi.ChatMemberConfig{
+			ChatID: chatID,
+			UserID: userID,
+		},
+	}
+	if duration > 0 {
+		banConfig.UntilDate = time.Now().Add(duration).Unix()
+	}
+
+	_, err := tb.outbox.Request(banConfig)
+	if err != nil {
+		log.Printf("封禁用户失败：%v", err)
+	}
+	return err
+}
+
+func (tb *TelegramBot) unbanUser(chatID, userID int64) error {
+	unbanConfig := tgbotapi.UnbanChatMemberConfig{
+		ChatMemberConfig: tgbotapi.ChatMemberConfig{
+			ChatID: chatID,
+			UserID: userID,
+		},
+		OnlyIfBanned: true,
+	}
+
+	_, err := tb.outbox.Request(unbanConfig)
+	if err != nil {
+		log.Printf("解除封禁失败：%v", err)
+	}
+	return err
+}
+
+// kickUser 将用户移出群组，先封禁再立即解封，用户之后可以重新加入
+func (tb *TelegramBot) kickUser(chatID, userID int64) error {
+	if err := tb.banUser(chatID, userID, 0); err != nil {
+		return err
+	}
+	return tb.unbanUser(chatID, userID)
+}
+
+// getChatMember 经发送队列查询用户在群组中的状态；查询不是发送消息，不受每个群组的限速
+func (tb *TelegramBot) getChatMember(chatID, userID int64) (tgbotapi.ChatMember, error) {
+	var member tgbotapi.ChatMember
+	err := tb.outbox.Do(chatID, PriorityHigh, "GetChatMemberConfig", func() error {
+		var err error
+		member, err = tb.bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+			ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+				ChatID: chatID,
+				UserID: userID,
+			},
+		})
+		return err
+	})
+	return member, err
+}
+
+// getChat 经发送队列查询群组信息
+func (tb *TelegramBot) getChat(chatID int64) (tgbotapi.Chat, error) {
+	var chat tgbotapi.Chat
+	err := tb.outbox.Do(chatID, PriorityHigh, "ChatInfoConfig", func() error {
+		var err error
+		chat, err = tb.bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: chatID}})
+		return err
+	})
+	return chat, err
+}
+
+// mutedPermissions 禁言时的权限
+func mutedPermissions() *tgbotapi.ChatPermissions {
+	return &tgbotapi.ChatPermissions{
+		CanSendMessages:       false,
+		CanSendMediaMessages:  false,
+		CanSendPolls:          false,
+		CanSendOtherMessages:  false,
+		CanAddWebPagePreviews: false,
+		CanChangeInfo:         false,
+		CanInviteUsers:        false,
+		CanPinMessages:        false,
+	}
+}
+
+// memberPermissions 普通成员的权限
+func memberPermissions() *tgbotapi.ChatPermissions {
+	return &tgbotapi.ChatPermissions{
+		CanSendMessages:       true,
+		CanSendMediaMessages:  true,
+		CanSendPolls:          true,
+		CanSendOtherMessages:  true,
+		CanAddWebPagePreviews: true,
+		CanChangeInfo:         false,
+		CanInviteUsers:        true,
+		CanPinMessages:        false,
+	}
+}
+
+// parseActionStep 解析 动作[:时长]，如 delete 或 mute:1h；mute 和 tempban 未指定时长时使用全局设置
+func parseActionStep(text string) (WarningStep, error) {
+	action, durationText, _ := strings.Cut(strings.TrimSpace(text), ":")
+	step := WarningStep{Action: action}
+	switch action {
+	case ActionDelete, ActionWarn, ActionMute, ActionTempBan, ActionKick, ActionBan:
+	default:
+		return step, fmt.Errorf("未知的动作: %s", text)
+	}
+
+	if durationText != "" {
+		duration, err := parseDuration(durationText)
+		if err != nil {
+			return step, err
+		}
+		step.Duration = duration
+	}
+	return step, nil
+}
+
+// textOnlyPermissions 只能发送文字时的权限
+func textOnlyPermissions() *tgbotapi.ChatPermissions {
+	return &tgbotapi.ChatPermissions{
+		CanSendMessages: true,
+	}
+}
+
+// 修改全体成员权限的功能，同一群组中可以同时生效
+const (
+	holdNightMode = "night_mode"
+	holdLockdown  = "lockdown"
+)
+
+// holdPermissions 以 holder 的名义收紧群组权限：第一个修改权限的功能保存群组的原有权限，
+// 多个功能同时生效时使用各自要求的权限与原有权限的交集，只会比任何一方更严格
+func (tb *TelegramBot) holdPermissions(chatID int64, holder string, permissions *tgbotapi.ChatPermissions) error {
+	tb.permMu.Lock()
+	defer tb.permMu.Unlock()
+
+	saved, err := tb.db.GetSavedPermissions(chatID)
+	if err != nil {
+		return err
+	}
+	if saved == "" {
+		if saved, err = tb.currentPermissions(chatID); err != nil {
+			return err
+		}
+		if err := tb.db.SavePermissions(chatID, saved); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+	if err := tb.db.SetPermissionHold(chatID, holder, string(data)); err != nil {
+		return err
+	}
+
+	if err := tb.applyHeldPermissions(chatID, saved); err != nil {
+		// 设置失败时撤回记录，没有其他功能在修改权限时也不再保留原有权限
+		if _, err := tb.db.DeletePermissionHold(chatID, holder); err != nil {
+			log.Printf("删除群组 %d 的权限记录失败：%v", chatID, err)
+		}
+		if holds, err := tb.db.GetPermissionHolds(chatID); err == nil && len(holds) == 0 {
+			tb.db.DeleteSavedPermissions(chatID)
+		}
+		return err
+	}
+	return nil
+}
+
+// releasePermissions 撤销 holder 对群组权限的修改：还有其他功能在修改时按剩余的要求设置，
+// 最后一个结束时恢复原有权限；返回是否已恢复原有权限
+func (tb *TelegramBot) releasePermissions(chatID int64, holder string) bool {
+	tb.permMu.Lock()
+	defer tb.permMu.Unlock()
+
+	held, err := tb.db.DeletePermissionHold(chatID, holder)
+	if err != nil {
+		log.Printf("删除群组 %d 的权限记录失败：%v", chatID, err)
+		return false
+	}
+	if !held {
+		return false
+	}
+
+	saved, err := tb.db.GetSavedPermissions(chatID)
+	if err != nil {
+		log.Printf("读取群组 %d 的原有权限失败：%v", chatID, err)
+		return false
+	}
+	holds, err := tb.db.GetPermissionHolds(chatID)
+	if err != nil {
+		log.Printf("读取群组 %d 的权限记录失败：%v", chatID, err)
+		return false
+	}
+
+	if len(holds) > 0 {
+		if err := tb.applyHeldPermissions(chatID, saved); err != nil {
+			log.Printf("设置群组 %d 的权限失败：%v", chatID, err)
+		}
+		return false
+	}
+
+	tb.restorePermissions(chatID, saved)
+	if err := tb.db.DeleteSavedPermissions(chatID); err != nil {
+		log.Printf("删除群组 %d 的原有权限失败：%v", chatID, err)
+	}
+	return true
+}
+
+// currentPermissions 群组当前的权限（JSON）
+func (tb *TelegramBot) currentPermissions(chatID int64) (string, error) {
+	chat, err := tb.getChat(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	// 获取不到原有权限时按普通成员的权限保存，否则恢复时会把全体成员的权限全部关闭
+	permissions := chat.Permissions
+	if permissions == nil {
+		log.Printf("群组 %d 没有返回原有权限，恢复时按普通成员的权限处理", chatID)
+		permissions = memberPermissions()
+	}
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// applyHeldPermissions 将群组权限设置为原有权限与所有生效中的要求的交集
+func (tb *TelegramBot) applyHeldPermissions(chatID int64, saved string) error {
+	permissions, err := parsePermissions(saved)
+	if err != nil {
+		return err
+	}
+
+	holds, err := tb.db.GetPermissionHolds(chatID)
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		held, err := parsePermissions(hold)
+		if err != nil {
+			return err
+		}
+		permissions = intersectPermissions(permissions, held)
+	}
+
+	_, err = tb.outbox.Request(tgbotapi.SetChatPermissionsConfig{
+		ChatConfig:  tgbotapi.ChatConfig{ChatID: chatID},
+		Permissions: permissions,
+	})
+	return err
+}
+
+// restorePermissions 恢复保存的原有权限
+func (tb *TelegramBot) restorePermissions(chatID int64, saved string) {
+	permissions, err := parsePermissions(saved)
+	if err != nil {
+		log.Printf("解析群组 %d 的原有权限失败：%v", chatID, err)
+		return
+	}
+
+	_, err = tb.outbox.Request(tgbotapi.SetChatPermissionsConfig{
+		ChatConfig:  tgbotapi.ChatConfig{ChatID: chatID},
+		Permissions: permissions,
+	})
+	if err != nil {
+		log.Printf("恢复群组 %d 的权限失败：%v", chatID, err)
+	}
+}
+
+// parsePermissions 解析保存的权限，null 按普通成员的权限处理
+func parsePermissions(data string) (*tgbotapi.ChatPermissions, error) {
+	var permissions *tgbotapi.ChatPermissions
+	if err := json.Unmarshal([]byte(data), &permissions); err != nil {
+		return nil, err
+	}
+	if permissions == nil {
+		permissions = memberPermissions()
+	}
+	return permissions, nil
+}
+
+// intersectPermissions 两组权限都允许的权限
+func intersectPermissions(a, b *tgbotapi.ChatPermissions) *tgbotapi.ChatPermissions {
+	return &tgbotapi.ChatPermissions{
+		CanSendMessages:       a.CanSendMessages && b.CanSendMessages,
+		CanSendMediaMessages:  a.CanSendMediaMessages && b.CanSendMediaMessages,
+		CanSendPolls:          a.CanSendPolls && b.CanSendPolls,
+		CanSendOtherMessages:  a.CanSendOtherMessages && b.CanSendOtherMessages,
+		CanAddWebPagePreviews: a.CanAddWebPagePreviews && b.CanAddWebPagePreviews,
+		CanChangeInfo:         a.CanChangeInfo && b.CanChangeInfo,
+		CanInviteUsers:        a.CanInviteUsers && b.CanInviteUsers,
+		CanPinMessages:        a.CanPinMessages && b.CanPinMessages,
+	}
+}
+
+// commandTarget 取得命令的目标用户：被回复消息的发送者，或参数中的第一个用户ID
+// 返回目标用户（找不到时为 nil）和剩余的参数
+func commandTarget(message *tgbotapi.Message, args string) (*tgbotapi.User, []string) {
+	fields := strings.Fields(args)
+
+	if message.ReplyToMessage != nil && message.ReplyToMessage.From != nil {
+		return message.ReplyToMessage.From, fields
+	}
+
+	if len(fields) > 0 {
+		if id, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			return &tgbotapi.User{ID: id, FirstName: fields[0]}, fields[1:]
+		}
+	}
+
+	return nil, fields
+}
+
+// handleActionCommand 处理 /mute /unmute /tempban /ban /unban /kick /del 命令
+// 用法：回复目标用户的消息，或在参数中给出用户ID；禁言和临时封禁可以指定时长
+//
+//	/mute [时长] [原因]
+//	/tempban [时长] [原因]
+//	/ban [用户ID] [原因]
+func (tb *TelegramBot) handleActionCommand(message *tgbotapi.Message, action string, args string) {
+	user, fields := commandTarget(message, args)
+	if user == nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ 用法：回复用户的消息发送 /%s，或 /%s <用户ID>", message.Command(), message.Command()))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	var duration time.Duration
+	if actionNeedsDuration(action) && len(fields) > 0 {
+		if d, err := parseDuration(fields[0]); err == nil {
+			duration = d
+			fields = fields[1:]
+		}
+	}
+
+	reason := strings.Join(fields, " ")
+	if reason == "" {
+		reason = "管理员操作"
+	}
+
+	// 删除被回复的消息（解除类动作除外）
+	if message.ReplyToMessage != nil && action != ActionUnmute && action != ActionUnban {
+		tb.deleteMessages(message.Chat.ID, []int{message.ReplyToMessage.MessageID})
+	}
+
+	description, err := tb.applyAction(message.Chat.ID, user, action, duration, reason, message.From.ID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ 操作失败：%v", err))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	// 删除不需要提示，警告已发送通知
+	if action == ActionDelete || action == ActionWarn {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ %s：%s\n原因：%s", user.FirstName, description, reason))
+	tb.outbox.Post(msg)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// announcementInterval 检查定时消息的间隔
+const announcementInterval = 30 * time.Second
+
+// renderAnnouncement 将定时消息转换为可发送的消息，按钮语法与欢迎消息相同
+func renderAnnouncement(a *Announcement) (*RenderedWelcome, error) {
+	if a.ParseMode != "" && a.ParseMode != tgbotapi.ModeHTML && a.ParseMode != tgbotapi.ModeMarkdownV2 {
+		return nil, fmt.Errorf("不支持的格式: %s", a.ParseMode)
+	}
+	if a.Media != "" && a.MediaType != "photo" && a.MediaType != "video" && a.MediaType != "animation" {
+		return nil, fmt.Errorf("不支持的媒体类型: %s", a.MediaType)
+	}
+
+	text, buttons, err := parseWelcomeButtons(a.Text)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" && a.Media == "" {
+		return nil, fmt.Errorf("消息内容不能为空")
+	}
+
+	rendered := &RenderedWelcome{
+		Text:      text,
+		ParseMode: a.ParseMode,
+		Buttons:   buttons,
+	}
+	if a.Media != "" {
+		rendered.Media = a.Media
+		rendered.MediaType = a.MediaType
+	}
+	return rendered, nil
+}
+
+// validateAnnouncement 检查定时消息能否发送
+func validateAnnouncement(a *Announcement) error {
+	if a.ChatID == 0 {
+		return fmt.Errorf("缺少群组ID")
+	}
+	if a.Interval < 0 {
+		return fmt.Errorf("重复间隔不能为负数")
+	}
+	if a.NextRun.IsZero() {
+		return fmt.Errorf("缺少发送时间")
+	}
+	_, err := renderAnnouncement(a)
+	return err
+}
+
+// nextAnnouncementRun 重复发送的定时消息的下次发送时间，跳过停机期间错过的时间
+func nextAnnouncementRun(a *Announcement, now time.Time) time.Time {
+	interval := time.Duration(a.Interval) * time.Minute
+	next := a.NextRun.Add(interval)
+	if next.After(now) {
+		return next
+	}
+	missed := now.Sub(next)/interval + 1
+	return next.Add(missed * interval)
+}
+
+// runAnnouncements 定时发送到期的定时消息，发送时间保存在数据库中，重启后继续；Stop 后退出
+func (tb *TelegramBot) runAnnouncements() {
+	ticker := time.NewTicker(announcementInterval)
+	defer ticker.Stop()
+
+	for {
+		tb.sendDueAnnouncements(time.Now())
+		select {
+		case <-ticker.C:
+		case <-tb.stopped:
+			return
+		}
+	}
+}
+
+func (tb *TelegramBot) sendDueAnnouncements(now time.Time) {
+	announcements, err := tb.db.GetAnnouncements(0)
+	if err != nil {
+		log.Printf("获取定时消息失败：%v", err)
+		return
+	}
+
+	for i := range announcements {
+		a := &announcements[i]
+		if !a.Enabled || a.NextRun.After(now) {
+			continue
+		}
+		tb.sendAnnouncement(a, now)
+	}
+}
+
+// sendAnnouncement 发送定时消息，按设置置顶和删除上一次发送的消息，然后安排下次发送
+func (tb *TelegramBot) sendAnnouncement(a *Announcement, now time.Time) {
+	lastMessageID := a.LastMessageID
+
+	rendered, err := renderAnnouncement(a)
+	if err != nil {
+		log.Printf("定时消息 %d 无效：%v", a.ID, err)
+	} else if sent, err := tb.outbox.Send(rendered.Chattable(a.ChatID)); err != nil {
+		log.Printf("发送定时消息 %d 失败：%v", a.ID, err)
+	} else {
+		if a.DeletePrevious && a.LastMessageID != 0 {
+			tb.deleteMessages(a.ChatID, []int{a.LastMessageID})
+		}
+		if a.Pin {
+			pin := tgbotapi.PinChatMessageConfig{
+				ChatID:              a.ChatID,
+				MessageID:           sent.MessageID,
+				DisableNotification: true,
+			}
+			if _, err := tb.outbox.Request(pin); err != nil {
+				log.Printf("置顶定时消息 %d 失败：%v", a.ID, err)
+			}
+		}
+		lastMessageID = sent.MessageID
+		log.Printf("📢 已在群组 %d 发送定时消息 %d", a.ChatID, a.ID)
+	}
+
+	// 只发送一次的消息发送后停用，失败时也不再重试
+	nextRun, enabled := a.NextRun, false
+	if a.Interval > 0 {
+		nextRun, enabled = nextAnnouncementRun(a, now), true
+	}
+	if err := tb.db.UpdateAnnouncementRun(a.ID, nextRun, lastMessageID, enabled); err != nil {
+		log.Printf("更新定时消息 %d 失败：%v", a.ID, err)
+	}
+}
+
+// parseScheduleTime 解析 /schedule 的发送时间：HH:MM 表示下一个该时刻，也可以是 YYYY-MM-DD HH:MM
+// 返回发送时间和使用的参数个数
+func parseScheduleTime(fields []string, now time.Time) (time.Time, int, error) {
+	if len(fields) >= 2 {
+		if t, err := time.ParseInLocation("2006-01-02 15:04", fields[0]+" "+fields[1], time.Local); err == nil {
+			return t, 2, nil
+		}
+	}
+	if len(fields) >= 1 {
+		if minutes, err := parseClock(fields[0]); err == nil {
+			t := time.Date(now.Year(), now.Month(), now.Day(), minutes/60, minutes%60, 0, 0, time.Local)
+			if !t.After(now) {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t, 1, nil
+		}
+	}
+	return time.Time{}, 0, fmt.Errorf("时间格式应为 HH:MM 或 YYYY-MM-DD HH:MM")
+}
+
+// handleScheduleCommand /schedule，管理当前群组的定时消息
+//
+//	/schedule - 查看定时消息
+//	/schedule in <时长> [选项] <内容> - 一段时间后发送一次
+//	/schedule at <时间> [选项] <内容> - 在指定时间发送一次
+//	/schedule every <间隔> [时间] [选项] <内容> - 重复发送，可指定第一次发送的时间
+//	/schedule delete <ID> - 删除定时消息
+//
+// 选项：-pin 发送后置顶，-replace 发送后删除上一次发送的消息；回复图片、视频或动图时将其作为媒体发送
+func (tb *TelegramBot) handleScheduleCommand(message *tgbotapi.Message, args string) {
+	chatID := message.Chat.ID
+	if !message.Chat.IsGroup() && !message.Chat.IsSuperGroup() {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 请在群组中使用 /schedule"))
+		return
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		tb.listAnnouncements(chatID)
+		return
+	}
+
+	now := time.Now()
+	a := &Announcement{ChatID: chatID, CreatedBy: message.From.ID}
+	rest := fields[1:]
+
+	switch fields[0] {
+	case "delete":
+		if len(rest) == 0 {
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 用法：/schedule delete <ID>"))
+			return
+		}
+		id, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 无效的ID"))
+			return
+		}
+		deleted, err := tb.db.DeleteAnnouncement(chatID, id)
+		switch {
+		case err != nil:
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 删除失败：%v", err)))
+		case !deleted:
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 本群组没有该定时消息"))
+		default:
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已删除定时消息 %d", id)))
+		}
+		return
+	case "in":
+		if len(rest) == 0 {
+			break
+		}
+		delay, err := parseDuration(rest[0])
+		if err != nil {
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+			return
+		}
+		a.NextRun = now.Add(delay)
+		rest = rest[1:]
+	case "at":
+		t, used, err := parseScheduleTime(rest, now)
+		if err != nil {
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+			return
+		}
+		a.NextRun = t
+		rest = rest[used:]
+	case "every":
+		if len(rest) == 0 {
+			break
+		}
+		interval, err := parseDuration(rest[0])
+		if err != nil || interval < time.Minute {
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 重复间隔至少为 1 分钟，如 30m、2h、1d"))
+			return
+		}
+		a.Interval = int(interval / time.Minute)
+		a.NextRun = now.Add(interval)
+		rest = rest[1:]
+		if t, used, err := parseScheduleTime(rest, now); err == nil {
+			a.NextRun = t
+			rest = rest[used:]
+		}
+	default:
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 用法：/schedule [in <时长> | at <时间> | every <间隔> [时间]] [-pin] [-replace] <内容>，或 /schedule delete <ID>"))
+		return
+	}
+
+	for len(rest) > 0 {
+		if rest[0] == "-pin" {
+			a.Pin = true
+		} else if rest[0] == "-replace" {
+			a.DeletePrevious = true
+		} else {
+			break
+		}
+		rest = rest[1:]
+	}
+
+	// 内容取命令中的原文，保留换行
+	a.Text = scheduleContent(args, len(fields)-len(rest))
+
+	if reply := message.ReplyToMessage; reply != nil {
+		switch {
+		case len(reply.Photo) > 0:
+			a.Media, a.MediaType = reply.Photo[len(reply.Photo)-1].FileID, "photo"
+		case reply.Video != nil:
+			a.Media, a.MediaType = reply.Video.FileID, "video"
+		case reply.Animation != nil:
+			a.Media, a.MediaType = reply.Animation.FileID, "animation"
+		}
+		if a.Text == "" {
+			a.Text = messageText(reply)
+		}
+	}
+
+	if a.NextRun.IsZero() {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 请指定发送时间"))
+		return
+	}
+	if err := validateAnnouncement(a); err != nil {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	id, err := tb.db.AddAnnouncement(a)
+	if err != nil {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 添加定时消息失败：%v", err)))
+		return
+	}
+
+	log.Printf("群组 %d 添加了定时消息 %d，%s", chatID, id, describeAnnouncement(a))
+	tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已添加定时消息 %d：%s", id, describeAnnouncement(a))))
+}
+
+// scheduleContent 去掉命令参数中的前 n 个词，返回剩余的原文
+func scheduleContent(args string, n int) string {
+	rest := strings.TrimSpace(args)
+	for i := 0; i < n; i++ {
+		rest = strings.TrimLeft(rest, " \t\n")
+		if end := strings.IndexAny(rest, " \t\n"); end >= 0 {
+			rest = rest[end:]
+		} else {
+			rest = ""
+		}
+	}
+	return strings.TrimSpace(rest)
+}
+
+// describeAnnouncement 定时消息的发送时间说明
+func describeAnnouncement(a *Announcement) string {
+	desc := a.NextRun.Local().Format("2006-01-02 15:04")
+	if a.Interval > 0 {
+		desc += fmt.Sprintf(" 起每 %s", formatDuration(time.Duration(a.Interval)*time.Minute))
+	}
+	if a.Pin {
+		desc += "，置顶"
+	}
+	if a.DeletePrevious {
+		desc += "，替换上一条"
+	}
+	return desc
+}
+
+func (tb *TelegramBot) listAnnouncements(chatID int64) {
+	announcements, err := tb.db.GetAnnouncements(chatID)
+	if err != nil {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 获取定时消息失败：%v", err)))
+		return
+	}
+	if len(announcements) == 0 {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, "ℹ️ 本群组没有定时消息"))
+		return
+	}
+
+	var lines []string
+	for i := range announcements {
+		a := &announcements[i]
+		status := ""
+		if !a.Enabled {
+			status = "（已停用）"
+		}
+		preview := []rune(a.Text)
+		if len(preview) > 30 {
+			preview = append(preview[:30], []rune("…")...)
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s%s\n   %s", a.ID, describeAnnouncement(a), status, string(preview)))
+	}
+	tb.outbox.Post(tgbotapi.NewMessage(chatID, "📢 定时消息：\n\n"+strings.Join(lines, "\n")))
+}
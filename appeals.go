@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 申诉状态
+const (
+	AppealPending  = "pending"
+	AppealApproved = "approved"
+	AppealRejected = "rejected"
+)
+
+// appealableAction 可以申诉的动作
+func appealableAction(action string) bool {
+	return action == ActionMute || action == ActionTempBan || action == ActionBan
+}
+
+// reverseAction 申诉通过时用于撤销处理的动作
+func reverseAction(action string) string {
+	if action == ActionMute {
+		return ActionUnmute
+	}
+	return ActionUnban
+}
+
+// appealLink 跳转到机器人私聊并开始申诉的链接
+func (tb *TelegramBot) appealLink(chatID int64, action string) string {
+	return fmt.Sprintf("https://t.me/%s?start=appeal_%d_%s", tb.bot.Self.UserName, chatID, action)
+}
+
+// sendAppealNotice 私聊通知被禁言/封禁的用户，附带申诉按钮（用户需要曾经启动过机器人）
+// 不在群组中发送，避免刷屏时通知和违规消息一样多
+func (tb *TelegramBot) sendAppealNotice(chatID int64, user *tgbotapi.User, action, description, reason string) {
+	groupName := strconv.FormatInt(chatID, 10)
+	if chat, err := tb.db.GetChat(chatID); err == nil && chat != nil {
+		groupName = chat.Title
+	}
+
+	msg := tgbotapi.NewMessage(user.ID, fmt.Sprintf("你在群组 %s 中被%s\n原因：%s\n如有异议，可点击下方按钮申诉", groupName, description, reason))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonURL("📝 申诉", tb.appealLink(chatID, action)),
+	))
+	tb.outbox.Post(msg)
+}
+
+// handleAppealStart 处理申诉按钮跳转，payload 格式为 appeal_<群组ID>_<动作>
+func (tb *TelegramBot) handleAppealStart(message *tgbotapi.Message, payload string) {
+	parts := strings.Split(strings.TrimPrefix(payload, "appeal_"), "_")
+	if len(parts) != 2 || !appealableAction(parts[1]) {
+		tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "❌ 无效的申诉链接"))
+		return
+	}
+
+	chatID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "❌ 无效的申诉链接"))
+		return
+	}
+
+	// 只有当前确实被禁言或封禁的用户可以申诉
+	punished, err := tb.isPunished(chatID, message.From.ID, parts[1])
+	if err != nil {
+		log.Printf("查询用户 %d 在群组 %d 的状态失败：%v", message.From.ID, chatID, err)
+		tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "❌ 暂时无法提交申诉，请稍后重试"))
+		return
+	}
+	if !punished {
+		tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "ℹ️ 你在该群组中没有被禁言或封禁，无需申诉"))
+		return
+	}
+
+	pending, err := tb.db.HasPendingAppeal(chatID, message.From.ID)
+	if err != nil {
+		log.Printf("查询申诉失败：%v", err)
+		return
+	}
+	if pending {
+		tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "ℹ️ 你已有一条待处理的申诉，请耐心等待管理员处理"))
+		return
+	}
+
+	username := message.From.UserName
+	if username == "" {
+		username = message.From.FirstName
+	}
+
+	tb.appealMu.Lock()
+	tb.pendingAppeals[message.From.ID] = &Appeal{
+		ChatID:   chatID,
+		UserID:   message.From.ID,
+		Username: username,
+		Action:   parts[1],
+	}
+	tb.appealMu.Unlock()
+
+	tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "📝 请发送你的申诉理由，管理员会尽快处理"))
+}
+
+// isPunished 用户在群组中是否仍处于申诉的处理中：禁言对应 restricted，封禁对应 kicked
+func (tb *TelegramBot) isPunished(chatID, userID int64, action string) (bool, error) {
+	member, err := tb.getChatMember(chatID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if action == ActionMute {
+		return member.Status == "restricted", nil
+	}
+	return member.Status == "kicked", nil
+}
+
+// pendingAppeal 等待用户发送理由的申诉，没有时返回 nil
+func (tb *TelegramBot) pendingAppeal(userID int64) *Appeal {
+	tb.appealMu.Lock()
+	defer tb.appealMu.Unlock()
+	return tb.pendingAppeals[userID]
+}
+
+// handleAppealMessage 保存用户发送的申诉理由，并通知管理员
+func (tb *TelegramBot) handleAppealMessage(appeal *Appeal, message *tgbotapi.Message) {
+	tb.appealMu.Lock()
+	delete(tb.pendingAppeals, message.From.ID)
+	tb.appealMu.Unlock()
+
+	appeal.Message = message.Text
+	id, err := tb.db.AddAppeal(appeal)
+	if err != nil {
+		log.Printf("保存申诉失败：%v", err)
+		tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "❌ 提交申诉失败，请稍后重试"))
+		return
+	}
+
+	tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "✅ 申诉已提交，处理结果会通过私聊通知你"))
+	log.Printf("用户 %s (ID: %d) 对群组 %d 的 %s 提交申诉 #%d", appeal.Username, appeal.UserID, appeal.ChatID, appeal.Action, id)
+
+	if tb.config.Telegram.AdminUserID == 0 {
+		return
+	}
+
+	text := fmt.Sprintf(`📝 新申诉 #%d
+
+用户: %s (ID: %d)
+群组ID: %d
+申诉动作: %s
+申诉理由: %s`, id, appeal.Username, appeal.UserID, appeal.ChatID, appeal.Action, appeal.Message)
+
+	button := func(label, action string) callbackButton {
+		return callbackButton{Text: label, Payload: CallbackPayload{
+			Action:   action,
+			ChatID:   appeal.ChatID,
+			UserID:   appeal.UserID,
+			RecordID: id,
+		}}
+	}
+
+	msg := tgbotapi.NewMessage(tb.config.Telegram.AdminUserID, text)
+	if keyboard, ok := tb.callbackKeyboard([]callbackButton{
+		button("✅ 通过", callbackAppealApprove),
+		button("❌ 驳回", callbackAppealReject),
+	}); ok {
+		msg.ReplyMarkup = keyboard
+	}
+	tb.outbox.Post(msg)
+}
+
+// resolveAppeal 处理申诉，通过时撤销原处理动作，并私聊通知用户结果
+func (tb *TelegramBot) resolveAppeal(id int, approve bool, resolvedBy int64) (*Appeal, error) {
+	appeal, err := tb.db.GetAppeal(id)
+	if err != nil {
+		return nil, err
+	}
+	if appeal == nil {
+		return nil, fmt.Errorf("申诉 #%d 不存在", id)
+	}
+	if appeal.Status != AppealPending {
+		return nil, fmt.Errorf("申诉 #%d 已处理", id)
+	}
+
+	status := AppealRejected
+	if approve {
+		status = AppealApproved
+	}
+
+	// 先认领申诉，同时在 Telegram 和 Web 管理界面中处理时只有一方会撤销处理
+	resolved, err := tb.db.ResolveAppeal(id, status, resolvedBy)
+	if err != nil {
+		return nil, err
+	}
+	if !resolved {
+		return nil, fmt.Errorf("申诉 #%d 已处理", id)
+	}
+
+	if approve {
+		user := &tgbotapi.User{ID: appeal.UserID, FirstName: appeal.Username}
+		if _, err := tb.applyAction(appeal.ChatID, user, reverseAction(appeal.Action), 0, fmt.Sprintf("申诉 #%d 通过", id), resolvedBy); err != nil {
+			// 撤销失败时恢复为待处理，管理员可以重试
+			if reopenErr := tb.db.ReopenAppeal(id); reopenErr != nil {
+				log.Printf("恢复申诉 #%d 为待处理失败：%v", id, reopenErr)
+			}
+			return nil, err
+		}
+	}
+	appeal.Status = status
+	appeal.ResolvedBy = resolvedBy
+
+	log.Printf("申诉 #%d（用户 %d，群组 %d，%s）已由 %d 处理：%s", id, appeal.UserID, appeal.ChatID, appeal.Action, resolvedBy, status)
+
+	result := "❌ 你的申诉已被驳回"
+	if approve {
+		result = "✅ 你的申诉已通过，处理已撤销"
+	}
+	tb.outbox.Post(tgbotapi.NewMessage(appeal.UserID, fmt.Sprintf("%s（申诉 #%d）", result, id)))
+
+	return appeal, nil
+}
+
+// handleAppealCallback 处理管理员点击的申诉按钮，按钮数据已由 handleActionCallback 校验签名
+func (tb *TelegramBot) handleAppealCallback(callback *tgbotapi.CallbackQuery, payload *CallbackPayload) {
+	if callback.From.ID != tb.config.Telegram.AdminUserID {
+		tb.outbox.Post(tgbotapi.NewCallback(callback.ID, "只有管理员可以处理申诉"))
+		return
+	}
+
+	approve := payload.Action == callbackAppealApprove
+	if _, err := tb.resolveAppeal(payload.RecordID, approve, callback.From.ID); err != nil {
+		tb.outbox.Post(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("处理失败：%v", err)))
+		return
+	}
+
+	result := "❌ 已驳回"
+	if approve {
+		result = "✅ 已通过"
+	}
+
+	if callback.Message != nil {
+		edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, callback.Message.Text+"\n\n"+result)
+		tb.outbox.Post(edit)
+	}
+	tb.outbox.Post(tgbotapi.NewCallback(callback.ID, result))
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -14,11 +15,31 @@ import (
 
 type TelegramBot struct {
 	bot    *tgbotapi.BotAPI
+	outbox *Outbox // 发送消息和执行操作都经过此队列
 	config *Config
 	db     *Database
 	filter *MessageFilter
-	// 添加验证状态管理
+	// 添加验证状态管理，私聊回答、群内回答和超时检查会并发访问，verifyMu 同时保护状态中的字段
+	verifyMu           sync.Mutex
 	verificationStatus map[int64]map[int64]*VerificationStatus
+	// 等待用户发送申诉理由，键为用户ID
+	appealMu       sync.Mutex
+	pendingAppeals map[int64]*Appeal
+	// 防突袭：各群组最近的加入时间和锁定状态，解除锁定的定时器会并发访问
+	raidMu    sync.Mutex
+	joinTimes map[int64][]time.Time
+	lockdowns map[int64]*Lockdown
+	// 夜间模式和防护模式共用群组的原有权限，permMu 保证保存和恢复不会交错
+	permMu sync.Mutex
+	// webhook 模式下接收推送的更新；独立监听时 webhookServer 为对应的 HTTP 服务
+	webhook       *webhookReceiver
+	webhookServer *http.Server
+	// 停止接收更新，取决于使用 webhook 还是长轮询
+	stopReceiving func()
+	// Stop 时关闭，通知夜间模式和定时消息等后台任务退出
+	stopped    chan struct{}
+	stopOnce   sync.Once
+	background sync.WaitGroup
 }
 
 type VerificationStatus struct {
@@ -26,6 +47,12 @@ type VerificationStatus struct {
 	ChatID    int64
 	StartTime time.Time
 	Attempts  int
+	// 是否已转入私聊验证
+	Private bool
+	// 验证过程中在群内产生的消息（验证提示、回答、重试提示），验证结束后删除
+	MessageIDs []int
+	// 入群筛查要求限制媒体时，验证通过后只能发送文字直到该时间
+	RestrictUntil time.Time
 }
 
 func NewTelegramBot(config *Config, db *Database) (*TelegramBot, error) {
@@ -58,29 +85,37 @@ func NewTelegramBot(config *Config, db *Database) (*TelegramBot, error) {
 	var bot *tgbotapi.BotAPI
 	var err error
 
+	// 可以指向自建的 Bot API 服务器
+	endpoint := config.Telegram.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+
 	log.Printf("🔄 正在连接到Telegram API...")
 	if httpClient != nil {
 		log.Printf("📡 使用代理客户端连接...")
-		bot, err = tgbotapi.NewBotAPIWithClient(config.Telegram.BotToken, tgbotapi.APIEndpoint, httpClient)
+		bot, err = tgbotapi.NewBotAPIWithClient(config.Telegram.BotToken, endpoint, httpClient)
 	} else {
 		log.Printf("📡 使用默认客户端连接...")
-		bot, err = tgbotapi.NewBotAPI(config.Telegram.BotToken)
+		bot, err = tgbotapi.NewBotAPIWithAPIEndpoint(config.Telegram.BotToken, endpoint)
 	}
 	if err != nil {
 		log.Printf("❌ 连接失败: %v", err)
 		return nil, fmt.Errorf("连接Telegram API失败: %v", err)
 	}
 
-	// 删除webhook
-	log.Printf("🔄 正在删除webhook...")
-	_, err = bot.Request(tgbotapi.DeleteWebhookConfig{
-		DropPendingUpdates: true,
-	})
-	if err != nil {
-		log.Printf("❌ 删除webhook失败: %v", err)
-		return nil, fmt.Errorf("删除webhook失败: %v", err)
+	// 使用长轮询时删除webhook，webhook 模式在 Start 中注册
+	if !config.Webhook.Enabled {
+		log.Printf("🔄 正在删除webhook...")
+		_, err = bot.Request(tgbotapi.DeleteWebhookConfig{
+			DropPendingUpdates: true,
+		})
+		if err != nil {
+			log.Printf("❌ 删除webhook失败: %v", err)
+			return nil, fmt.Errorf("删除webhook失败: %v", err)
+		}
+		log.Printf("✅ Webhook已删除")
 	}
-	log.Printf("✅ Webhook已删除")
 
 	bot.Debug = true // 开启调试模式
 
@@ -94,228 +129,254 @@ func NewTelegramBot(config *Config, db *Database) (*TelegramBot, error) {
 
 	tb := &TelegramBot{
 		bot:                bot,
+		outbox:             NewOutbox(bot, config),
 		config:             config,
 		db:                 db,
 		filter:             filter,
 		verificationStatus: make(map[int64]map[int64]*VerificationStatus),
+		pendingAppeals:     make(map[int64]*Appeal),
+		joinTimes:          make(map[int64][]time.Time),
+		lockdowns:          make(map[int64]*Lockdown),
+		stopReceiving:      bot.StopReceivingUpdates,
+		stopped:            make(chan struct{}),
+	}
+	if config.Webhook.Enabled {
+		tb.webhook = newWebhookReceiver(tb.webhookSecret(), config.Updates.QueueSize)
 	}
 
 	log.Printf("✅ Bot已连接：%s", bot.Self.UserName)
 	return tb, nil
 }
 
+// getGroupSettings 获取群组设置，没有特定设置时使用配置文件中的默认设置
+func (tb *TelegramBot) getGroupSettings(chatID int64) (*GroupSettings, error) {
+	settings, err := tb.db.GetGroupSettings(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings == nil {
+		settings = tb.config.DefaultGroupSettings(chatID)
+	}
+
+	if settings.VerificationMode == "" {
+		settings.VerificationMode = "group"
+	}
+	if settings.WarningLadder == "" {
+		settings.WarningLadder = tb.config.Groups.DefaultSettings.Warnings.Ladder
+	}
+	if settings.WarningLadder == "" {
+		settings.WarningLadder = defaultWarningLadder
+	}
+	if settings.WarningExpiry <= 0 {
+		settings.WarningExpiry = tb.config.Groups.DefaultSettings.Warnings.Expiry
+	}
+	if settings.WarningExpiry <= 0 {
+		settings.WarningExpiry = defaultWarningExpiry
+	}
+	if settings.PurgeWindow <= 0 {
+		settings.PurgeWindow = tb.config.Groups.DefaultSettings.PurgeWindow
+	}
+	if settings.PurgeWindow <= 0 {
+		settings.PurgeWindow = defaultPurgeWindow
+	}
+	if settings.Question == "" {
+		settings.Question = tb.config.Groups.DefaultSettings.Verification.Question
+		settings.Answer = tb.config.Groups.DefaultSettings.Verification.Answer
+	}
+	if settings.RaidThreshold <= 0 {
+		settings.RaidThreshold = defaultRaidThreshold
+	}
+	if settings.RaidWindow <= 0 {
+		settings.RaidWindow = defaultRaidWindow
+	}
+	if settings.RaidLockdown <= 0 {
+		settings.RaidLockdown = defaultRaidLockdown
+	}
+	if settings.ScreeningThreshold <= 0 {
+		settings.ScreeningThreshold = defaultScreeningThreshold
+	}
+	if settings.ScreeningAction == "" {
+		settings.ScreeningAction = defaultScreeningAction
+	}
+	if settings.ScreeningRestrictHours <= 0 {
+		settings.ScreeningRestrictHours = defaultScreeningRestrictHours
+	}
+	if settings.ScreeningNewAccountID <= 0 {
+		settings.ScreeningNewAccountID = defaultNewAccountID
+	}
+	if settings.ProbationDuration <= 0 {
+		settings.ProbationDuration = defaultProbationDuration
+	}
+	if settings.ProbationMessages <= 0 {
+		settings.ProbationMessages = defaultProbationMessages
+	}
+	if settings.ForwardAction == "" {
+		settings.ForwardAction = defaultForwardAction
+	}
+	if settings.NightModeStart == "" {
+		settings.NightModeStart = defaultNightModeStart
+	}
+	if settings.NightModeEnd == "" {
+		settings.NightModeEnd = defaultNightModeEnd
+	}
+	if settings.NightModeTimezone == "" {
+		settings.NightModeTimezone = defaultNightModeTimezone
+	}
+	if settings.NightModeProfile == "" {
+		settings.NightModeProfile = defaultNightModeProfile
+	}
+
+	return settings, nil
+}
+
 func (tb *TelegramBot) Start() {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 30
+	tb.resumeLockdowns()
+	tb.runInBackground(tb.runNightMode)
+	tb.runInBackground(tb.runAnnouncements)
 
-	updates := tb.bot.GetUpdatesChan(u)
+	updates := tb.receiveUpdates()
 
+	dispatcher := newUpdateDispatcher(tb.config.Updates.Workers, tb.config.Updates.QueueSize, tb.handleUpdate)
 	for update := range updates {
-		if update.Message != nil {
-			tb.handleMessage(update.Message)
-		} else if update.ChatMember != nil {
-			tb.handleNewMember(update.ChatMember)
-		} else if update.CallbackQuery != nil {
-			tb.handleCallback(update.CallbackQuery)
-		}
+		dispatcher.dispatch(update)
 	}
+
+	// Stop 之后等后台任务退出，处理完已收到的更新，并发送完队列中的请求
+	tb.background.Wait()
+	dispatcher.drain()
+	tb.outbox.Flush(outboxFlushTimeout)
+	log.Println("✅ 已处理完所有更新")
 }
 
-func (tb *TelegramBot) handleNewMember(chatMember *tgbotapi.ChatMemberUpdated) {
-	if chatMember.NewChatMember.Status != "member" {
-		return
+// welcomeMember 向新成员发送欢迎消息，启用验证或群组处于防护模式时限制权限并开始验证
+func (tb *TelegramBot) welcomeMember(chat *tgbotapi.Chat, user *tgbotapi.User, settings *GroupSettings, lockdown bool) {
+	if lockdown {
+		settings.VerificationEnabled = true
 	}
 
-	settings, err := tb.db.GetGroupSettings(chatMember.Chat.ID)
+	privateMode := settings.VerificationEnabled && settings.VerificationMode == "private"
+
+	// 发送欢迎消息
+	var memberCount int
+	err := tb.outbox.Do(chat.ID, PriorityNormal, "ChatMemberCountConfig", func() error {
+		var err error
+		memberCount, err = tb.bot.GetChatMembersCount(tgbotapi.ChatMemberCountConfig{
+			ChatConfig: tgbotapi.ChatConfig{ChatID: chat.ID},
+		})
+		return err
+	})
 	if err != nil {
-		log.Printf("获取群组设置失败: %v", err)
-		return
+		log.Printf("获取群组成员数失败: %v", err)
 	}
 
-	// 如果没有特定设置，使用默认设置
-	if settings == nil {
-		settings = &GroupSettings{
-			ChatID:              chatMember.Chat.ID,
-			WelcomeMessage:      tb.config.Groups.DefaultSettings.WelcomeMessage,
-			VerificationEnabled: tb.config.Groups.DefaultSettings.Verification.Enabled,
-			Question:            tb.config.Groups.DefaultSettings.Verification.Question,
-			Answer:              tb.config.Groups.DefaultSettings.Verification.Answer,
-			Timeout:             tb.config.Groups.DefaultSettings.Verification.Timeout,
-		}
+	rendered, err := RenderWelcome(settings, WelcomeData{
+		UserID:      user.ID,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		UserName:    user.UserName,
+		GroupName:   chat.Title,
+		MemberCount: memberCount,
+		Date:        time.Now(),
+	})
+	if err != nil {
+		// 模板有误时按纯文本发送，不影响后续验证
+		log.Printf("渲染欢迎消息失败: %v", err)
+		rendered = &RenderedWelcome{Text: settings.WelcomeMessage}
 	}
 
-	// 发送欢迎消息
-	welcomeMsg := strings.ReplaceAll(settings.WelcomeMessage, "{user}", chatMember.From.FirstName)
-	welcomeMsg = strings.ReplaceAll(welcomeMsg, "{group_name}", chatMember.Chat.Title)
-	msg := tgbotapi.NewMessage(chatMember.Chat.ID, welcomeMsg)
-	tb.bot.Send(msg)
+	var extraRows [][]tgbotapi.InlineKeyboardButton
+	if privateMode {
+		// 私聊验证模式下，欢迎消息附带跳转到机器人私聊的验证按钮
+		verifyURL := fmt.Sprintf("https://t.me/%s?start=verify_%d", tb.bot.Self.UserName, chat.ID)
+		extraRows = append(extraRows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("🔐 点击验证", verifyURL),
+		))
+	}
+	msg := rendered.Chattable(chat.ID, extraRows...)
+	welcome, err := tb.outbox.Send(msg)
+	if err != nil {
+		log.Printf("发送欢迎消息失败: %v", err)
+	}
+
+	// 验证相关的群内消息（包括欢迎消息），验证结束后统一删除
+	var onboardingIDs []int
+	if settings.VerificationEnabled && welcome.MessageID != 0 {
+		onboardingIDs = append(onboardingIDs, welcome.MessageID)
+	} else if welcome.MessageID != 0 {
+		tb.deleteMessagesLater(chat.ID, []int{welcome.MessageID}, settings.CleanupDelay)
+	}
 
 	// 如果启用了验证
 	if settings.VerificationEnabled {
 		// 限制用户权限
 		restrictConfig := tgbotapi.RestrictChatMemberConfig{
 			ChatMemberConfig: tgbotapi.ChatMemberConfig{
-				ChatID: chatMember.Chat.ID,
-				UserID: chatMember.From.ID,
-			},
-			UntilDate: time.Now().Add(time.Duration(settings.Timeout) * time.Second).Unix(),
-			Permissions: &tgbotapi.ChatPermissions{
-				CanSendMessages:       false,
-				CanSendMediaMessages:  false,
-				CanSendPolls:          false,
-				CanSendOtherMessages:  false,
-				CanAddWebPagePreviews: false,
-				CanChangeInfo:         false,
-				CanInviteUsers:        false,
-				CanPinMessages:        false,
+				ChatID: chat.ID,
+				UserID: user.ID,
 			},
+			UntilDate:   time.Now().Add(time.Duration(settings.Timeout) * time.Second).Unix(),
+			Permissions: mutedPermissions(),
+		}
+		tb.outbox.Post(restrictConfig)
+
+		// 发送验证问题（私聊模式下问题在私聊中发送）
+		if !privateMode {
+			verifyMsg := fmt.Sprintf("欢迎 %s！\n为了防止机器人，请回答以下问题：\n\n%s",
+				user.FirstName, settings.Question)
+			msg := tgbotapi.NewMessage(chat.ID, verifyMsg)
+			if sent, err := tb.outbox.Send(msg); err == nil {
+				onboardingIDs = append(onboardingIDs, sent.MessageID)
+			}
 		}
-		tb.bot.Request(restrictConfig)
-
-		// 发送验证问题
-		verifyMsg := fmt.Sprintf("欢迎 %s！\n为了防止机器人，请回答以下问题：\n\n%s",
-			chatMember.From.FirstName, settings.Question)
-		msg := tgbotapi.NewMessage(chatMember.Chat.ID, verifyMsg)
-		tb.bot.Send(msg)
 
 		// 记录验证状态
-		if _, exists := tb.verificationStatus[chatMember.Chat.ID]; !exists {
-			tb.verificationStatus[chatMember.Chat.ID] = make(map[int64]*VerificationStatus)
+		status := &VerificationStatus{
+			UserID:     user.ID,
+			ChatID:     chat.ID,
+			StartTime:  time.Now(),
+			Attempts:   0,
+			MessageIDs: onboardingIDs,
 		}
-		tb.verificationStatus[chatMember.Chat.ID][chatMember.From.ID] = &VerificationStatus{
-			UserID:    chatMember.From.ID,
-			ChatID:    chatMember.Chat.ID,
-			StartTime: time.Now(),
-			Attempts:  0,
+		tb.verifyMu.Lock()
+		if _, exists := tb.verificationStatus[chat.ID]; !exists {
+			tb.verificationStatus[chat.ID] = make(map[int64]*VerificationStatus)
 		}
+		tb.verificationStatus[chat.ID][user.ID] = status
+		tb.verifyMu.Unlock()
 
-		// 设置超时检查
+		// 设置超时检查：到期仍未通过验证（包括回答错误后不再回答）时移出用户
 		go func() {
 			time.Sleep(time.Duration(settings.Timeout) * time.Second)
-			if status, exists := tb.verificationStatus[chatMember.Chat.ID][chatMember.From.ID]; exists {
-				if status.Attempts == 0 {
-					// 超时未验证，踢出用户
-					kickConfig := tgbotapi.KickChatMemberConfig{
-						ChatMemberConfig: tgbotapi.ChatMemberConfig{
-							ChatID: chatMember.Chat.ID,
-							UserID: chatMember.From.ID,
-						},
-					}
-					tb.bot.Request(kickConfig)
-					delete(tb.verificationStatus[chatMember.Chat.ID], chatMember.From.ID)
-				}
+
+			if tb.endVerification(status) {
+				tb.verifyMu.Lock()
+				messageIDs := append([]int(nil), status.MessageIDs...)
+				tb.verifyMu.Unlock()
+
+				// 超时未验证，移出用户，之后可以重新加入
+				tb.kickUser(chat.ID, user.ID)
+				tb.deleteMessages(chat.ID, messageIDs)
 			}
 		}()
 	}
 }
 
 func (tb *TelegramBot) handleMessage(message *tgbotapi.Message) {
+	// 加入/离开群组的系统消息
+	if message.NewChatMembers != nil || message.LeftChatMember != nil {
+		tb.handleServiceMessage(message)
+		return
+	}
+
 	// 记录消息
 	if message.Chat.IsGroup() || message.Chat.IsSuperGroup() {
-		// 记录群组信息
-		chat := &Chat{
-			ChatID: message.Chat.ID,
-			Title:  message.Chat.Title,
-			Type:   message.Chat.Type,
-		}
-		if err := tb.db.UpsertChat(chat); err != nil {
-			log.Printf("记录群组信息失败：%v", err)
-		}
-
-		// 记录消息
-		msg := &Message{
-			Timestamp:      time.Unix(int64(message.Date), 0),
-			ChatID:         message.Chat.ID,
-			ChatTitle:      message.Chat.Title,
-			UserName:       message.From.UserName,
-			FromUserID:     message.From.ID,
-			MessageType:    "text",
-			MessageContent: message.Text,
-		}
-
-		// 根据消息类型设置相应的字段
-		if message.Photo != nil && len(message.Photo) > 0 {
-			msg.MessageType = "photo"
-			msg.MessageContent = message.Caption
-			msg.FilePath = message.Photo[len(message.Photo)-1].FileID
-		} else if message.Document != nil {
-			msg.MessageType = "document"
-			msg.MessageContent = message.Caption
-			msg.FilePath = message.Document.FileID
-		} else if message.Video != nil {
-			msg.MessageType = "video"
-			msg.MessageContent = message.Caption
-			msg.FilePath = message.Video.FileID
-		} else if message.Audio != nil {
-			msg.MessageType = "audio"
-			msg.MessageContent = message.Caption
-			msg.FilePath = message.Audio.FileID
-		} else if message.Voice != nil {
-			msg.MessageType = "voice"
-			msg.MessageContent = message.Caption
-			msg.FilePath = message.Voice.FileID
-		} else if message.Sticker != nil {
-			msg.MessageType = "sticker"
-			msg.FilePath = message.Sticker.FileID
-		}
-
-		if err := tb.db.LogMessage(msg); err != nil {
-			log.Printf("记录消息失败：%v", err)
-		}
+		tb.recordMessage(message)
 	}
 
 	// 检查是否是验证回答
-	if status, exists := tb.verificationStatus[message.Chat.ID][message.From.ID]; exists {
-		settings, _ := tb.db.GetGroupSettings(message.Chat.ID)
-		if settings == nil {
-			settings = &GroupSettings{
-				Answer: tb.config.Groups.DefaultSettings.Verification.Answer,
-			}
-		}
-
-		status.Attempts++
-		if message.Text == settings.Answer {
-			// 验证成功
-			delete(tb.verificationStatus[message.Chat.ID], message.From.ID)
-
-			// 解除限制
-			unrestrictConfig := tgbotapi.RestrictChatMemberConfig{
-				ChatMemberConfig: tgbotapi.ChatMemberConfig{
-					ChatID: message.Chat.ID,
-					UserID: message.From.ID,
-				},
-				Permissions: &tgbotapi.ChatPermissions{
-					CanSendMessages:       true,
-					CanSendMediaMessages:  true,
-					CanSendPolls:          true,
-					CanSendOtherMessages:  true,
-					CanAddWebPagePreviews: true,
-					CanChangeInfo:         false,
-					CanInviteUsers:        true,
-					CanPinMessages:        false,
-				},
-			}
-			tb.bot.Request(unrestrictConfig)
-
-			successMsg := fmt.Sprintf("✅ 验证成功！欢迎 %s 加入群组！", message.From.FirstName)
-			msg := tgbotapi.NewMessage(message.Chat.ID, successMsg)
-			tb.bot.Send(msg)
-		} else if status.Attempts >= 3 {
-			// 验证失败次数过多，踢出用户
-			kickConfig := tgbotapi.KickChatMemberConfig{
-				ChatMemberConfig: tgbotapi.ChatMemberConfig{
-					ChatID: message.Chat.ID,
-					UserID: message.From.ID,
-				},
-			}
-			tb.bot.Request(kickConfig)
-			delete(tb.verificationStatus[message.Chat.ID], message.From.ID)
-		} else {
-			// 回答错误，提示重试
-			retryMsg := fmt.Sprintf("❌ 回答错误，还有 %d 次机会。", 3-status.Attempts)
-			msg := tgbotapi.NewMessage(message.Chat.ID, retryMsg)
-			tb.bot.Send(msg)
-		}
+	if status := tb.verification(message.Chat.ID, message.From.ID); status != nil {
+		tb.handleVerificationAnswer(status, message)
 		return
 	}
 
@@ -332,6 +393,47 @@ func (tb *TelegramBot) handleMessage(message *tgbotapi.Message) {
 		}
 	}
 
+	// 成员举报
+	if message.IsCommand() && message.Command() == "report" {
+		tb.handleReportCommand(message)
+		return
+	}
+
+	tb.moderateMessage(message, false)
+}
+
+// moderateMessage 按群组规则检查成员发送或编辑后的消息：观察期限制、媒体和转发策略、关键词，
+// 白名单中的用户不检查；edited 为 true 时不检查被回复的消息，也不计入观察期的正常消息数
+func (tb *TelegramBot) moderateMessage(message *tgbotapi.Message, edited bool) {
+	// 白名单中的用户不检查消息内容
+	if allowed, err := tb.db.IsAllowlisted(message.Chat.ID, message.From.ID); err != nil {
+		log.Printf("查询白名单失败：%v", err)
+	} else if allowed {
+		return
+	}
+
+	// 观察期内的新成员不能发送链接、媒体、转发和提及
+	settings, err := tb.getGroupSettings(message.Chat.ID)
+	if err != nil {
+		log.Printf("获取群组设置失败: %v", err)
+	}
+	probation := err == nil && tb.onProbation(message.Chat.ID, message.From.ID, settings)
+	if probation && tb.enforceProbation(message, settings) {
+		return
+	}
+
+	// 按群组的媒体策略检查内容类型
+	if settings != nil {
+		if result := checkMediaPolicy(message, settings); result.IsViolation {
+			tb.handleViolation(message, result, describeContent(message))
+			return
+		}
+		if result := checkForwardPolicy(message, settings); result.IsViolation {
+			tb.handleViolation(message, result, describeContent(message))
+			return
+		}
+	}
+
 	// 检查消息内容
 	if message.Text != "" {
 		result := tb.filter.CheckMessage(message.Text)
@@ -341,8 +443,20 @@ func (tb *TelegramBot) handleMessage(message *tgbotapi.Message) {
 		}
 	}
 
-	// 检查回复的消息
-	if message.ReplyToMessage != nil && message.ReplyToMessage.Text != "" {
+	// 检查媒体的说明文字和文件名
+	if result := tb.filter.CheckCaption(message.Caption); result.IsViolation {
+		tb.handleViolation(message, result, message.Caption)
+		return
+	}
+	if fileName := messageFileName(message); fileName != "" {
+		if result := tb.filter.CheckFileName(fileName); result.IsViolation {
+			tb.handleViolation(message, result, describeContent(message))
+			return
+		}
+	}
+
+	// 检查回复的消息；编辑时被回复的消息没有变化，不再重复检查
+	if !edited && message.ReplyToMessage != nil && message.ReplyToMessage.Text != "" {
 		result := tb.filter.CheckMessage(message.ReplyToMessage.Text)
 		if result.IsViolation {
 			tb.handleViolation(message.ReplyToMessage, result, message.ReplyToMessage.Text)
@@ -350,17 +464,386 @@ func (tb *TelegramBot) handleMessage(message *tgbotapi.Message) {
 		}
 	}
 
-	// 检查转发的消息
-	if message.ForwardFrom != nil && message.Text != "" {
-		result := tb.filter.CheckMessage(message.Text)
-		if result.IsViolation {
-			tb.handleViolation(message, result, message.Text)
+	// 检查转发来源的名称，频道名常用于广告
+	if origin := forwardOrigin(message); origin != nil && origin.Name != "" {
+		if result := tb.filter.CheckMessage(origin.Name); result.IsViolation {
+			tb.handleViolation(message, result, "转发自 "+origin.String())
+			return
+		}
+	}
+
+	if probation && !edited {
+		tb.countCleanMessage(message, settings)
+	}
+}
+
+// recordMessage 记录群组信息和消息内容
+func (tb *TelegramBot) recordMessage(message *tgbotapi.Message) {
+	// 记录群组信息
+	chat := &Chat{
+		ChatID: message.Chat.ID,
+		Title:  message.Chat.Title,
+		Type:   message.Chat.Type,
+	}
+	if err := tb.db.UpsertChat(chat); err != nil {
+		log.Printf("记录群组信息失败：%v", err)
+	}
+
+	senderID, senderName := messageSender(message)
+
+	// 记录消息
+	msg := &Message{
+		Timestamp:      time.Unix(int64(message.Date), 0),
+		MessageID:      message.MessageID,
+		ChatID:         message.Chat.ID,
+		ChatTitle:      message.Chat.Title,
+		UserName:       senderName,
+		FromUserID:     senderID,
+		MessageType:    "text",
+		MessageContent: message.Text,
+	}
+
+	// 根据消息类型设置相应的字段
+	if message.Photo != nil && len(message.Photo) > 0 {
+		msg.MessageType = "photo"
+		msg.MessageContent = message.Caption
+		msg.FilePath = message.Photo[len(message.Photo)-1].FileID
+	} else if message.Document != nil {
+		msg.MessageType = "document"
+		msg.MessageContent = message.Caption
+		msg.FilePath = message.Document.FileID
+	} else if message.Video != nil {
+		msg.MessageType = "video"
+		msg.MessageContent = message.Caption
+		msg.FilePath = message.Video.FileID
+	} else if message.Audio != nil {
+		msg.MessageType = "audio"
+		msg.MessageContent = message.Caption
+		msg.FilePath = message.Audio.FileID
+	} else if message.Voice != nil {
+		msg.MessageType = "voice"
+		msg.MessageContent = message.Caption
+		msg.FilePath = message.Voice.FileID
+	} else if message.Sticker != nil {
+		msg.MessageType = "sticker"
+		msg.FilePath = message.Sticker.FileID
+	}
+
+	if origin := forwardOrigin(message); origin != nil {
+		msg.ForwardType = origin.Type
+		msg.ForwardFromID = origin.ID
+		msg.ForwardFrom = origin.Name
+	}
+
+	if err := tb.db.LogMessage(msg); err != nil {
+		log.Printf("记录消息失败：%v", err)
+	}
+}
+
+// messageSender 消息的发送者，频道消息没有 From，使用频道本身
+func messageSender(message *tgbotapi.Message) (int64, string) {
+	if message.From != nil {
+		return message.From.ID, message.From.UserName
+	}
+	if message.SenderChat != nil {
+		return message.SenderChat.ID, message.SenderChat.Title
+	}
+	return message.Chat.ID, message.Chat.Title
+}
+
+// handleVerificationAnswer 校验新成员的验证回答，回复发送到回答所在的聊天，
+// 解除限制则作用于原群组
+func (tb *TelegramBot) handleVerificationAnswer(status *VerificationStatus, message *tgbotapi.Message) {
+	settings, err := tb.getGroupSettings(status.ChatID)
+	if err != nil {
+		log.Printf("获取群组设置失败: %v", err)
+		return
+	}
+
+	// 群内的回答也需要在验证结束后删除；群内和私聊中的回答可能同时处理，状态只在锁内读取
+	tb.verifyMu.Lock()
+	if !status.Private {
+		status.MessageIDs = append(status.MessageIDs, message.MessageID)
+	}
+	status.Attempts++
+	attempts := status.Attempts
+	private := status.Private
+	restrictUntil := status.RestrictUntil
+	messageIDs := append([]int(nil), status.MessageIDs...)
+	tb.verifyMu.Unlock()
+
+	correct := strings.TrimSpace(message.Text) == settings.Answer
+	if correct || attempts >= 3 {
+		// 验证已结束（如同时在群内和私聊中回答），不再重复处理
+		if !tb.endVerification(status) {
+			return
+		}
+	}
+
+	if correct {
+		// 验证成功
+		tb.deleteMessages(status.ChatID, messageIDs)
+
+		// 解除限制，入群筛查要求限制媒体时改为只能发送文字
+		if time.Now().Before(restrictUntil) {
+			tb.restrictMedia(status.ChatID, status.UserID, restrictUntil)
+		} else {
+			unrestrictConfig := tgbotapi.RestrictChatMemberConfig{
+				ChatMemberConfig: tgbotapi.ChatMemberConfig{
+					ChatID: status.ChatID,
+					UserID: status.UserID,
+				},
+				Permissions: memberPermissions(),
+			}
+			tb.outbox.Post(unrestrictConfig)
+		}
+
+		successMsg := fmt.Sprintf("✅ 验证成功！欢迎 %s 加入群组！", message.From.FirstName)
+		msg := tgbotapi.NewMessage(message.Chat.ID, successMsg)
+		if sent, err := tb.outbox.Send(msg); err == nil && !private {
+			tb.deleteMessagesLater(status.ChatID, []int{sent.MessageID}, settings.CleanupDelay)
+		}
+	} else if attempts >= 3 {
+		// 验证失败次数过多，移出用户，之后可以重新加入
+		tb.kickUser(status.ChatID, status.UserID)
+		tb.deleteMessages(status.ChatID, messageIDs)
+
+		if private {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 验证失败次数过多，已被移出群组。")
+			tb.outbox.Post(msg)
+		}
+	} else {
+		// 回答错误，提示重试
+		retryMsg := fmt.Sprintf("❌ 回答错误，还有 %d 次机会。", 3-attempts)
+		msg := tgbotapi.NewMessage(message.Chat.ID, retryMsg)
+		if sent, err := tb.outbox.Send(msg); err == nil {
+			tb.verifyMu.Lock()
+			if !status.Private {
+				status.MessageIDs = append(status.MessageIDs, sent.MessageID)
+			}
+			tb.verifyMu.Unlock()
+		}
+	}
+}
+
+// handleServiceMessage 处理加入/离开群组的系统消息，封禁全局封禁的新成员，按群组设置删除消息
+func (tb *TelegramBot) handleServiceMessage(message *tgbotapi.Message) {
+	globallyBanned := false
+	for i := range message.NewChatMembers {
+		if tb.memberJoined(message.Chat, &message.NewChatMembers[i], message.From, "", sourceServiceMessage) {
+			globallyBanned = true
+		}
+	}
+	if message.LeftChatMember != nil {
+		tb.memberLeft(message.Chat, message.LeftChatMember, message.From, "", "", sourceServiceMessage)
+	}
+
+	settings, err := tb.getGroupSettings(message.Chat.ID)
+	if err != nil {
+		log.Printf("获取群组设置失败: %v", err)
+		return
+	}
+
+	if settings.DeleteServiceMessages || globallyBanned {
+		tb.deleteMessages(message.Chat.ID, []int{message.MessageID})
+	}
+}
+
+// deleteMessagesBatchSize deleteMessages 接口单次最多删除的消息数
+const deleteMessagesBatchSize = 100
+
+// deleteMessages 删除聊天中的一组消息，每批最多 100 条
+// 批量删除失败时（如部分消息已超过 48 小时）逐条删除
+func (tb *TelegramBot) deleteMessages(chatID int64, messageIDs []int) {
+	for start := 0; start < len(messageIDs); start += deleteMessagesBatchSize {
+		end := start + deleteMessagesBatchSize
+		if end > len(messageIDs) {
+			end = len(messageIDs)
+		}
+		batch := messageIDs[start:end]
+
+		if len(batch) > 1 {
+			params := tgbotapi.Params{}
+			params.AddNonZero64("chat_id", chatID)
+			params.AddInterface("message_ids", batch)
+
+			err := tb.outbox.Do(chatID, PriorityHigh, "deleteMessages", func() error {
+				_, err := tb.bot.MakeRequest("deleteMessages", params)
+				return err
+			})
+			if err == nil {
+				continue
+			}
+			log.Printf("批量删除消息失败，改为逐条删除：%v", err)
+		}
+
+		for _, id := range batch {
+			deleteMsg := tgbotapi.NewDeleteMessage(chatID, id)
+			if _, err := tb.outbox.Request(deleteMsg); err != nil {
+				log.Printf("删除消息 %d 失败：%v", id, err)
+			}
+		}
+	}
+}
+
+// defaultPurgeWindow 未配置时清除近期消息回溯的分钟数
+const defaultPurgeWindow = 10
+
+// purgeRecentMessages 删除用户在 window 时间内于群组中发送的消息，返回删除的数量
+func (tb *TelegramBot) purgeRecentMessages(chatID, userID int64, window time.Duration) int {
+	ids, err := tb.db.GetUserMessageIDs(chatID, userID, time.Now().Add(-window))
+	if err != nil {
+		log.Printf("获取用户 %d 的近期消息失败：%v", userID, err)
+		return 0
+	}
+
+	tb.deleteMessages(chatID, ids)
+	log.Printf("已清除用户 %d 在群组 %d 的 %d 条近期消息", userID, chatID, len(ids))
+	return len(ids)
+}
+
+// handlePurgeCommand /purge [分钟]，回复用户的消息，删除该用户最近一段时间内的消息
+func (tb *TelegramBot) handlePurgeCommand(message *tgbotapi.Message, args string) {
+	if message.ReplyToMessage == nil || message.ReplyToMessage.From == nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 用法：回复用户的消息并发送 /purge [分钟]")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	settings, err := tb.getGroupSettings(message.Chat.ID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ 获取群组设置失败：%v", err))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	minutes := settings.PurgeWindow
+	if args = strings.TrimSpace(args); args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n <= 0 {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 分钟数必须是正整数")
+			tb.outbox.Post(msg)
 			return
 		}
+		minutes = n
+	}
+
+	user := message.ReplyToMessage.From
+	count := tb.purgeRecentMessages(message.Chat.ID, user.ID, time.Duration(minutes)*time.Minute)
+	tb.deleteMessages(message.Chat.ID, []int{message.ReplyToMessage.MessageID, message.MessageID})
+
+	notice := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("🧹 已清除 %s 最近 %d 分钟内的 %d 条消息", user.FirstName, minutes, count))
+	if sent, err := tb.outbox.Send(notice); err == nil {
+		tb.deleteMessagesLater(message.Chat.ID, []int{sent.MessageID}, 10)
+	}
+}
+
+// deleteMessagesLater 在 delay 秒后删除消息，delay 不大于 0 时保留消息
+func (tb *TelegramBot) deleteMessagesLater(chatID int64, messageIDs []int, delay int) {
+	if delay <= 0 || len(messageIDs) == 0 {
+		return
+	}
+
+	go func() {
+		time.Sleep(time.Duration(delay) * time.Second)
+		tb.deleteMessages(chatID, messageIDs)
+	}()
+}
+
+// verification 用户在群组中正在进行的验证，没有时返回 nil
+func (tb *TelegramBot) verification(chatID, userID int64) *VerificationStatus {
+	tb.verifyMu.Lock()
+	defer tb.verifyMu.Unlock()
+	return tb.verificationStatus[chatID][userID]
+}
+
+// endVerification 结束验证并移除状态，验证已被其他流程结束时返回 false
+func (tb *TelegramBot) endVerification(status *VerificationStatus) bool {
+	tb.verifyMu.Lock()
+	defer tb.verifyMu.Unlock()
+	if tb.verificationStatus[status.ChatID][status.UserID] != status {
+		return false
+	}
+	delete(tb.verificationStatus[status.ChatID], status.UserID)
+	return true
+}
+
+// findPrivateVerification 查找用户正在私聊中进行的验证
+func (tb *TelegramBot) findPrivateVerification(userID int64) *VerificationStatus {
+	tb.verifyMu.Lock()
+	defer tb.verifyMu.Unlock()
+	for _, users := range tb.verificationStatus {
+		if status, exists := users[userID]; exists && status.Private {
+			return status
+		}
+	}
+	return nil
+}
+
+// handleVerifyStart 处理欢迎消息中验证按钮跳转过来的 /start verify_<chatID>
+func (tb *TelegramBot) handleVerifyStart(message *tgbotapi.Message, payload string) {
+	chatID, err := strconv.ParseInt(strings.TrimPrefix(payload, "verify_"), 10, 64)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 无效的验证链接")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	status := tb.verification(chatID, message.From.ID)
+	if status == nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "ℹ️ 你没有待完成的入群验证")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	settings, err := tb.getGroupSettings(chatID)
+	if err != nil {
+		log.Printf("获取群组设置失败: %v", err)
+		return
+	}
+
+	tb.verifyMu.Lock()
+	status.Private = true
+	tb.verifyMu.Unlock()
+
+	groupName := strconv.FormatInt(chatID, 10)
+	if chat, err := tb.db.GetChat(chatID); err == nil && chat != nil {
+		groupName = chat.Title
 	}
+
+	verifyMsg := fmt.Sprintf("欢迎 %s！\n你正在加入 %s，为了防止机器人，请回答以下问题：\n\n%s",
+		message.From.FirstName, groupName, settings.Question)
+	msg := tgbotapi.NewMessage(message.Chat.ID, verifyMsg)
+	tb.outbox.Post(msg)
 }
 
 func (tb *TelegramBot) handlePrivateMessage(message *tgbotapi.Message) {
+	// 处理验证按钮跳转
+	if message.IsCommand() && message.Command() == "start" &&
+		strings.HasPrefix(message.CommandArguments(), "verify_") {
+		tb.handleVerifyStart(message, message.CommandArguments())
+		return
+	}
+
+	// 处理申诉按钮跳转
+	if message.IsCommand() && message.Command() == "start" &&
+		strings.HasPrefix(message.CommandArguments(), "appeal_") {
+		tb.handleAppealStart(message, message.CommandArguments())
+		return
+	}
+
+	// 处理私聊中的验证回答
+	if status := tb.findPrivateVerification(message.From.ID); status != nil && !message.IsCommand() {
+		tb.handleVerificationAnswer(status, message)
+		return
+	}
+
+	// 处理用户发送的申诉理由
+	if appeal := tb.pendingAppeal(message.From.ID); appeal != nil && !message.IsCommand() && message.Text != "" {
+		tb.handleAppealMessage(appeal, message)
+		return
+	}
+
 	if message.From.ID != tb.config.Telegram.AdminUserID {
 		return
 	}
@@ -381,6 +864,15 @@ func (tb *TelegramBot) handleAdminCommand(message *tgbotapi.Message) bool {
 	case "start", "help":
 		tb.sendHelp(message.Chat.ID)
 		return true
+	case "add_keyword":
+		tb.handleAddKeyword(message.Chat.ID, args)
+		return true
+	case "list_keywords":
+		tb.handleListKeywords(message.Chat.ID)
+		return true
+	case "delete_keyword":
+		tb.handleDeleteKeyword(message.Chat.ID, args)
+		return true
 	case "violations":
 		tb.handleShowViolations(message.Chat.ID, args)
 		return true
@@ -390,6 +882,39 @@ func (tb *TelegramBot) handleAdminCommand(message *tgbotapi.Message) bool {
 	case "status":
 		tb.handleStatus(message.Chat.ID)
 		return true
+	case "warn":
+		tb.handleWarnCommand(message, args)
+		return true
+	case "unwarn":
+		tb.handleUnwarnCommand(message)
+		return true
+	case "warns":
+		tb.handleWarnsCommand(message, args)
+		return true
+	case "mute", "unmute", "tempban", "ban", "unban", "kick":
+		tb.handleActionCommand(message, command, args)
+		return true
+	case "del":
+		tb.handleActionCommand(message, ActionDelete, args)
+		return true
+	case "purge":
+		tb.handlePurgeCommand(message, args)
+		return true
+	case "gban":
+		tb.handleGlobalBanCommand(message, args)
+		return true
+	case "lockdown":
+		tb.handleLockdownCommand(message, args)
+		return true
+	case "unlock":
+		tb.handleUnlockCommand(message)
+		return true
+	case "ungban":
+		tb.handleGlobalUnbanCommand(message, args)
+		return true
+	case "schedule":
+		tb.handleScheduleCommand(message, args)
+		return true
 	}
 
 	return false
@@ -399,14 +924,34 @@ func (tb *TelegramBot) sendHelp(chatID int64) {
 	helpText := `🤖 Telegram群组管理机器人
 
 管理员命令：
-/add_keyword <关键词> <匹配类型> <动作> - 添加关键词
+/add_keyword <关键词> <匹配类型> <动作> [时长] [选项] - 添加关键词
   匹配类型：exact(精确), fuzzy(模糊), regex(正则)
-  动作：mute(禁言), kick(踢出)
+  动作：delete(仅删除), warn(警告), mute(禁言), tempban(临时封禁), ban(永久封禁), kick(移出)
+  选项：时长(如 2h) keep(保留消息) silent(不通知管理员) purge(清除该用户近期消息)
   例：/add_keyword 违规词 fuzzy mute
+  例：/add_keyword 广告 fuzzy mute 2h purge
 
 /list_keywords - 查看所有关键词
 /delete_keyword <ID> - 删除关键词
 /violations [数量] - 查看违规记录 (默认10条)
+/warn [原因] - 回复消息，警告该用户
+/unwarn - 回复消息，撤销该用户最近一条警告
+/warns [用户ID] - 查看用户的警告记录
+/mute [时长] [原因] - 回复消息，禁言该用户（时长如 30m, 1h, 2d）
+/unmute [用户ID] - 解除禁言
+/tempban [时长] [原因] - 回复消息，临时封禁该用户
+/ban [原因] - 回复消息，永久封禁该用户
+/unban <用户ID> - 解除封禁
+/kick [原因] - 回复消息，移出该用户（可重新加入）
+/del - 回复消息，删除该消息
+/purge [分钟] - 回复消息，删除该用户最近一段时间的所有消息
+/gban [用户ID] [原因] - 全局封禁，在所有群组中生效
+/ungban <用户ID> - 解除全局封禁
+/lockdown [分钟] - 在群组中开启防护模式，新成员必须验证
+/unlock - 解除群组的防护模式
+/schedule - 查看本群组的定时消息
+/schedule in|at|every <时间> [-pin] [-replace] <内容> - 添加定时消息（时间如 30m、09:00、2024-01-01 09:00）
+/schedule delete <ID> - 删除定时消息
 /reload - 重新加载关键词
 /status - 查看机器人状态
 /help - 显示此帮助
@@ -417,17 +962,18 @@ func (tb *TelegramBot) sendHelp(chatID int64) {
 ✅ 检测链接内容
 ✅ 检测图片文件名和描述
 ✅ 自动禁言或踢出违规用户
+✅ 警告阶梯逐级处罚
 ✅ 记录违规日志`
 
 	msg := tgbotapi.NewMessage(chatID, helpText)
-	tb.bot.Send(msg)
+	tb.outbox.Post(msg)
 }
 
 func (tb *TelegramBot) handleAddKeyword(chatID int64, args string) {
 	parts := strings.Fields(args)
 	if len(parts) < 3 {
-		msg := tgbotapi.NewMessage(chatID, "❌ 用法：/add_keyword <关键词> <匹配类型> <动作>\n匹配类型：exact, fuzzy, regex\n动作：mute, kick")
-		tb.bot.Send(msg)
+		msg := tgbotapi.NewMessage(chatID, "❌ 用法：/add_keyword <关键词> <匹配类型> <动作> [时长] [选项]\n匹配类型：exact, fuzzy, regex\n动作："+strings.Join(keywordActions, ", ")+"\n选项：keep, silent, purge")
+		tb.outbox.Post(msg)
 		return
 	}
 
@@ -438,42 +984,104 @@ func (tb *TelegramBot) handleAddKeyword(chatID int64, args string) {
 	// 验证参数
 	if matchType != "exact" && matchType != "fuzzy" && matchType != "regex" {
 		msg := tgbotapi.NewMessage(chatID, "❌ 匹配类型必须是：exact, fuzzy, regex")
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
-	if action != "mute" && action != "kick" {
-		msg := tgbotapi.NewMessage(chatID, "❌ 动作必须是：mute, kick")
-		tb.bot.Send(msg)
+	if !isKeywordAction(action) {
+		msg := tgbotapi.NewMessage(chatID, "❌ 动作必须是："+strings.Join(keywordActions, ", "))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	k := &Keyword{
+		Keyword:       keyword,
+		MatchType:     matchType,
+		Action:        action,
+		DeleteMessage: true,
+		NotifyAdmin:   true,
+	}
+	if err := parseKeywordOptions(k, parts[3:]); err != nil {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err))
+		tb.outbox.Post(msg)
 		return
 	}
 
 	// 添加到数据库
-	err := tb.db.AddKeyword(keyword, matchType, action)
+	err := tb.db.AddKeyword(k)
 	if err != nil {
 		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 添加失败：%v", err))
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
 	// 重新加载关键词
 	tb.reloadKeywords()
 
-	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 关键词已添加\n关键词：%s\n匹配类型：%s\n动作：%s", keyword, matchType, action))
-	tb.bot.Send(msg)
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 关键词已添加\n关键词：%s\n匹配类型：%s\n动作：%s\n参数：%s", keyword, matchType, action, describeKeywordOptions(*k)))
+	tb.outbox.Post(msg)
+}
+
+// parseKeywordOptions 解析 /add_keyword 动作之后的时长和选项
+func parseKeywordOptions(k *Keyword, options []string) error {
+	for _, option := range options {
+		switch option {
+		case "keep":
+			k.DeleteMessage = false
+		case "silent":
+			k.NotifyAdmin = false
+		case "purge":
+			k.PurgeRecent = true
+		default:
+			duration, err := parseDuration(option)
+			if err != nil {
+				return fmt.Errorf("未知的选项: %s", option)
+			}
+			if !actionNeedsDuration(k.Action) {
+				return fmt.Errorf("动作 %s 不需要时长", k.Action)
+			}
+			k.Duration = int(duration.Seconds())
+		}
+	}
+	return nil
+}
+
+// describeKeywordOptions 关键词动作参数的说明文字
+func describeKeywordOptions(k Keyword) string {
+	var options []string
+	if actionNeedsDuration(k.Action) {
+		if k.Duration > 0 {
+			options = append(options, "时长 "+formatDuration(time.Duration(k.Duration)*time.Second))
+		} else {
+			options = append(options, "默认时长")
+		}
+	}
+	if !k.DeleteMessage {
+		options = append(options, "保留消息")
+	}
+	if !k.NotifyAdmin {
+		options = append(options, "不通知管理员")
+	}
+	if k.PurgeRecent {
+		options = append(options, "清除近期消息")
+	}
+	if len(options) == 0 {
+		return "默认"
+	}
+	return strings.Join(options, "，")
 }
 
 func (tb *TelegramBot) handleListKeywords(chatID int64) {
 	keywords, err := tb.db.GetKeywords()
 	if err != nil {
 		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 获取关键词失败：%v", err))
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
 	if len(keywords) == 0 {
 		msg := tgbotapi.NewMessage(chatID, "📝 暂无关键词")
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
@@ -485,32 +1093,33 @@ func (tb *TelegramBot) handleListKeywords(chatID int64) {
 		text.WriteString(fmt.Sprintf("关键词: %s\n", k.Keyword))
 		text.WriteString(fmt.Sprintf("匹配类型: %s\n", k.MatchType))
 		text.WriteString(fmt.Sprintf("动作: %s\n", k.Action))
+		text.WriteString(fmt.Sprintf("参数: %s\n", describeKeywordOptions(k)))
 		text.WriteString(fmt.Sprintf("创建时间: %s\n", k.CreatedAt.Format("2006-01-02 15:04:05")))
 		text.WriteString("─────────────\n")
 	}
 
 	msg := tgbotapi.NewMessage(chatID, text.String())
-	tb.bot.Send(msg)
+	tb.outbox.Post(msg)
 }
 
 func (tb *TelegramBot) handleDeleteKeyword(chatID int64, args string) {
 	if args == "" {
 		msg := tgbotapi.NewMessage(chatID, "❌ 用法：/delete_keyword <ID>")
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
 	id, err := strconv.Atoi(args)
 	if err != nil {
 		msg := tgbotapi.NewMessage(chatID, "❌ ID必须是数字")
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
 	err = tb.db.DeleteKeyword(id)
 	if err != nil {
 		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 删除失败：%v", err))
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
@@ -518,7 +1127,7 @@ func (tb *TelegramBot) handleDeleteKeyword(chatID int64, args string) {
 	tb.reloadKeywords()
 
 	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 关键词 ID %d 已删除", id))
-	tb.bot.Send(msg)
+	tb.outbox.Post(msg)
 }
 
 func (tb *TelegramBot) handleShowViolations(chatID int64, args string) {
@@ -532,13 +1141,13 @@ func (tb *TelegramBot) handleShowViolations(chatID int64, args string) {
 	violations, err := tb.db.GetViolations(limit)
 	if err != nil {
 		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 获取违规记录失败：%v", err))
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
 	if len(violations) == 0 {
 		msg := tgbotapi.NewMessage(chatID, "📋 暂无违规记录")
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
@@ -555,19 +1164,19 @@ func (tb *TelegramBot) handleShowViolations(chatID int64, args string) {
 	}
 
 	msg := tgbotapi.NewMessage(chatID, text.String())
-	tb.bot.Send(msg)
+	tb.outbox.Post(msg)
 }
 
 func (tb *TelegramBot) handleReload(chatID int64) {
 	err := tb.reloadKeywords()
 	if err != nil {
 		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 重新加载失败：%v", err))
-		tb.bot.Send(msg)
+		tb.outbox.Post(msg)
 		return
 	}
 
 	msg := tgbotapi.NewMessage(chatID, "✅ 关键词已重新加载")
-	tb.bot.Send(msg)
+	tb.outbox.Post(msg)
 }
 
 func (tb *TelegramBot) handleStatus(chatID int64) {
@@ -594,7 +1203,7 @@ func (tb *TelegramBot) handleStatus(chatID int64) {
 		tb.config.Settings.MuteDuration)
 
 	msg := tgbotapi.NewMessage(chatID, statusText)
-	tb.bot.Send(msg)
+	tb.outbox.Post(msg)
 }
 
 func (tb *TelegramBot) reloadKeywords() error {
@@ -608,6 +1217,11 @@ func (tb *TelegramBot) reloadKeywords() error {
 }
 
 func (tb *TelegramBot) handleViolation(message *tgbotapi.Message, result *FilterResult, messageText string) {
+	if message.From == nil {
+		tb.handleChannelViolation(message, result, messageText)
+		return
+	}
+
 	userID := message.From.ID
 	username := message.From.UserName
 	if username == "" {
@@ -615,30 +1229,51 @@ func (tb *TelegramBot) handleViolation(message *tgbotapi.Message, result *Filter
 	}
 	chatID := message.Chat.ID
 
+	rule := result.Rule
+
+	settings, err := tb.getGroupSettings(chatID)
+	if err != nil {
+		log.Printf("获取群组设置失败: %v", err)
+		settings = tb.config.DefaultGroupSettings(chatID)
+		settings.PurgeWindow = defaultPurgeWindow
+	}
+
+	// 删除违规消息，以及该用户近期发送的其他消息
+	if rule.DeleteMessage {
+		deleteMsg := tgbotapi.NewDeleteMessage(chatID, message.MessageID)
+		tb.outbox.Post(deleteMsg)
+	}
+	if rule.PurgeRecent {
+		tb.purgeRecentMessages(chatID, userID, time.Duration(settings.PurgeWindow)*time.Minute)
+	}
+
+	// 执行用户处理动作：启用警告阶梯时关键词违规由警告次数决定动作，
+	// 媒体和转发策略（Rule.ID 为 0）按策略中配置的动作处理
+	action := result.Action
+	if settings.WarningsEnabled && rule.ID != 0 {
+		action = ActionWarn
+	}
+
+	reason := fmt.Sprintf("触发关键词 %s", result.Keyword)
+	duration := time.Duration(rule.Duration) * time.Second
+	taken, err := tb.applyAction(chatID, message.From, action, duration, reason, 0)
+	if err != nil {
+		log.Printf("处理用户 %s (ID: %d) 失败：%v", username, userID, err)
+	} else if action == ActionWarn {
+		// 记录警告阶梯实际执行的动作
+		action = taken
+	}
+
 	// 记录违规
 	if tb.config.Settings.LogViolations {
-		err := tb.db.LogViolation(userID, username, chatID, messageText, result.Keyword, result.Action)
+		err := tb.db.LogViolation(userID, username, chatID, messageText, result.Keyword, action)
 		if err != nil {
 			log.Printf("记录违规失败：%v", err)
 		}
 	}
 
-	// 删除违规消息
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, message.MessageID)
-	tb.bot.Send(deleteMsg)
-
-	// 执行用户处理动作
-	switch result.Action {
-	case "mute":
-		tb.muteUser(chatID, userID)
-		log.Printf("用户 %s (ID: %d) 因关键词 '%s' 被禁言", username, userID, result.Keyword)
-	case "kick":
-		tb.kickUser(chatID, userID)
-		log.Printf("用户 %s (ID: %d) 因关键词 '%s' 被踢出", username, userID, result.Keyword)
-	}
-
 	// 发送通知给管理员
-	if tb.config.Telegram.AdminUserID != 0 {
+	if rule.NotifyAdmin && tb.config.Telegram.AdminUserID != 0 {
 		notificationText := fmt.Sprintf(`🚨 违规检测
 
 用户: %s (ID: %d)
@@ -649,54 +1284,32 @@ func (tb *TelegramBot) handleViolation(message *tgbotapi.Message, result *Filter
 			username, userID,
 			message.Chat.Title, chatID,
 			result.Keyword, result.MatchType,
-			result.Action,
+			action,
 			messageText)
 
-		notifyMsg := tgbotapi.NewMessage(tb.config.Telegram.AdminUserID, notificationText)
-		tb.bot.Send(notifyMsg)
-	}
-}
-
-func (tb *TelegramBot) muteUser(chatID, userID int64) {
-	until := time.Now().Add(time.Duration(tb.config.Settings.MuteDuration) * time.Second)
-
-	restrictConfig := tgbotapi.ChatMemberConfig{
-		ChatID: chatID,
-		UserID: userID,
-	}
-
-	restrictChatMember := tgbotapi.RestrictChatMemberConfig{
-		ChatMemberConfig: restrictConfig,
-		UntilDate:        until.Unix(),
-		Permissions: &tgbotapi.ChatPermissions{
-			CanSendMessages:       false,
-			CanSendMediaMessages:  false,
-			CanSendPolls:          false,
-			CanSendOtherMessages:  false,
-			CanAddWebPagePreviews: false,
-			CanChangeInfo:         false,
-			CanInviteUsers:        false,
-			CanPinMessages:        false,
-		},
-	}
-
-	_, err := tb.bot.Request(restrictChatMember)
-	if err != nil {
-		log.Printf("禁言用户失败：%v", err)
-	}
-}
-
-func (tb *TelegramBot) kickUser(chatID, userID int64) {
-	kickConfig := tgbotapi.KickChatMemberConfig{
-		ChatMemberConfig: tgbotapi.ChatMemberConfig{
-			ChatID: chatID,
-			UserID: userID,
-		},
-	}
+		// 误判时可以一键撤销、加入白名单或停用关键词，确认违规时可以升级为封禁
+		undoRow := []callbackButton{
+			actionButton("↩️ 撤销处理", callbackUndo, chatID, userID, 0),
+			actionButton("⛔ 升级为封禁", ActionBan, chatID, userID, 0),
+		}
+		allowRow := []callbackButton{
+			actionButton("✅ 加入白名单", callbackAllow, chatID, userID, 0),
+		}
+		// 媒体策略等不是由关键词触发的违规没有可停用的关键词
+		if rule.ID != 0 {
+			allowRow = append(allowRow, callbackButton{Text: "🔕 停用关键词", Payload: CallbackPayload{
+				Action:   callbackDisableKeyword,
+				ChatID:   chatID,
+				UserID:   userID,
+				RecordID: rule.ID,
+			}})
+		}
 
-	_, err := tb.bot.Request(kickConfig)
-	if err != nil {
-		log.Printf("踢出用户失败：%v", err)
+		notifyMsg := tgbotapi.NewMessage(tb.config.Telegram.AdminUserID, notificationText)
+		if keyboard, ok := tb.callbackKeyboard(undoRow, allowRow); ok {
+			notifyMsg.ReplyMarkup = keyboard
+		}
+		tb.outbox.Post(notifyMsg)
 	}
 }
 
@@ -704,7 +1317,7 @@ func (tb *TelegramBot) kickUser(chatID, userID int64) {
 func (tb *TelegramBot) handleListMessages(chatID int64) {
 	// 获取当前最新消息的ID
 	msg := tgbotapi.NewMessage(chatID, "正在获取最近消息...")
-	sentMsg, err := tb.bot.Send(msg)
+	sentMsg, err := tb.outbox.Send(msg)
 	if err != nil {
 		log.Printf("发送消息失败：%v", err)
 		return
@@ -718,20 +1331,25 @@ func (tb *TelegramBot) handleListMessages(chatID int64) {
 
 	// 删除提示消息
 	deleteMsg := tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID)
-	tb.bot.Request(deleteMsg)
+	tb.outbox.Post(deleteMsg)
 
 	// 发送消息列表
 	for i := startID; i < sentMsg.MessageID; i++ {
 		// 尝试获取消息
 		copyMsg := tgbotapi.NewCopyMessage(chatID, chatID, i)
-		copiedMsg, err := tb.bot.CopyMessage(copyMsg)
+		var copiedMsg tgbotapi.MessageID
+		err := tb.outbox.Do(chatID, PriorityNormal, "CopyMessageConfig", func() error {
+			var err error
+			copiedMsg, err = tb.bot.CopyMessage(copyMsg)
+			return err
+		})
 		if err != nil {
 			continue
 		}
 
 		// 获取原始消息
 		fwdMsg := tgbotapi.NewForward(chatID, chatID, i)
-		forwardedMsg, err := tb.bot.Send(fwdMsg)
+		forwardedMsg, err := tb.outbox.Send(fwdMsg)
 		if err != nil {
 			continue
 		}
@@ -739,29 +1357,28 @@ func (tb *TelegramBot) handleListMessages(chatID int64) {
 		// 如果消息有文本内容
 		if forwardedMsg.Text != "" {
 			// 创建操作按钮
-			var keyboard [][]tgbotapi.InlineKeyboardButton
-			muteButton := tgbotapi.NewInlineKeyboardButtonData("禁言用户", fmt.Sprintf("mute_%d", forwardedMsg.From.ID))
-			kickButton := tgbotapi.NewInlineKeyboardButtonData("踢出用户", fmt.Sprintf("kick_%d", forwardedMsg.From.ID))
-			row := []tgbotapi.InlineKeyboardButton{muteButton, kickButton}
-			keyboard = append(keyboard, row)
+			keyboard, hasKeyboard := tb.callbackKeyboard([]callbackButton{
+				actionButton("禁言用户", ActionMute, chatID, forwardedMsg.From.ID, 0),
+				actionButton("踢出用户", ActionKick, chatID, forwardedMsg.From.ID, 0),
+			})
 
 			// 发送消息和按钮
 			text := fmt.Sprintf("用户: %s (@%s)\n内容: %s",
 				forwardedMsg.From.FirstName, forwardedMsg.From.UserName, forwardedMsg.Text)
 
 			msgConfig := tgbotapi.NewMessage(chatID, text)
-			msgConfig.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
-				InlineKeyboard: keyboard,
+			if hasKeyboard {
+				msgConfig.ReplyMarkup = keyboard
 			}
-			tb.bot.Send(msgConfig)
+			tb.outbox.Post(msgConfig)
 
 			// 删除转发的消息
 			deleteMsg := tgbotapi.NewDeleteMessage(chatID, forwardedMsg.MessageID)
-			tb.bot.Request(deleteMsg)
+			tb.outbox.Post(deleteMsg)
 
 			// 删除复制的消息
 			deleteMsg = tgbotapi.NewDeleteMessage(chatID, copiedMsg.MessageID)
-			tb.bot.Request(deleteMsg)
+			tb.outbox.Post(deleteMsg)
 
 			// 短暂延迟，避免触发限制
 			time.Sleep(100 * time.Millisecond)
@@ -769,69 +1386,13 @@ func (tb *TelegramBot) handleListMessages(chatID int64) {
 	}
 }
 
-// 处理按钮回调
+// 处理按钮回调，回调数据为 s: 加签名的操作（见 encodeCallback），包括申诉和举报按钮
 func (tb *TelegramBot) handleCallback(callback *tgbotapi.CallbackQuery) {
-	// 解析回调数据
-	parts := strings.Split(callback.Data, "_")
-	if len(parts) != 2 {
+	if strings.HasPrefix(callback.Data, signedCallbackPrefix) {
+		tb.handleActionCallback(callback)
 		return
 	}
 
-	action := parts[0]
-	userID, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil {
-		return
-	}
-
-	// 执行操作
-	switch action {
-	case "mute":
-		// 禁言用户
-		restrictConfig := tgbotapi.RestrictChatMemberConfig{
-			ChatMemberConfig: tgbotapi.ChatMemberConfig{
-				ChatID: callback.Message.Chat.ID,
-				UserID: userID,
-			},
-			UntilDate: time.Now().Add(24 * time.Hour).Unix(), // 禁言24小时
-			Permissions: &tgbotapi.ChatPermissions{
-				CanSendMessages:       false,
-				CanSendMediaMessages:  false,
-				CanSendPolls:          false,
-				CanSendOtherMessages:  false,
-				CanAddWebPagePreviews: false,
-				CanChangeInfo:         false,
-				CanInviteUsers:        false,
-				CanPinMessages:        false,
-			},
-		}
-		tb.bot.Request(restrictConfig)
-
-		// 更新按钮消息
-		text := callback.Message.Text + "\n✅ 已禁言用户"
-		edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
-		tb.bot.Send(edit)
-
-		// 发送回调响应
-		callbackCfg := tgbotapi.NewCallback(callback.ID, "已禁言用户")
-		tb.bot.Request(callbackCfg)
-
-	case "kick":
-		// 踢出用户
-		kickConfig := tgbotapi.KickChatMemberConfig{
-			ChatMemberConfig: tgbotapi.ChatMemberConfig{
-				ChatID: callback.Message.Chat.ID,
-				UserID: userID,
-			},
-		}
-		tb.bot.Request(kickConfig)
-
-		// 更新按钮消息
-		text := callback.Message.Text + "\n✅ 已踢出用户"
-		edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
-		tb.bot.Send(edit)
-
-		// 发送回调响应
-		callbackCfg := tgbotapi.NewCallback(callback.ID, "已踢出用户")
-		tb.bot.Request(callbackCfg)
-	}
+	// 旧格式的按钮不带群组信息和签名，不再执行
+	tb.outbox.Post(tgbotapi.NewCallback(callback.ID, errCallbackExpired.Error()))
 }
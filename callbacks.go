@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 签名回调数据的前缀，以区分旧格式的按钮
+const signedCallbackPrefix = "s:"
+
+// callbackTTL 按钮的有效期
+const callbackTTL = 24 * time.Hour
+
+// callbackSignatureSize 签名截取的字节数，callback_data 最长 64 字节
+const callbackSignatureSize = 8
+
+// 只能通过按钮执行的动作
+const (
+	callbackUndo           = "undo"            // 撤销对用户的处理
+	callbackAllow          = "allow"           // 将用户加入群组白名单
+	callbackDisableKeyword = "disable_keyword" // 停用触发的关键词
+	callbackUnlock         = "unlock"          // 解除群组的防护模式
+	callbackAppealApprove  = "appeal_approve"  // 通过申诉
+	callbackAppealReject   = "appeal_reject"   // 驳回申诉
+	callbackReportPrefix   = "report_"         // 处理举报，后接举报的处理动作
+)
+
+// callbackActionCodes 动作在回调数据中的编码，只能追加，不能修改已有编号
+var callbackActionCodes = []string{
+	ActionDelete, ActionWarn, ActionMute, ActionUnmute, ActionTempBan, ActionBan, ActionUnban, ActionKick,
+	callbackUndo, callbackAllow, callbackDisableKeyword, callbackUnlock,
+	callbackAppealApprove, callbackAppealReject,
+	callbackReportPrefix + ActionDelete, callbackReportPrefix + ActionWarn, callbackReportPrefix + ActionMute,
+	callbackReportPrefix + ActionBan, callbackReportPrefix + reportDismiss,
+}
+
+var (
+	errCallbackInvalid = errors.New("无效的按钮")
+	errCallbackExpired = errors.New("按钮已过期")
+)
+
+// CallbackPayload 按钮携带的操作：对哪个群组中的哪个用户（和消息）执行什么动作
+type CallbackPayload struct {
+	Action    string
+	ChatID    int64
+	UserID    int64
+	MessageID int // 可选，执行时一并删除的消息
+	RecordID  int // 可选，停用关键词时的关键词ID，处理申诉或举报时的申诉或举报ID
+	Expiry    time.Time
+}
+
+// callbackKey 签名密钥，未配置 callback_secret 时由 bot_token 派生
+func (tb *TelegramBot) callbackKey() []byte {
+	secret := tb.config.Telegram.CallbackSecret
+	if secret == "" {
+		secret = tb.config.Telegram.BotToken
+	}
+	key := sha256.Sum256([]byte("callback:" + secret))
+	return key[:]
+}
+
+func (tb *TelegramBot) signCallback(body []byte) []byte {
+	mac := hmac.New(sha256.New, tb.callbackKey())
+	mac.Write(body)
+	return mac.Sum(nil)[:callbackSignatureSize]
+}
+
+// encodeCallback 生成签名的回调数据，动作不在 callbackActionCodes 中时返回错误
+func (tb *TelegramBot) encodeCallback(p CallbackPayload) (string, error) {
+	code := -1
+	for i, action := range callbackActionCodes {
+		if action == p.Action {
+			code = i
+		}
+	}
+	if code < 0 {
+		return "", fmt.Errorf("按钮不支持的动作：%s", p.Action)
+	}
+
+	if p.Expiry.IsZero() {
+		p.Expiry = time.Now().Add(callbackTTL)
+	}
+
+	body := []byte{byte(code)}
+	body = binary.AppendVarint(body, p.ChatID)
+	body = binary.AppendUvarint(body, uint64(p.UserID))
+	body = binary.AppendUvarint(body, uint64(p.MessageID))
+	body = binary.AppendUvarint(body, uint64(p.Expiry.Unix()))
+	if p.RecordID != 0 {
+		body = binary.AppendUvarint(body, uint64(p.RecordID))
+	}
+
+	data := append(body, tb.signCallback(body)...)
+	return signedCallbackPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCallback 校验签名和有效期，返回按钮携带的操作
+func (tb *TelegramBot) decodeCallback(data string) (*CallbackPayload, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(data, signedCallbackPrefix))
+	if err != nil || len(raw) <= callbackSignatureSize+1 {
+		return nil, errCallbackInvalid
+	}
+
+	body, signature := raw[:len(raw)-callbackSignatureSize], raw[len(raw)-callbackSignatureSize:]
+	if !hmac.Equal(signature, tb.signCallback(body)) {
+		return nil, errCallbackInvalid
+	}
+
+	if int(body[0]) >= len(callbackActionCodes) {
+		return nil, errCallbackInvalid
+	}
+	p := &CallbackPayload{Action: callbackActionCodes[body[0]]}
+
+	reader := bytes.NewReader(body[1:])
+	chatID, err1 := binary.ReadVarint(reader)
+	userID, err2 := binary.ReadUvarint(reader)
+	messageID, err3 := binary.ReadUvarint(reader)
+	expiry, err4 := binary.ReadUvarint(reader)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return nil, errCallbackInvalid
+	}
+	if reader.Len() > 0 {
+		recordID, err := binary.ReadUvarint(reader)
+		if err != nil || reader.Len() != 0 {
+			return nil, errCallbackInvalid
+		}
+		p.RecordID = int(recordID)
+	}
+
+	p.ChatID = chatID
+	p.UserID = int64(userID)
+	p.MessageID = int(messageID)
+	p.Expiry = time.Unix(int64(expiry), 0)
+
+	if time.Now().After(p.Expiry) {
+		return nil, errCallbackExpired
+	}
+	return p, nil
+}
+
+// callbackButton 签名按钮的文字和携带的操作
+type callbackButton struct {
+	Text    string
+	Payload CallbackPayload
+}
+
+// actionButton 执行处理动作的按钮
+func actionButton(text, action string, chatID, userID int64, messageID int) callbackButton {
+	return callbackButton{Text: text, Payload: CallbackPayload{
+		Action:    action,
+		ChatID:    chatID,
+		UserID:    userID,
+		MessageID: messageID,
+	}}
+}
+
+// callbackKeyboard 生成签名按钮组成的键盘，无法生成的按钮记录日志后跳过；没有可用的按钮时返回 false
+func (tb *TelegramBot) callbackKeyboard(rows ...[]callbackButton) (tgbotapi.InlineKeyboardMarkup, bool) {
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, row := range rows {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, button := range row {
+			data, err := tb.encodeCallback(button.Payload)
+			if err != nil {
+				log.Printf("❌ 生成按钮「%s」失败：%v", button.Text, err)
+				continue
+			}
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(button.Text, data))
+		}
+		if len(buttons) > 0 {
+			keyboard = append(keyboard, buttons)
+		}
+	}
+	if len(keyboard) == 0 {
+		return tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...), true
+}
+
+// canModerate 用户是否有权在群组中执行处理动作：配置的管理员，或群主和有限制成员权限的管理员
+func (tb *TelegramBot) canModerate(chatID, userID int64) bool {
+	if userID == tb.config.Telegram.AdminUserID {
+		return true
+	}
+
+	member, err := tb.getChatMember(chatID, userID)
+	if err != nil {
+		log.Printf("获取用户 %d 在群组 %d 的权限失败：%v", userID, chatID, err)
+		return false
+	}
+
+	return member.IsCreator() || (member.IsAdministrator() && member.CanRestrictMembers)
+}
+
+// lookupUser 查询用户的资料，使警告通知和白名单中显示名字而不是用户ID；查询失败时名字使用用户ID
+func (tb *TelegramBot) lookupUser(chatID, userID int64) *tgbotapi.User {
+	member, err := tb.getChatMember(chatID, userID)
+	if err != nil || member.User == nil {
+		if err != nil {
+			log.Printf("获取用户 %d 的资料失败：%v", userID, err)
+		}
+		return &tgbotapi.User{ID: userID, FirstName: fmt.Sprint(userID)}
+	}
+	return member.User
+}
+
+// handleActionCallback 处理签名的动作按钮
+func (tb *TelegramBot) handleActionCallback(callback *tgbotapi.CallbackQuery) {
+	payload, err := tb.decodeCallback(callback.Data)
+	if err != nil {
+		tb.outbox.Post(tgbotapi.NewCallback(callback.ID, err.Error()))
+		return
+	}
+
+	// 申诉和举报只能由配置的管理员处理，处理后的消息格式也不同
+	switch {
+	case payload.Action == callbackAppealApprove || payload.Action == callbackAppealReject:
+		tb.handleAppealCallback(callback, payload)
+		return
+	case strings.HasPrefix(payload.Action, callbackReportPrefix):
+		tb.handleReportCallback(callback, payload)
+		return
+	}
+
+	if !tb.canModerate(payload.ChatID, callback.From.ID) {
+		log.Printf("用户 %d 无权在群组 %d 执行 %s", callback.From.ID, payload.ChatID, payload.Action)
+		tb.outbox.Post(tgbotapi.NewCallback(callback.ID, "你没有权限执行此操作"))
+		return
+	}
+
+	if payload.Action == callbackDisableKeyword && callback.From.ID != tb.config.Telegram.AdminUserID {
+		tb.outbox.Post(tgbotapi.NewCallback(callback.ID, "只有管理员可以停用关键词"))
+		return
+	}
+
+	var description string
+	switch payload.Action {
+	case callbackUndo:
+		description, err = tb.undoAction(payload.ChatID, payload.UserID)
+	case callbackAllow:
+		description, err = tb.allowUser(payload.ChatID, tb.lookupUser(payload.ChatID, payload.UserID), callback.From.ID)
+	case callbackDisableKeyword:
+		description, err = tb.disableKeyword(payload.RecordID)
+	case callbackUnlock:
+		description = "解除防护模式"
+		if !tb.endLockdown(payload.ChatID) {
+			err = fmt.Errorf("群组未处于防护模式")
+		}
+	default:
+		// 删除相关消息（解除类动作除外）
+		if payload.MessageID != 0 && payload.Action != ActionUnmute && payload.Action != ActionUnban {
+			tb.deleteMessages(payload.ChatID, []int{payload.MessageID})
+		}
+		user := tb.lookupUser(payload.ChatID, payload.UserID)
+		description, err = tb.applyAction(payload.ChatID, user, payload.Action, 0, "管理员按钮操作", callback.From.ID)
+	}
+	if err != nil {
+		tb.outbox.Post(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("操作失败：%v", err)))
+		return
+	}
+
+	// 在按钮消息上注明操作人，保留按钮以便继续处理（如误判后撤销）
+	if callback.Message != nil {
+		text := fmt.Sprintf("%s\n✅ %s 已%s", callback.Message.Text, displayName(callback.From), description)
+		edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
+		edit.ReplyMarkup = callback.Message.ReplyMarkup
+		tb.outbox.Post(edit)
+	}
+
+	tb.outbox.Post(tgbotapi.NewCallback(callback.ID, "已"+description))
+}
+
+// undoAction 撤销对用户的处理：按用户当前状态解除封禁或禁言，启用警告阶梯时同时撤销最近一条警告
+func (tb *TelegramBot) undoAction(chatID, userID int64) (string, error) {
+	member, err := tb.getChatMember(chatID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var undone []string
+	switch member.Status {
+	case "kicked":
+		if err := tb.unbanUser(chatID, userID); err != nil {
+			return "", err
+		}
+		undone = append(undone, "解除封禁")
+	case "restricted":
+		if err := tb.unmuteUser(chatID, userID); err != nil {
+			return "", err
+		}
+		undone = append(undone, "解除禁言")
+	}
+
+	if settings, err := tb.getGroupSettings(chatID); err == nil && settings.WarningsEnabled {
+		if removed, err := tb.db.RemoveLatestWarning(chatID, userID); err != nil {
+			return "", err
+		} else if removed {
+			undone = append(undone, "撤销警告")
+		}
+	}
+
+	if len(undone) == 0 {
+		return "撤销（用户当前没有受到处理）", nil
+	}
+
+	log.Printf("用户 %d 在群组 %d 的处理已撤销：%s", userID, chatID, strings.Join(undone, "、"))
+	return strings.Join(undone, "、"), nil
+}
+
+// allowUser 将用户加入群组白名单，之后不再检查该用户的消息
+func (tb *TelegramBot) allowUser(chatID int64, user *tgbotapi.User, addedBy int64) (string, error) {
+	err := tb.db.AddToAllowlist(&AllowlistEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		Username: displayName(user),
+		AddedBy:  addedBy,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("用户 %d 已加入群组 %d 的白名单", user.ID, chatID)
+	return "加入白名单", nil
+}
+
+// disableKeyword 停用关键词并重新加载
+func (tb *TelegramBot) disableKeyword(id int) (string, error) {
+	if id == 0 {
+		return "", fmt.Errorf("该违规不是由关键词触发的")
+	}
+
+	if err := tb.db.DeleteKeyword(id); err != nil {
+		return "", err
+	}
+	if err := tb.reloadKeywords(); err != nil {
+		return "", err
+	}
+
+	log.Printf("关键词 #%d 已停用", id)
+	return fmt.Sprintf("停用关键词 #%d", id), nil
+}
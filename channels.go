@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleChannelPost 处理机器人管理的频道中的新消息，违规时删除
+func (tb *TelegramBot) handleChannelPost(message *tgbotapi.Message) {
+	tb.recordMessage(message)
+
+	text := messageText(message)
+	if text == "" {
+		return
+	}
+
+	result := tb.filter.CheckMessage(text)
+	if result.IsViolation {
+		tb.handleViolation(message, result, text)
+	}
+}
+
+// handleChannelViolation 处理频道消息的违规，频道消息没有可以处理的用户，只删除消息并通知管理员
+func (tb *TelegramBot) handleChannelViolation(message *tgbotapi.Message, result *FilterResult, messageText string) {
+	chatID := message.Chat.ID
+	senderID, senderName := messageSender(message)
+	rule := result.Rule
+
+	action := "none"
+	if rule.DeleteMessage {
+		if _, err := tb.outbox.Request(tgbotapi.NewDeleteMessage(chatID, message.MessageID)); err != nil {
+			log.Printf("删除频道 %d 的消息 %d 失败：%v", chatID, message.MessageID, err)
+		} else {
+			action = ActionDelete
+		}
+	}
+
+	if tb.config.Settings.LogViolations {
+		if err := tb.db.LogViolation(senderID, senderName, chatID, messageText, result.Keyword, action); err != nil {
+			log.Printf("记录违规失败：%v", err)
+		}
+	}
+
+	if rule.NotifyAdmin && tb.config.Telegram.AdminUserID != 0 {
+		notificationText := fmt.Sprintf(`🚨 违规检测（频道）
+
+频道: %s (ID: %d)
+触发关键词: %s (%s匹配)
+执行动作: %s
+违规内容: %s`,
+			message.Chat.Title, chatID,
+			result.Keyword, result.MatchType,
+			action,
+			messageText)
+
+		notifyMsg := tgbotapi.NewMessage(tb.config.Telegram.AdminUserID, notificationText)
+		if keyboard, ok := tb.callbackKeyboard([]callbackButton{{Text: "🔕 停用关键词", Payload: CallbackPayload{
+			Action:   callbackDisableKeyword,
+			ChatID:   chatID,
+			RecordID: rule.ID,
+		}}}); ok {
+			notifyMsg.ReplyMarkup = keyboard
+		}
+		tb.outbox.Post(notifyMsg)
+	}
+}
@@ -9,8 +9,10 @@ import (
 
 type Config struct {
 	Telegram struct {
-		BotToken    string `yaml:"bot_token"`
-		AdminUserID int64  `yaml:"admin_user_id"`
+		BotToken       string `yaml:"bot_token"`
+		AdminUserID    int64  `yaml:"admin_user_id"`
+		CallbackSecret string `yaml:"callback_secret"` // 按钮签名密钥，为空时由 bot_token 派生
+		APIEndpoint    string `yaml:"api_endpoint"`    // Bot API 地址，为空时使用官方地址，格式同 https://api.telegram.org/bot%s/%s
 	} `yaml:"telegram"`
 	Database struct {
 		Path string `yaml:"path"`
@@ -26,17 +28,86 @@ type Config struct {
 	Settings struct {
 		DefaultAction string `yaml:"default_action"`
 		MuteDuration  int    `yaml:"mute_duration"`
+		BanDuration   int    `yaml:"ban_duration"` // 临时封禁时长（秒）
 		LogViolations bool   `yaml:"log_violations"`
+		ReportLimit   int    `yaml:"report_limit"` // 每个用户每小时最多举报次数
 	} `yaml:"settings"`
+	RateLimit struct {
+		GlobalPerSecond int `yaml:"global_per_second"` // 全局每秒最多请求数
+		ChatPerMinute   int `yaml:"chat_per_minute"`   // 每个聊天每分钟最多发送的普通消息数
+		Workers         int `yaml:"workers"`           // 同时发送的请求数
+		MaxRetries      int `yaml:"max_retries"`       // 临时错误的最多重试次数
+	} `yaml:"rate_limit"`
+	Updates struct {
+		Workers   int `yaml:"workers"`    // 并发处理更新的 worker 数，同一聊天的更新总由同一个 worker 按顺序处理
+		QueueSize int `yaml:"queue_size"` // 每个 worker 最多排队的更新数，队满时暂停拉取
+	} `yaml:"updates"`
+	Webhook struct {
+		Enabled        bool   `yaml:"enabled"`         // 使用 webhook 接收更新，设置失败时回退到长轮询
+		URL            string `yaml:"url"`             // Telegram 推送更新的 https 地址，路径即接收更新的路径
+		SecretToken    string `yaml:"secret_token"`    // 校验推送请求的密钥，为空时由 bot_token 派生
+		Listen         string `yaml:"listen"`          // 独立的监听地址，如 :8443；为空时使用 Web 管理界面的端口
+		CertFile       string `yaml:"cert_file"`       // 独立监听时的 TLS 证书，为空时使用 HTTP（由反向代理提供 https）
+		KeyFile        string `yaml:"key_file"`        // TLS 私钥
+		MaxConnections int    `yaml:"max_connections"` // Telegram 同时推送的最大连接数，0 使用默认值 40
+	} `yaml:"webhook"`
 	Groups struct {
 		DefaultSettings struct {
-			WelcomeMessage string `yaml:"welcome_message"`
-			Verification   struct {
+			WelcomeMessage        string `yaml:"welcome_message"`
+			WelcomeParseMode      string `yaml:"welcome_parse_mode"` // 空, HTML 或 MarkdownV2
+			WelcomeMedia          string `yaml:"welcome_media"`      // file_id 或 URL
+			WelcomeMediaType      string `yaml:"welcome_media_type"` // photo, video, animation
+			CleanupDelay          int    `yaml:"cleanup_delay"`
+			DeleteServiceMessages bool   `yaml:"delete_service_messages"`
+			PurgeWindow           int    `yaml:"purge_window"` // 清除违规用户近期消息时回溯的分钟数
+			Verification          struct {
 				Enabled  bool   `yaml:"enabled"`
 				Question string `yaml:"question"`
 				Answer   string `yaml:"answer"`
 				Timeout  int    `yaml:"timeout"`
+				Mode     string `yaml:"mode"` // group 或 private
 			} `yaml:"verification"`
+			Warnings struct {
+				Enabled bool   `yaml:"enabled"`
+				Expiry  int    `yaml:"expiry"` // 警告有效期（秒）
+				Ladder  string `yaml:"ladder"` // 第 N 次警告对应的处理动作
+			} `yaml:"warnings"`
+			Raid struct {
+				Enabled      bool `yaml:"enabled"`
+				Threshold    int  `yaml:"threshold"`     // window 秒内加入多少人视为突袭
+				Window       int  `yaml:"window"`        // 统计加入人数的时间（秒）
+				Lockdown     int  `yaml:"lockdown"`      // 锁定持续时间（分钟）
+				RestrictChat bool `yaml:"restrict_chat"` // 锁定期间全体成员只能发送文字
+			} `yaml:"raid"`
+			Screening struct {
+				Enabled       bool   `yaml:"enabled"`
+				Threshold     int    `yaml:"threshold"`      // 可疑分数达到多少时处理
+				Action        string `yaml:"action"`         // ban, captcha 或 restrict
+				RestrictHours int    `yaml:"restrict_hours"` // restrict 时只能发送文字的小时数
+				NewAccountID  int64  `yaml:"new_account_id"` // 用户 ID 大于此值视为新注册的账号
+			} `yaml:"screening"`
+			Probation struct {
+				Enabled  bool `yaml:"enabled"`
+				Duration int  `yaml:"duration"` // 观察期时长（分钟）
+				Messages int  `yaml:"messages"` // 发送多少条正常消息后提前结束观察期
+			} `yaml:"probation"`
+			NightMode struct {
+				Enabled  bool   `yaml:"enabled"`
+				Start    string `yaml:"start"`    // 开始时间 HH:MM
+				End      string `yaml:"end"`      // 结束时间 HH:MM
+				Days     string `yaml:"days"`     // 生效的星期，与 cron 相同：0-6，0 为周日
+				Timezone string `yaml:"timezone"` // 如 Asia/Shanghai
+				Profile  string `yaml:"profile"`  // readonly 或 text_only
+			} `yaml:"night_mode"`
+			MediaPolicy       string `yaml:"media_policy"`       // 各类内容的处理动作，如 sticker:delete,voice:mute:1h
+			DocumentBlocklist string `yaml:"document_blocklist"` // 屏蔽的文件扩展名和 MIME 类型
+			Forward           struct {
+				ChannelPolicy    string `yaml:"channel_policy"`    // 空表示允许，block 禁止所有频道，allowlist 只允许列表中的频道
+				ChannelAllowlist string `yaml:"channel_allowlist"` // 允许转发的频道ID或用户名
+				Blocklist        string `yaml:"blocklist"`         // 禁止转发的用户、机器人或频道
+				BlockHidden      bool   `yaml:"block_hidden"`      // 禁止转发隐藏了账号的用户的消息
+				Action           string `yaml:"action"`            // 如 delete 或 mute:1h
+			} `yaml:"forward"`
 		} `yaml:"default_settings"`
 	} `yaml:"groups"`
 }
@@ -71,3 +142,52 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// DefaultGroupSettings 根据配置文件生成群组的默认设置
+func (c *Config) DefaultGroupSettings(chatID int64) *GroupSettings {
+	defaults := c.Groups.DefaultSettings
+	return &GroupSettings{
+		ChatID:                  chatID,
+		WelcomeMessage:          defaults.WelcomeMessage,
+		WelcomeParseMode:        defaults.WelcomeParseMode,
+		WelcomeMedia:            defaults.WelcomeMedia,
+		WelcomeMediaType:        defaults.WelcomeMediaType,
+		VerificationEnabled:     defaults.Verification.Enabled,
+		Question:                defaults.Verification.Question,
+		Answer:                  defaults.Verification.Answer,
+		Timeout:                 defaults.Verification.Timeout,
+		VerificationMode:        defaults.Verification.Mode,
+		CleanupDelay:            defaults.CleanupDelay,
+		DeleteServiceMessages:   defaults.DeleteServiceMessages,
+		PurgeWindow:             defaults.PurgeWindow,
+		WarningsEnabled:         defaults.Warnings.Enabled,
+		WarningLadder:           defaults.Warnings.Ladder,
+		WarningExpiry:           defaults.Warnings.Expiry,
+		RaidEnabled:             defaults.Raid.Enabled,
+		RaidThreshold:           defaults.Raid.Threshold,
+		RaidWindow:              defaults.Raid.Window,
+		RaidLockdown:            defaults.Raid.Lockdown,
+		RaidRestrictChat:        defaults.Raid.RestrictChat,
+		ScreeningEnabled:        defaults.Screening.Enabled,
+		ScreeningThreshold:      defaults.Screening.Threshold,
+		ScreeningAction:         defaults.Screening.Action,
+		ScreeningRestrictHours:  defaults.Screening.RestrictHours,
+		ScreeningNewAccountID:   defaults.Screening.NewAccountID,
+		ProbationEnabled:        defaults.Probation.Enabled,
+		ProbationDuration:       defaults.Probation.Duration,
+		ProbationMessages:       defaults.Probation.Messages,
+		NightModeEnabled:        defaults.NightMode.Enabled,
+		NightModeStart:          defaults.NightMode.Start,
+		NightModeEnd:            defaults.NightMode.End,
+		NightModeDays:           defaults.NightMode.Days,
+		NightModeTimezone:       defaults.NightMode.Timezone,
+		NightModeProfile:        defaults.NightMode.Profile,
+		MediaPolicy:             defaults.MediaPolicy,
+		DocumentBlocklist:       defaults.DocumentBlocklist,
+		ForwardChannelPolicy:    defaults.Forward.ChannelPolicy,
+		ForwardChannelAllowlist: defaults.Forward.ChannelAllowlist,
+		ForwardBlocklist:        defaults.Forward.Blocklist,
+		ForwardBlockHidden:      defaults.Forward.BlockHidden,
+		ForwardAction:           defaults.Forward.Action,
+	}
+}
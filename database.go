@@ -14,12 +14,16 @@ type Database struct {
 }
 
 type Keyword struct {
-	ID        int       `json:"id"`
-	Keyword   string    `json:"keyword"`
-	MatchType string    `json:"match_type"` // exact, fuzzy, regex
-	Action    string    `json:"action"`     // mute, kick
-	CreatedAt time.Time `json:"created_at"`
-	IsActive  bool      `json:"is_active"`
+	ID            int       `json:"id"`
+	Keyword       string    `json:"keyword"`
+	MatchType     string    `json:"match_type"`     // exact, fuzzy, regex
+	Action        string    `json:"action"`         // delete, warn, mute, tempban, ban, kick
+	Duration      int       `json:"duration"`       // 禁言/临时封禁时长（秒），0 表示使用全局设置
+	DeleteMessage bool      `json:"delete_message"` // 是否删除触发的消息
+	NotifyAdmin   bool      `json:"notify_admin"`   // 是否通知管理员
+	PurgeRecent   bool      `json:"purge_recent"`   // 是否同时删除该用户最近的消息
+	CreatedAt     time.Time `json:"created_at"`
+	IsActive      bool      `json:"is_active"`
 }
 
 type Violation struct {
@@ -33,220 +37,1550 @@ type Violation struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
-type GroupSettings struct {
-	ChatID              int64     `json:"chat_id"`
-	WelcomeMessage      string    `json:"welcome_message"`
-	VerificationEnabled bool      `json:"verification_enabled"`
-	Question            string    `json:"question"`
-	Answer              string    `json:"answer"`
-	Timeout             int       `json:"timeout"`
-	UpdatedAt           time.Time `json:"updated_at"`
+type GroupSettings struct {
+	ChatID                  int64     `json:"chat_id"`
+	WelcomeMessage          string    `json:"welcome_message"`
+	WelcomeParseMode        string    `json:"welcome_parse_mode"` // 空, HTML, MarkdownV2
+	WelcomeMedia            string    `json:"welcome_media"`      // file_id 或 URL
+	WelcomeMediaType        string    `json:"welcome_media_type"` // photo, video, animation
+	VerificationEnabled     bool      `json:"verification_enabled"`
+	Question                string    `json:"question"`
+	Answer                  string    `json:"answer"`
+	Timeout                 int       `json:"timeout"`
+	VerificationMode        string    `json:"verification_mode"` // group, private
+	CleanupDelay            int       `json:"cleanup_delay"`     // 欢迎消息自动删除延迟（秒），0 表示不删除
+	DeleteServiceMessages   bool      `json:"delete_service_messages"`
+	PurgeWindow             int       `json:"purge_window"` // 清除近期消息时回溯的分钟数
+	WarningsEnabled         bool      `json:"warnings_enabled"`
+	WarningLadder           string    `json:"warning_ladder"`            // 如 warn,mute:1h,mute:24h,ban
+	WarningExpiry           int       `json:"warning_expiry"`            // 警告有效期（秒）
+	RaidEnabled             bool      `json:"raid_enabled"`              // 是否启用防突袭
+	RaidThreshold           int       `json:"raid_threshold"`            // 统计时间内加入多少人视为突袭
+	RaidWindow              int       `json:"raid_window"`               // 统计加入人数的时间（秒）
+	RaidLockdown            int       `json:"raid_lockdown"`             // 锁定持续时间（分钟）
+	RaidRestrictChat        bool      `json:"raid_restrict_chat"`        // 锁定期间全体成员只能发送文字
+	ScreeningEnabled        bool      `json:"screening_enabled"`         // 是否对新成员进行入群筛查
+	ScreeningThreshold      int       `json:"screening_threshold"`       // 可疑分数达到多少时处理
+	ScreeningAction         string    `json:"screening_action"`          // ban, captcha 或 restrict
+	ScreeningRestrictHours  int       `json:"screening_restrict_hours"`  // restrict 时限制发送媒体的小时数
+	ScreeningNewAccountID   int64     `json:"screening_new_account_id"`  // 用户 ID 大于此值视为新注册的账号
+	ProbationEnabled        bool      `json:"probation_enabled"`         // 是否启用新成员观察期
+	ProbationDuration       int       `json:"probation_duration"`        // 观察期时长（分钟）
+	ProbationMessages       int       `json:"probation_messages"`        // 发送多少条正常消息后提前结束观察期
+	NightModeEnabled        bool      `json:"night_mode_enabled"`        // 是否启用夜间模式
+	NightModeStart          string    `json:"night_mode_start"`          // 开始时间 HH:MM
+	NightModeEnd            string    `json:"night_mode_end"`            // 结束时间 HH:MM
+	NightModeDays           string    `json:"night_mode_days"`           // 生效的星期，如 1-5 或 0,6，空表示每天
+	NightModeTimezone       string    `json:"night_mode_timezone"`       // 时区，如 Asia/Shanghai
+	NightModeProfile        string    `json:"night_mode_profile"`        // readonly 或 text_only
+	MediaPolicy             string    `json:"media_policy"`              // 各类内容的处理动作，如 sticker:delete,voice:mute:1h
+	DocumentBlocklist       string    `json:"document_blocklist"`        // 屏蔽的文件扩展名和 MIME 类型，如 exe,apk,application/zip
+	ForwardChannelPolicy    string    `json:"forward_channel_policy"`    // 频道转发：空表示允许，block 全部禁止，allowlist 只允许列表中的频道
+	ForwardChannelAllowlist string    `json:"forward_channel_allowlist"` // 允许转发的频道ID或用户名，逗号分隔
+	ForwardBlocklist        string    `json:"forward_blocklist"`         // 禁止转发的用户、机器人或频道的ID或用户名，逗号分隔
+	ForwardBlockHidden      bool      `json:"forward_block_hidden"`      // 禁止转发隐藏了账号的用户的消息
+	ForwardAction           string    `json:"forward_action"`            // 违反转发策略时的动作，如 delete 或 mute:1h
+	UpdatedAt               time.Time `json:"updated_at"`
+}
+
+type Warning struct {
+	ID        int       `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Reason    string    `json:"reason"`
+	IssuedBy  int64     `json:"issued_by"` // 0 表示由机器人自动发出
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IsActive  bool      `json:"is_active"`
+}
+
+// MembershipEvent 成员变动记录：加入、离开、被封禁、设为管理员等
+type MembershipEvent struct {
+	ID        int       `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Event     string    `json:"event"`      // join, leave, ban, promote, demote, restrict, unrestrict
+	OldStatus string    `json:"old_status"` // 变动前的成员状态，来自系统消息时为空
+	NewStatus string    `json:"new_status"`
+	ActorID   int64     `json:"actor_id"` // 执行变动的用户，自行加入/离开时为用户本人
+	Source    string    `json:"source"`   // chat_member 或 service_message
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Lockdown 群组的防突袭锁定
+type Lockdown struct {
+	ChatID    int64     `json:"chat_id"`
+	Reason    string    `json:"reason"`
+	StartedBy int64     `json:"started_by"` // 0 表示自动触发
+	EndsAt    time.Time `json:"ends_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NightMode 正在生效的夜间模式，修改的群组权限记录在 permission_holds 中
+type NightMode struct {
+	ChatID    int64     `json:"chat_id"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Announcement 定时消息，Interval 为 0 时只发送一次
+type Announcement struct {
+	ID             int64     `json:"id"`
+	ChatID         int64     `json:"chat_id"`
+	Text           string    `json:"text"`       // 支持与欢迎消息相同的按钮语法
+	ParseMode      string    `json:"parse_mode"` // 空, HTML, MarkdownV2
+	Media          string    `json:"media"`      // file_id 或 URL
+	MediaType      string    `json:"media_type"` // photo, video, animation
+	NextRun        time.Time `json:"next_run"`
+	Interval       int       `json:"interval"`        // 重复间隔（分钟）
+	Pin            bool      `json:"pin"`             // 发送后置顶
+	DeletePrevious bool      `json:"delete_previous"` // 发送后删除上一次发送的消息
+	LastMessageID  int       `json:"last_message_id"`
+	Enabled        bool      `json:"enabled"`
+	CreatedBy      int64     `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Probation 处于观察期的新成员
+type Probation struct {
+	ChatID        int64     `json:"chat_id"`
+	UserID        int64     `json:"user_id"`
+	JoinedAt      time.Time `json:"joined_at"`
+	CleanMessages int       `json:"clean_messages"` // 观察期内发送的正常消息数
+}
+
+// GlobalBan 全局封禁记录，在所有管理的群组中生效
+type GlobalBan struct {
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Reason    string    `json:"reason"`
+	IssuedBy  int64     `json:"issued_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AllowlistEntry 群组白名单，白名单中的用户不再检查关键词
+type AllowlistEntry struct {
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	AddedBy   int64     `json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Appeal 用户对禁言/封禁的申诉
+type Appeal struct {
+	ID         int        `json:"id"`
+	ChatID     int64      `json:"chat_id"`
+	UserID     int64      `json:"user_id"`
+	Username   string     `json:"username"`
+	Action     string     `json:"action"`  // 被申诉的处理动作
+	Message    string     `json:"message"` // 申诉理由
+	Status     string     `json:"status"`  // pending, approved, rejected
+	ResolvedBy int64      `json:"resolved_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+// Report 成员举报的消息
+type Report struct {
+	ID               int        `json:"id"`
+	ChatID           int64      `json:"chat_id"`
+	ChatTitle        string     `json:"chat_title"`
+	MessageID        int        `json:"message_id"`
+	MessageText      string     `json:"message_text"`
+	ReportedUserID   int64      `json:"reported_user_id"`
+	ReportedUsername string     `json:"reported_username"`
+	ReporterID       int64      `json:"reporter_id"`
+	ReporterUsername string     `json:"reporter_username"`
+	Reason           string     `json:"reason"`
+	Status           string     `json:"status"` // pending, resolved, dismissed
+	Action           string     `json:"action"` // 管理员执行的动作
+	ResolvedBy       int64      `json:"resolved_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ResolvedAt       *time.Time `json:"resolved_at"`
+}
+
+// ReporterStats 举报者的统计，用于计算信誉
+type ReporterStats struct {
+	ReporterID       int64  `json:"reporter_id"`
+	ReporterUsername string `json:"reporter_username"`
+	Total            int    `json:"total"`
+	Resolved         int    `json:"resolved"`  // 被管理员采纳
+	Dismissed        int    `json:"dismissed"` // 被驳回
+	Pending          int    `json:"pending"`
+}
+
+// Reputation 举报者信誉：被采纳的举报占已处理举报的比例，没有已处理的举报时为 -1
+func (s ReporterStats) Reputation() float64 {
+	if s.Resolved+s.Dismissed == 0 {
+		return -1
+	}
+	return float64(s.Resolved) / float64(s.Resolved+s.Dismissed)
+}
+
+type Message struct {
+	ID             int64     `json:"id"`
+	MessageID      int       `json:"message_id"` // Telegram 中的消息ID
+	Timestamp      time.Time `json:"timestamp"`
+	ChatID         int64     `json:"chat_id"`
+	ChatTitle      string    `json:"chat_title"`
+	UserName       string    `json:"user_name"`
+	FromUserID     int64     `json:"from_user_id"`
+	MessageType    string    `json:"message_type"`
+	MessageContent string    `json:"message_content"`
+	FilePath       string    `json:"file_path,omitempty"`
+	EditCount      int       `json:"edit_count"`             // 消息被编辑的次数
+	ForwardType    string    `json:"forward_type,omitempty"` // 转发来源类型：user, bot, channel, group, hidden，非转发消息为空
+	ForwardFromID  int64     `json:"forward_from_id,omitempty"`
+	ForwardFrom    string    `json:"forward_from,omitempty"` // 转发来源的名称
+}
+
+// MessageEdit 消息的一次编辑，记录编辑后的内容
+type MessageEdit struct {
+	ID             int64     `json:"id"`
+	ChatID         int64     `json:"chat_id"`
+	MessageID      int       `json:"message_id"`
+	UserName       string    `json:"user_name"`
+	FromUserID     int64     `json:"from_user_id"`
+	MessageContent string    `json:"message_content"`
+	EditedAt       time.Time `json:"edited_at"`
+}
+
+type Chat struct {
+	ChatID    int64     `json:"chat_id"`
+	Title     string    `json:"title"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewDatabase(dbPath string) (*Database, error) {
+	// 并发处理更新时多个连接可能同时写入，等待锁释放而不是直接返回 database is locked
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Database{db: db}
+	err = d.createTables()
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *Database) createTables() error {
+	// 创建关键词表
+	keywordSchema := `
+	CREATE TABLE IF NOT EXISTS keywords (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		keyword TEXT NOT NULL,
+		match_type TEXT NOT NULL DEFAULT 'exact',
+		action TEXT NOT NULL DEFAULT 'mute',
+		duration INTEGER DEFAULT 0,
+		delete_message BOOLEAN DEFAULT 1,
+		notify_admin BOOLEAN DEFAULT 1,
+		purge_recent BOOLEAN DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		is_active BOOLEAN DEFAULT 1
+	);`
+
+	// 创建违规记录表
+	violationSchema := `
+	CREATE TABLE IF NOT EXISTS violations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		username TEXT,
+		chat_id INTEGER NOT NULL,
+		message_text TEXT,
+		keyword TEXT NOT NULL,
+		action TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 创建群组表
+	chatSchema := `
+	CREATE TABLE IF NOT EXISTS chats (
+		chat_id INTEGER PRIMARY KEY,
+		title TEXT NOT NULL,
+		type TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 创建群组设置表
+	groupSettingsSchema := `
+	CREATE TABLE IF NOT EXISTS group_settings (
+		chat_id INTEGER PRIMARY KEY,
+		welcome_message TEXT,
+		welcome_parse_mode TEXT DEFAULT '',
+		welcome_media TEXT DEFAULT '',
+		welcome_media_type TEXT DEFAULT '',
+		verification_enabled BOOLEAN DEFAULT 1,
+		question TEXT,
+		answer TEXT,
+		timeout INTEGER DEFAULT 300,
+		verification_mode TEXT DEFAULT 'group',
+		cleanup_delay INTEGER DEFAULT 0,
+		delete_service_messages BOOLEAN DEFAULT 0,
+		purge_window INTEGER DEFAULT 0,
+		warnings_enabled BOOLEAN DEFAULT 0,
+		warning_ladder TEXT DEFAULT '',
+		warning_expiry INTEGER DEFAULT 0,
+		raid_enabled BOOLEAN DEFAULT 0,
+		raid_threshold INTEGER DEFAULT 0,
+		raid_window INTEGER DEFAULT 0,
+		raid_lockdown INTEGER DEFAULT 0,
+		raid_restrict_chat BOOLEAN DEFAULT 0,
+		screening_enabled BOOLEAN DEFAULT 0,
+		screening_threshold INTEGER DEFAULT 0,
+		screening_action TEXT DEFAULT '',
+		screening_restrict_hours INTEGER DEFAULT 0,
+		screening_new_account_id INTEGER DEFAULT 0,
+		probation_enabled BOOLEAN DEFAULT 0,
+		probation_duration INTEGER DEFAULT 0,
+		probation_messages INTEGER DEFAULT 0,
+		night_mode_enabled BOOLEAN DEFAULT 0,
+		night_mode_start TEXT DEFAULT '',
+		night_mode_end TEXT DEFAULT '',
+		night_mode_days TEXT DEFAULT '',
+		night_mode_timezone TEXT DEFAULT '',
+		night_mode_profile TEXT DEFAULT '',
+		media_policy TEXT DEFAULT '',
+		document_blocklist TEXT DEFAULT '',
+		forward_channel_policy TEXT DEFAULT '',
+		forward_channel_allowlist TEXT DEFAULT '',
+		forward_blocklist TEXT DEFAULT '',
+		forward_block_hidden BOOLEAN DEFAULT 0,
+		forward_action TEXT DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 创建消息表
+	messageSchema := `
+	CREATE TABLE IF NOT EXISTS messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		message_id INTEGER DEFAULT 0,
+		chat_id INTEGER NOT NULL,
+		chat_title TEXT NOT NULL,
+		user_name TEXT NOT NULL,
+		from_user_id INTEGER NOT NULL,
+		message_type TEXT NOT NULL,
+		message_content TEXT,
+		file_path TEXT,
+		forward_type TEXT DEFAULT '',
+		forward_from_id INTEGER DEFAULT 0,
+		forward_from TEXT DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_messages_chat_id ON messages(chat_id);
+	CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);`
+
+	// 创建消息编辑记录表
+	messageEditSchema := `
+	CREATE TABLE IF NOT EXISTS message_edits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		user_name TEXT,
+		from_user_id INTEGER NOT NULL,
+		message_content TEXT,
+		edited_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_edits_message ON message_edits(chat_id, message_id);`
+
+	// 创建警告表
+	warningSchema := `
+	CREATE TABLE IF NOT EXISTS warnings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		username TEXT,
+		reason TEXT,
+		issued_by INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		is_active BOOLEAN DEFAULT 1
+	);
+	CREATE INDEX IF NOT EXISTS idx_warnings_chat_user ON warnings(chat_id, user_id);`
+
+	// 创建成员变动记录表
+	membershipSchema := `
+	CREATE TABLE IF NOT EXISTS membership_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		username TEXT,
+		event TEXT NOT NULL,
+		old_status TEXT DEFAULT '',
+		new_status TEXT DEFAULT '',
+		actor_id INTEGER DEFAULT 0,
+		source TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_membership_events_user ON membership_events(user_id, chat_id);`
+
+	// 创建防突袭锁定表，重启后恢复锁定
+	lockdownSchema := `
+	CREATE TABLE IF NOT EXISTS lockdowns (
+		chat_id INTEGER PRIMARY KEY,
+		reason TEXT,
+		started_by INTEGER DEFAULT 0,
+		ends_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 创建夜间模式表
+	nightModeSchema := `
+	CREATE TABLE IF NOT EXISTS night_modes (
+		chat_id INTEGER PRIMARY KEY,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 创建群组权限表：夜间模式和防护模式共用修改前的原有权限，各自记录要求的权限，重启后仍能恢复
+	permissionSchema := `
+	CREATE TABLE IF NOT EXISTS saved_permissions (
+		chat_id INTEGER PRIMARY KEY,
+		permissions TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS permission_holds (
+		chat_id INTEGER NOT NULL,
+		holder TEXT NOT NULL,
+		permissions TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (chat_id, holder)
+	);`
+
+	// 创建定时消息表
+	announcementSchema := `
+	CREATE TABLE IF NOT EXISTS announcements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		text TEXT DEFAULT '',
+		parse_mode TEXT DEFAULT '',
+		media TEXT DEFAULT '',
+		media_type TEXT DEFAULT '',
+		next_run DATETIME NOT NULL,
+		interval INTEGER DEFAULT 0,
+		pin BOOLEAN DEFAULT 0,
+		delete_previous BOOLEAN DEFAULT 0,
+		last_message_id INTEGER DEFAULT 0,
+		enabled BOOLEAN DEFAULT 1,
+		created_by INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 创建新成员观察期表
+	probationSchema := `
+	CREATE TABLE IF NOT EXISTS probation (
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		clean_messages INTEGER DEFAULT 0,
+		PRIMARY KEY (chat_id, user_id)
+	);`
+
+	// 创建全局封禁表
+	globalBanSchema := `
+	CREATE TABLE IF NOT EXISTS global_bans (
+		user_id INTEGER PRIMARY KEY,
+		username TEXT,
+		reason TEXT,
+		issued_by INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS global_ban_chats (
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, chat_id)
+	);`
+
+	// 创建申诉表
+	appealSchema := `
+	CREATE TABLE IF NOT EXISTS appeals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		username TEXT,
+		action TEXT NOT NULL,
+		message TEXT,
+		status TEXT NOT NULL DEFAULT 'pending',
+		resolved_by INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		resolved_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_appeals_status ON appeals(status);`
+
+	// 创建举报表
+	reportSchema := `
+	CREATE TABLE IF NOT EXISTS reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		chat_title TEXT,
+		message_id INTEGER NOT NULL,
+		message_text TEXT,
+		reported_user_id INTEGER NOT NULL,
+		reported_username TEXT,
+		reporter_id INTEGER NOT NULL,
+		reporter_username TEXT,
+		reason TEXT,
+		status TEXT NOT NULL DEFAULT 'pending',
+		action TEXT DEFAULT '',
+		resolved_by INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		resolved_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_reports_status ON reports(status);
+	CREATE INDEX IF NOT EXISTS idx_reports_reporter ON reports(reporter_id);`
+
+	// 创建白名单表
+	allowlistSchema := `
+	CREATE TABLE IF NOT EXISTS allowlist (
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		username TEXT,
+		added_by INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (chat_id, user_id)
+	);`
+
+	_, err := d.db.Exec(keywordSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(violationSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(chatSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(groupSettingsSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(messageSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(messageEditSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(warningSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(membershipSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(lockdownSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(nightModeSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(permissionSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(announcementSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(probationSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(globalBanSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(appealSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(reportSchema)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(allowlistSchema)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 关键词管理
+func (d *Database) AddKeyword(k *Keyword) error {
+	query := `INSERT INTO keywords (keyword, match_type, action, duration, delete_message, notify_admin, purge_recent)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := d.db.Exec(query, k.Keyword, k.MatchType, k.Action, k.Duration, k.DeleteMessage, k.NotifyAdmin, k.PurgeRecent)
+	return err
+}
+
+func (d *Database) GetKeywords() ([]Keyword, error) {
+	query := `SELECT id, keyword, match_type, action, COALESCE(duration, 0), COALESCE(delete_message, 1),
+		COALESCE(notify_admin, 1), COALESCE(purge_recent, 0), created_at, is_active
+		FROM keywords WHERE is_active = 1`
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keywords []Keyword
+	for rows.Next() {
+		var k Keyword
+		err := rows.Scan(&k.ID, &k.Keyword, &k.MatchType, &k.Action, &k.Duration, &k.DeleteMessage,
+			&k.NotifyAdmin, &k.PurgeRecent, &k.CreatedAt, &k.IsActive)
+		if err != nil {
+			return nil, err
+		}
+		keywords = append(keywords, k)
+	}
+
+	return keywords, nil
+}
+
+func (d *Database) DeleteKeyword(id int) error {
+	query := `UPDATE keywords SET is_active = 0 WHERE id = ?`
+	_, err := d.db.Exec(query, id)
+	return err
+}
+
+// 违规记录
+func (d *Database) LogViolation(userID int64, username string, chatID int64, messageText, keyword, action string) error {
+	query := `INSERT INTO violations (user_id, username, chat_id, message_text, keyword, action) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := d.db.Exec(query, userID, username, chatID, messageText, keyword, action)
+	return err
+}
+
+func (d *Database) GetViolations(limit int) ([]Violation, error) {
+	query := `SELECT id, user_id, username, chat_id, message_text, keyword, action, created_at 
+			  FROM violations ORDER BY created_at DESC LIMIT ?`
+	rows, err := d.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var violations []Violation
+	for rows.Next() {
+		var v Violation
+		var username sql.NullString
+		err := rows.Scan(&v.ID, &v.UserID, &username, &v.ChatID, &v.MessageText, &v.Keyword, &v.Action, &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if username.Valid {
+			v.Username = username.String
+		}
+		violations = append(violations, v)
+	}
+
+	return violations, nil
+}
+
+// 警告记录
+func (d *Database) AddWarning(chatID, userID int64, username, reason string, issuedBy int64, expiry int) error {
+	query := `INSERT INTO warnings (chat_id, user_id, username, reason, issued_by, expires_at)
+			  VALUES (?, ?, ?, ?, ?, datetime('now', ?))`
+	_, err := d.db.Exec(query, chatID, userID, username, reason, issuedBy, fmt.Sprintf("+%d seconds", expiry))
+	return err
+}
+
+// CountActiveWarnings 统计用户在群组中未过期且未撤销的警告数
+func (d *Database) CountActiveWarnings(chatID, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM warnings
+			  WHERE chat_id = ? AND user_id = ? AND is_active = 1 AND expires_at > datetime('now')`
+	var count int
+	err := d.db.QueryRow(query, chatID, userID).Scan(&count)
+	return count, err
+}
+
+// GetWarnings 获取警告历史，chatID 或 userID 为 0 时不按该条件过滤
+func (d *Database) GetWarnings(chatID, userID int64, limit int) ([]Warning, error) {
+	query := `SELECT id, chat_id, user_id, username, reason, issued_by, created_at, expires_at,
+			  is_active AND expires_at > datetime('now')
+			  FROM warnings WHERE 1=1`
+	var params []interface{}
+
+	if chatID != 0 {
+		query += ` AND chat_id = ?`
+		params = append(params, chatID)
+	}
+	if userID != 0 {
+		query += ` AND user_id = ?`
+		params = append(params, userID)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	params = append(params, limit)
+
+	rows, err := d.db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var warnings []Warning
+	for rows.Next() {
+		var w Warning
+		var username, reason sql.NullString
+		err := rows.Scan(&w.ID, &w.ChatID, &w.UserID, &username, &reason, &w.IssuedBy, &w.CreatedAt, &w.ExpiresAt, &w.IsActive)
+		if err != nil {
+			return nil, err
+		}
+		w.Username = username.String
+		w.Reason = reason.String
+		warnings = append(warnings, w)
+	}
+
+	return warnings, nil
+}
+
+// RemoveLatestWarning 撤销用户最近的一条有效警告，返回是否有警告被撤销
+func (d *Database) RemoveLatestWarning(chatID, userID int64) (bool, error) {
+	query := `UPDATE warnings SET is_active = 0 WHERE id = (
+				SELECT id FROM warnings
+				WHERE chat_id = ? AND user_id = ? AND is_active = 1 AND expires_at > datetime('now')
+				ORDER BY created_at DESC, id DESC LIMIT 1
+			  )`
+	result, err := d.db.Exec(query, chatID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RemoveWarning 撤销指定的警告
+func (d *Database) RemoveWarning(id int) error {
+	query := `UPDATE warnings SET is_active = 0 WHERE id = ?`
+	_, err := d.db.Exec(query, id)
+	return err
+}
+
+// 成员变动
+// AddMembershipEvent 记录一次成员变动
+func (d *Database) AddMembershipEvent(e *MembershipEvent) error {
+	query := `INSERT INTO membership_events (chat_id, user_id, username, event, old_status, new_status, actor_id, source)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := d.db.Exec(query, e.ChatID, e.UserID, e.Username, e.Event, e.OldStatus, e.NewStatus, e.ActorID, e.Source)
+	return err
+}
+
+// HasRecentMembershipEvent 用户最近一次变动是否为同类变动且在 seconds 秒内
+// 同一次加入可能同时收到 chat_member 更新和系统消息，用于去重
+func (d *Database) HasRecentMembershipEvent(chatID, userID int64, event string, seconds int) (bool, error) {
+	query := `SELECT event FROM membership_events
+			  WHERE chat_id = ? AND user_id = ? AND created_at > datetime('now', ?)
+			  ORDER BY id DESC LIMIT 1`
+	var last string
+	err := d.db.QueryRow(query, chatID, userID, fmt.Sprintf("-%d seconds", seconds)).Scan(&last)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return last == event, err
+}
+
+// GetMembershipEvents 获取成员变动记录，chatID 或 userID 为 0 时不按其过滤
+func (d *Database) GetMembershipEvents(chatID, userID int64, limit int) ([]MembershipEvent, error) {
+	query := `SELECT id, chat_id, user_id, COALESCE(username, ''), event, COALESCE(old_status, ''),
+			  COALESCE(new_status, ''), actor_id, COALESCE(source, ''), created_at
+			  FROM membership_events WHERE 1=1`
+	var params []interface{}
+
+	if chatID != 0 {
+		query += ` AND chat_id = ?`
+		params = append(params, chatID)
+	}
+	if userID != 0 {
+		query += ` AND user_id = ?`
+		params = append(params, userID)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	params = append(params, limit)
+
+	rows, err := d.db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []MembershipEvent
+	for rows.Next() {
+		var e MembershipEvent
+		err := rows.Scan(&e.ID, &e.ChatID, &e.UserID, &e.Username, &e.Event, &e.OldStatus,
+			&e.NewStatus, &e.ActorID, &e.Source, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// 防突袭锁定
+// SaveLockdown 保存群组的锁定状态
+func (d *Database) SaveLockdown(l *Lockdown) error {
+	query := `INSERT OR REPLACE INTO lockdowns (chat_id, reason, started_by, ends_at)
+			  VALUES (?, ?, ?, ?)`
+	_, err := d.db.Exec(query, l.ChatID, l.Reason, l.StartedBy, l.EndsAt)
+	return err
+}
+
+// DeleteLockdown 删除群组的锁定状态
+func (d *Database) DeleteLockdown(chatID int64) error {
+	_, err := d.db.Exec(`DELETE FROM lockdowns WHERE chat_id = ?`, chatID)
+	return err
+}
+
+// GetLockdowns 获取所有未解除的锁定
+func (d *Database) GetLockdowns() ([]Lockdown, error) {
+	query := `SELECT chat_id, COALESCE(reason, ''), started_by, ends_at, created_at
+			  FROM lockdowns`
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockdowns []Lockdown
+	for rows.Next() {
+		var l Lockdown
+		if err := rows.Scan(&l.ChatID, &l.Reason, &l.StartedBy, &l.EndsAt, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		lockdowns = append(lockdowns, l)
+	}
+
+	return lockdowns, nil
+}
+
+// 夜间模式
+// SaveNightMode 记录群组的夜间模式已开始
+func (d *Database) SaveNightMode(n *NightMode) error {
+	_, err := d.db.Exec(`INSERT OR REPLACE INTO night_modes (chat_id) VALUES (?)`, n.ChatID)
+	return err
+}
+
+// GetNightMode 获取群组正在生效的夜间模式，未生效时返回 nil
+func (d *Database) GetNightMode(chatID int64) (*NightMode, error) {
+	var n NightMode
+	err := d.db.QueryRow(`SELECT chat_id, started_at FROM night_modes WHERE chat_id = ?`, chatID).
+		Scan(&n.ChatID, &n.StartedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+// DeleteNightMode 删除群组的夜间模式记录
+func (d *Database) DeleteNightMode(chatID int64) error {
+	_, err := d.db.Exec(`DELETE FROM night_modes WHERE chat_id = ?`, chatID)
+	return err
+}
+
+// 群组权限
+// GetSavedPermissions 获取修改群组权限前保存的原有权限（JSON），没有保存时返回空字符串
+func (d *Database) GetSavedPermissions(chatID int64) (string, error) {
+	var permissions string
+	err := d.db.QueryRow(`SELECT permissions FROM saved_permissions WHERE chat_id = ?`, chatID).Scan(&permissions)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return permissions, err
+}
+
+// SavePermissions 保存群组的原有权限
+func (d *Database) SavePermissions(chatID int64, permissions string) error {
+	_, err := d.db.Exec(`INSERT OR REPLACE INTO saved_permissions (chat_id, permissions) VALUES (?, ?)`, chatID, permissions)
+	return err
+}
+
+// DeleteSavedPermissions 删除群组保存的原有权限
+func (d *Database) DeleteSavedPermissions(chatID int64) error {
+	_, err := d.db.Exec(`DELETE FROM saved_permissions WHERE chat_id = ?`, chatID)
+	return err
+}
+
+// SetPermissionHold 记录 holder（夜间模式或防护模式）要求的群组权限
+func (d *Database) SetPermissionHold(chatID int64, holder, permissions string) error {
+	_, err := d.db.Exec(`INSERT OR REPLACE INTO permission_holds (chat_id, holder, permissions) VALUES (?, ?, ?)`,
+		chatID, holder, permissions)
+	return err
+}
+
+// DeletePermissionHold 删除 holder 要求的群组权限，返回之前是否存在
+func (d *Database) DeletePermissionHold(chatID int64, holder string) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM permission_holds WHERE chat_id = ? AND holder = ?`, chatID, holder)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetPermissionHolds 获取群组中仍在生效的权限要求（JSON）
+func (d *Database) GetPermissionHolds(chatID int64) ([]string, error) {
+	rows, err := d.db.Query(`SELECT permissions FROM permission_holds WHERE chat_id = ? ORDER BY created_at`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []string
+	for rows.Next() {
+		var permissions string
+		if err := rows.Scan(&permissions); err != nil {
+			return nil, err
+		}
+		holds = append(holds, permissions)
+	}
+	return holds, nil
+}
+
+// 定时消息
+// AddAnnouncement 添加定时消息，返回新消息的ID
+func (d *Database) AddAnnouncement(a *Announcement) (int64, error) {
+	query := `INSERT INTO announcements (chat_id, text, parse_mode, media, media_type, next_run, interval, pin, delete_previous, enabled, created_by)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?)`
+	result, err := d.db.Exec(query, a.ChatID, a.Text, a.ParseMode, a.Media, a.MediaType, a.NextRun,
+		a.Interval, a.Pin, a.DeletePrevious, a.CreatedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetAnnouncements 获取群组的定时消息，chatID 为 0 时返回所有群组的
+func (d *Database) GetAnnouncements(chatID int64) ([]Announcement, error) {
+	query := `SELECT id, chat_id, COALESCE(text, ''), COALESCE(parse_mode, ''), COALESCE(media, ''), COALESCE(media_type, ''),
+			  next_run, interval, pin, delete_previous, last_message_id, enabled, created_by, created_at
+			  FROM announcements`
+	var args []interface{}
+	if chatID != 0 {
+		query += ` WHERE chat_id = ?`
+		args = append(args, chatID)
+	}
+	query += ` ORDER BY next_run`
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var announcements []Announcement
+	for rows.Next() {
+		var a Announcement
+		err := rows.Scan(&a.ID, &a.ChatID, &a.Text, &a.ParseMode, &a.Media, &a.MediaType,
+			&a.NextRun, &a.Interval, &a.Pin, &a.DeletePrevious, &a.LastMessageID, &a.Enabled, &a.CreatedBy, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, a)
+	}
+
+	return announcements, nil
+}
+
+// UpdateAnnouncementRun 记录定时消息的发送结果和下次发送时间
+func (d *Database) UpdateAnnouncementRun(id int64, nextRun time.Time, lastMessageID int, enabled bool) error {
+	query := `UPDATE announcements SET next_run = ?, last_message_id = ?, enabled = ? WHERE id = ?`
+	_, err := d.db.Exec(query, nextRun, lastMessageID, enabled, id)
+	return err
+}
+
+// SetAnnouncementEnabled 启用或停用定时消息，返回消息是否存在
+func (d *Database) SetAnnouncementEnabled(id int64, enabled bool) (bool, error) {
+	result, err := d.db.Exec(`UPDATE announcements SET enabled = ? WHERE id = ?`, enabled, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// DeleteAnnouncement 删除定时消息，chatID 不为 0 时只删除该群组的，返回是否删除了消息
+func (d *Database) DeleteAnnouncement(chatID, id int64) (bool, error) {
+	query := `DELETE FROM announcements WHERE id = ?`
+	args := []interface{}{id}
+	if chatID != 0 {
+		query += ` AND chat_id = ?`
+		args = append(args, chatID)
+	}
+
+	result, err := d.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// 新成员观察期
+// StartProbation 新成员加入时开始观察期，重新加入时重新计算
+func (d *Database) StartProbation(chatID, userID int64) error {
+	query := `INSERT OR REPLACE INTO probation (chat_id, user_id, joined_at, clean_messages)
+			  VALUES (?, ?, CURRENT_TIMESTAMP, 0)`
+	_, err := d.db.Exec(query, chatID, userID)
+	return err
+}
+
+// GetProbation 获取用户在群组中的观察期，不在观察期时返回 nil
+func (d *Database) GetProbation(chatID, userID int64) (*Probation, error) {
+	query := `SELECT chat_id, user_id, joined_at, clean_messages FROM probation WHERE chat_id = ? AND user_id = ?`
+
+	var p Probation
+	err := d.db.QueryRow(query, chatID, userID).Scan(&p.ChatID, &p.UserID, &p.JoinedAt, &p.CleanMessages)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// AddProbationCleanMessage 观察期内的正常消息数加一，返回新的消息数
+func (d *Database) AddProbationCleanMessage(chatID, userID int64) (int, error) {
+	_, err := d.db.Exec(`UPDATE probation SET clean_messages = clean_messages + 1 WHERE chat_id = ? AND user_id = ?`, chatID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = d.db.QueryRow(`SELECT clean_messages FROM probation WHERE chat_id = ? AND user_id = ?`, chatID, userID).Scan(&count)
+	return count, err
+}
+
+// EndProbation 结束用户在群组中的观察期
+func (d *Database) EndProbation(chatID, userID int64) error {
+	_, err := d.db.Exec(`DELETE FROM probation WHERE chat_id = ? AND user_id = ?`, chatID, userID)
+	return err
+}
+
+// 全局封禁
+// AddGlobalBan 添加全局封禁，用户已在列表中时更新原因和发出者
+func (d *Database) AddGlobalBan(ban *GlobalBan) error {
+	query := `INSERT INTO global_bans (user_id, username, reason, issued_by)
+			  VALUES (?, ?, ?, ?)
+			  ON CONFLICT(user_id) DO UPDATE SET
+			  username = excluded.username,
+			  reason = excluded.reason,
+			  issued_by = excluded.issued_by,
+			  updated_at = CURRENT_TIMESTAMP`
+	_, err := d.db.Exec(query, ban.UserID, ban.Username, ban.Reason, ban.IssuedBy)
+	return err
+}
+
+// ImportGlobalBan 导入全局封禁记录，保留原有的时间
+func (d *Database) ImportGlobalBan(ban *GlobalBan) error {
+	now := time.Now().UTC()
+	if ban.CreatedAt.IsZero() {
+		ban.CreatedAt = now
+	}
+	if ban.UpdatedAt.IsZero() {
+		ban.UpdatedAt = now
+	}
+
+	query := `INSERT INTO global_bans (user_id, username, reason, issued_by, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?)
+			  ON CONFLICT(user_id) DO UPDATE SET
+			  username = excluded.username,
+			  reason = excluded.reason,
+			  issued_by = excluded.issued_by,
+			  updated_at = excluded.updated_at`
+	_, err := d.db.Exec(query, ban.UserID, ban.Username, ban.Reason, ban.IssuedBy,
+		ban.CreatedAt.UTC().Format("2006-01-02 15:04:05"), ban.UpdatedAt.UTC().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// RemoveGlobalBan 解除全局封禁并清除封禁过的群组记录，返回用户是否在列表中
+func (d *Database) RemoveGlobalBan(userID int64) (bool, error) {
+	if _, err := d.db.Exec(`DELETE FROM global_ban_chats WHERE user_id = ?`, userID); err != nil {
+		return false, err
+	}
+	result, err := d.db.Exec(`DELETE FROM global_bans WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetGlobalBan 获取用户的全局封禁记录，不在列表中时返回 nil
+func (d *Database) GetGlobalBan(userID int64) (*GlobalBan, error) {
+	query := `SELECT user_id, COALESCE(username, ''), COALESCE(reason, ''), issued_by, created_at, updated_at
+			  FROM global_bans WHERE user_id = ?`
+
+	var ban GlobalBan
+	err := d.db.QueryRow(query, userID).Scan(&ban.UserID, &ban.Username, &ban.Reason, &ban.IssuedBy, &ban.CreatedAt, &ban.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ban, nil
+}
+
+// GetGlobalBans 获取全部全局封禁记录
+func (d *Database) GetGlobalBans() ([]GlobalBan, error) {
+	query := `SELECT user_id, COALESCE(username, ''), COALESCE(reason, ''), issued_by, created_at, updated_at
+			  FROM global_bans ORDER BY created_at DESC`
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []GlobalBan
+	for rows.Next() {
+		var ban GlobalBan
+		if err := rows.Scan(&ban.UserID, &ban.Username, &ban.Reason, &ban.IssuedBy, &ban.CreatedAt, &ban.UpdatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+
+	return bans, nil
+}
+
+// AddGlobalBanChat 记录因全局封禁而封禁用户的群组，解除全局封禁时只在这些群组中解封
+func (d *Database) AddGlobalBanChat(userID, chatID int64) error {
+	_, err := d.db.Exec(`INSERT OR IGNORE INTO global_ban_chats (user_id, chat_id) VALUES (?, ?)`, userID, chatID)
+	return err
+}
+
+// GetGlobalBanChats 获取因全局封禁而封禁用户的群组
+func (d *Database) GetGlobalBanChats(userID int64) ([]int64, error) {
+	rows, err := d.db.Query(`SELECT chat_id FROM global_ban_chats WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chatIDs []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+	return chatIDs, nil
+}
+
+// 白名单
+// AddToAllowlist 将用户加入群组白名单
+func (d *Database) AddToAllowlist(entry *AllowlistEntry) error {
+	query := `INSERT INTO allowlist (chat_id, user_id, username, added_by)
+			  VALUES (?, ?, ?, ?)
+			  ON CONFLICT(chat_id, user_id) DO UPDATE SET
+			  username = excluded.username,
+			  added_by = excluded.added_by`
+	_, err := d.db.Exec(query, entry.ChatID, entry.UserID, entry.Username, entry.AddedBy)
+	return err
 }
 
-type Message struct {
-	ID             int64     `json:"id"`
-	Timestamp      time.Time `json:"timestamp"`
-	ChatID         int64     `json:"chat_id"`
-	ChatTitle      string    `json:"chat_title"`
-	UserName       string    `json:"user_name"`
-	FromUserID     int64     `json:"from_user_id"`
-	MessageType    string    `json:"message_type"`
-	MessageContent string    `json:"message_content"`
-	FilePath       string    `json:"file_path,omitempty"`
+// RemoveFromAllowlist 将用户移出群组白名单，返回用户是否在白名单中
+func (d *Database) RemoveFromAllowlist(chatID, userID int64) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM allowlist WHERE chat_id = ? AND user_id = ?`, chatID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
 }
 
-type Chat struct {
-	ChatID    int64     `json:"chat_id"`
-	Title     string    `json:"title"`
-	Type      string    `json:"type"`
-	CreatedAt time.Time `json:"created_at"`
+// IsAllowlisted 用户是否在群组白名单中
+func (d *Database) IsAllowlisted(chatID, userID int64) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM allowlist WHERE chat_id = ? AND user_id = ?`, chatID, userID).Scan(&count)
+	return count > 0, err
 }
 
-func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+// GetAllowlist 获取群组白名单
+func (d *Database) GetAllowlist(chatID int64) ([]AllowlistEntry, error) {
+	query := `SELECT chat_id, user_id, COALESCE(username, ''), added_by, created_at
+			  FROM allowlist WHERE chat_id = ? ORDER BY created_at DESC`
+	rows, err := d.db.Query(query, chatID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	d := &Database{db: db}
-	err = d.createTables()
-	if err != nil {
-		return nil, err
+	var entries []AllowlistEntry
+	for rows.Next() {
+		var e AllowlistEntry
+		if err := rows.Scan(&e.ChatID, &e.UserID, &e.Username, &e.AddedBy, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
 	}
 
-	return d, nil
+	return entries, nil
 }
 
-func (d *Database) createTables() error {
-	// 创建关键词表
-	keywordSchema := `
-	CREATE TABLE IF NOT EXISTS keywords (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		keyword TEXT NOT NULL,
-		match_type TEXT NOT NULL DEFAULT 'exact',
-		action TEXT NOT NULL DEFAULT 'mute',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		is_active BOOLEAN DEFAULT 1
-	);`
+// 申诉
+// AddAppeal 添加申诉，返回申诉ID
+func (d *Database) AddAppeal(appeal *Appeal) (int, error) {
+	query := `INSERT INTO appeals (chat_id, user_id, username, action, message) VALUES (?, ?, ?, ?, ?)`
+	result, err := d.db.Exec(query, appeal.ChatID, appeal.UserID, appeal.Username, appeal.Action, appeal.Message)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
 
-	// 创建违规记录表
-	violationSchema := `
-	CREATE TABLE IF NOT EXISTS violations (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		username TEXT,
-		chat_id INTEGER NOT NULL,
-		message_text TEXT,
-		keyword TEXT NOT NULL,
-		action TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+const appealColumns = `id, chat_id, user_id, COALESCE(username, ''), action, COALESCE(message, ''),
+	status, resolved_by, created_at, resolved_at`
 
-	// 创建群组表
-	chatSchema := `
-	CREATE TABLE IF NOT EXISTS chats (
-		chat_id INTEGER PRIMARY KEY,
-		title TEXT NOT NULL,
-		type TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+func scanAppeal(scanner interface{ Scan(...interface{}) error }) (*Appeal, error) {
+	var a Appeal
+	var resolvedAt sql.NullTime
+	err := scanner.Scan(&a.ID, &a.ChatID, &a.UserID, &a.Username, &a.Action, &a.Message,
+		&a.Status, &a.ResolvedBy, &a.CreatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		a.ResolvedAt = &resolvedAt.Time
+	}
+	return &a, nil
+}
 
-	// 创建群组设置表
-	groupSettingsSchema := `
-	CREATE TABLE IF NOT EXISTS group_settings (
-		chat_id INTEGER PRIMARY KEY,
-		welcome_message TEXT,
-		verification_enabled BOOLEAN DEFAULT 1,
-		question TEXT,
-		answer TEXT,
-		timeout INTEGER DEFAULT 300,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+// GetAppeal 获取申诉，不存在时返回 nil
+func (d *Database) GetAppeal(id int) (*Appeal, error) {
+	row := d.db.QueryRow(`SELECT `+appealColumns+` FROM appeals WHERE id = ?`, id)
+	appeal, err := scanAppeal(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return appeal, err
+}
 
-	// 创建消息表
-	messageSchema := `
-	CREATE TABLE IF NOT EXISTS messages (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-		chat_id INTEGER NOT NULL,
-		chat_title TEXT NOT NULL,
-		user_name TEXT NOT NULL,
-		from_user_id INTEGER NOT NULL,
-		message_type TEXT NOT NULL,
-		message_content TEXT,
-		file_path TEXT
-	);
-	CREATE INDEX IF NOT EXISTS idx_messages_chat_id ON messages(chat_id);
-	CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);`
+// HasPendingAppeal 用户在群组中是否有待处理的申诉
+func (d *Database) HasPendingAppeal(chatID, userID int64) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM appeals WHERE chat_id = ? AND user_id = ? AND status = 'pending'`,
+		chatID, userID).Scan(&count)
+	return count > 0, err
+}
 
-	_, err := d.db.Exec(keywordSchema)
-	if err != nil {
-		return err
+// GetAppeals 获取申诉列表，status 为空时返回全部
+func (d *Database) GetAppeals(status string, limit int) ([]Appeal, error) {
+	query := `SELECT ` + appealColumns + ` FROM appeals`
+	var params []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		params = append(params, status)
 	}
+	query += ` ORDER BY created_at DESC LIMIT ?`
+	params = append(params, limit)
 
-	_, err = d.db.Exec(violationSchema)
+	rows, err := d.db.Query(query, params...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	_, err = d.db.Exec(chatSchema)
-	if err != nil {
-		return err
+	var appeals []Appeal
+	for rows.Next() {
+		appeal, err := scanAppeal(rows)
+		if err != nil {
+			return nil, err
+		}
+		appeals = append(appeals, *appeal)
 	}
 
-	_, err = d.db.Exec(groupSettingsSchema)
+	return appeals, nil
+}
+
+// ResolveAppeal 处理待处理的申诉，申诉已被处理时返回 false
+func (d *Database) ResolveAppeal(id int, status string, resolvedBy int64) (bool, error) {
+	query := `UPDATE appeals SET status = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+			  WHERE id = ? AND status = 'pending'`
+	result, err := d.db.Exec(query, status, resolvedBy, id)
 	if err != nil {
-		return err
+		return false, err
 	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
 
-	_, err = d.db.Exec(messageSchema)
+// ReopenAppeal 将已处理的申诉恢复为待处理，用于撤销处理失败时
+func (d *Database) ReopenAppeal(id int) error {
+	query := `UPDATE appeals SET status = 'pending', resolved_by = 0, resolved_at = NULL WHERE id = ?`
+	_, err := d.db.Exec(query, id)
+	return err
+}
+
+// 举报
+// AddReport 添加举报，返回举报ID
+func (d *Database) AddReport(report *Report) (int, error) {
+	query := `INSERT INTO reports (chat_id, chat_title, message_id, message_text, reported_user_id,
+			  reported_username, reporter_id, reporter_username, reason)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := d.db.Exec(query, report.ChatID, report.ChatTitle, report.MessageID, report.MessageText,
+		report.ReportedUserID, report.ReportedUsername, report.ReporterID, report.ReporterUsername, report.Reason)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
 
-	return nil
+// CountReportsSince 统计用户最近 seconds 秒内提交的举报数
+func (d *Database) CountReportsSince(reporterID int64, seconds int) (int, error) {
+	query := `SELECT COUNT(*) FROM reports WHERE reporter_id = ? AND created_at > datetime('now', ?)`
+	var count int
+	err := d.db.QueryRow(query, reporterID, fmt.Sprintf("-%d seconds", seconds)).Scan(&count)
+	return count, err
 }
 
-// 关键词管理
-func (d *Database) AddKeyword(keyword, matchType, action string) error {
-	query := `INSERT INTO keywords (keyword, match_type, action) VALUES (?, ?, ?)`
-	_, err := d.db.Exec(query, keyword, matchType, action)
-	return err
+// HasPendingReport 消息是否已有待处理的举报
+func (d *Database) HasPendingReport(chatID int64, messageID int) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM reports WHERE chat_id = ? AND message_id = ? AND status = 'pending'`,
+		chatID, messageID).Scan(&count)
+	return count > 0, err
 }
 
-func (d *Database) GetKeywords() ([]Keyword, error) {
-	query := `SELECT id, keyword, match_type, action, created_at, is_active FROM keywords WHERE is_active = 1`
-	rows, err := d.db.Query(query)
+const reportColumns = `id, chat_id, COALESCE(chat_title, ''), message_id, COALESCE(message_text, ''),
+	reported_user_id, COALESCE(reported_username, ''), reporter_id, COALESCE(reporter_username, ''),
+	COALESCE(reason, ''), status, COALESCE(action, ''), resolved_by, created_at, resolved_at`
+
+func scanReport(scanner interface{ Scan(...interface{}) error }) (*Report, error) {
+	var r Report
+	var resolvedAt sql.NullTime
+	err := scanner.Scan(&r.ID, &r.ChatID, &r.ChatTitle, &r.MessageID, &r.MessageText,
+		&r.ReportedUserID, &r.ReportedUsername, &r.ReporterID, &r.ReporterUsername,
+		&r.Reason, &r.Status, &r.Action, &r.ResolvedBy, &r.CreatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		r.ResolvedAt = &resolvedAt.Time
+	}
+	return &r, nil
+}
+
+// GetReport 获取举报，不存在时返回 nil
+func (d *Database) GetReport(id int) (*Report, error) {
+	row := d.db.QueryRow(`SELECT `+reportColumns+` FROM reports WHERE id = ?`, id)
+	report, err := scanReport(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return report, err
+}
+
+// GetReports 获取举报列表，status 为空时返回全部
+func (d *Database) GetReports(status string, limit int) ([]Report, error) {
+	query := `SELECT ` + reportColumns + ` FROM reports`
+	var params []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		params = append(params, status)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ?`
+	params = append(params, limit)
+
+	rows, err := d.db.Query(query, params...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var keywords []Keyword
+	var reports []Report
 	for rows.Next() {
-		var k Keyword
-		err := rows.Scan(&k.ID, &k.Keyword, &k.MatchType, &k.Action, &k.CreatedAt, &k.IsActive)
+		report, err := scanReport(rows)
 		if err != nil {
 			return nil, err
 		}
-		keywords = append(keywords, k)
+		reports = append(reports, *report)
 	}
 
-	return keywords, nil
+	return reports, nil
 }
 
-func (d *Database) DeleteKeyword(id int) error {
-	query := `UPDATE keywords SET is_active = 0 WHERE id = ?`
+// ResolveReport 处理待处理的举报，举报已被处理时返回 false
+func (d *Database) ResolveReport(id int, status, action string, resolvedBy int64) (bool, error) {
+	query := `UPDATE reports SET status = ?, action = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+			  WHERE id = ? AND status = 'pending'`
+	result, err := d.db.Exec(query, status, action, resolvedBy, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ReopenReport 将已处理的举报恢复为待处理，用于执行动作失败时
+func (d *Database) ReopenReport(id int) error {
+	query := `UPDATE reports SET status = 'pending', action = '', resolved_by = 0, resolved_at = NULL WHERE id = ?`
 	_, err := d.db.Exec(query, id)
 	return err
 }
 
-// 违规记录
-func (d *Database) LogViolation(userID int64, username string, chatID int64, messageText, keyword, action string) error {
-	query := `INSERT INTO violations (user_id, username, chat_id, message_text, keyword, action) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err := d.db.Exec(query, userID, username, chatID, messageText, keyword, action)
-	return err
+const reporterStatsQuery = `SELECT reporter_id, COALESCE(MAX(reporter_username), ''), COUNT(*),
+	SUM(CASE WHEN status = 'resolved' THEN 1 ELSE 0 END),
+	SUM(CASE WHEN status = 'dismissed' THEN 1 ELSE 0 END),
+	SUM(CASE WHEN status = 'pending' THEN 1 ELSE 0 END)
+	FROM reports`
+
+// GetReporterStats 获取举报者的统计
+func (d *Database) GetReporterStats(reporterID int64) (ReporterStats, error) {
+	var s ReporterStats
+	err := d.db.QueryRow(reporterStatsQuery+` WHERE reporter_id = ? GROUP BY reporter_id`, reporterID).Scan(
+		&s.ReporterID, &s.ReporterUsername, &s.Total, &s.Resolved, &s.Dismissed, &s.Pending)
+	if err == sql.ErrNoRows {
+		return ReporterStats{ReporterID: reporterID}, nil
+	}
+	return s, err
 }
 
-func (d *Database) GetViolations(limit int) ([]Violation, error) {
-	query := `SELECT id, user_id, username, chat_id, message_text, keyword, action, created_at 
-			  FROM violations ORDER BY created_at DESC LIMIT ?`
-	rows, err := d.db.Query(query, limit)
+// GetTopReporters 按举报数量排序的举报者统计
+func (d *Database) GetTopReporters(limit int) ([]ReporterStats, error) {
+	rows, err := d.db.Query(reporterStatsQuery+` GROUP BY reporter_id ORDER BY COUNT(*) DESC LIMIT ?`, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var violations []Violation
+	var stats []ReporterStats
 	for rows.Next() {
-		var v Violation
-		var username sql.NullString
-		err := rows.Scan(&v.ID, &v.UserID, &username, &v.ChatID, &v.MessageText, &v.Keyword, &v.Action, &v.CreatedAt)
-		if err != nil {
+		var s ReporterStats
+		if err := rows.Scan(&s.ReporterID, &s.ReporterUsername, &s.Total, &s.Resolved, &s.Dismissed, &s.Pending); err != nil {
 			return nil, err
 		}
-		if username.Valid {
-			v.Username = username.String
+		stats = append(stats, s)
+	}
+
+	return stats, nil
+}
+
+// CountReportsByStatus 按状态统计举报数
+func (d *Database) CountReportsByStatus() (map[string]int, error) {
+	rows, err := d.db.Query(`SELECT status, COUNT(*) FROM reports GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
 		}
-		violations = append(violations, v)
+		counts[status] = count
 	}
 
-	return violations, nil
+	return counts, nil
 }
 
 // 群组设置相关函数
 func (d *Database) GetGroupSettings(chatID int64) (*GroupSettings, error) {
-	query := `SELECT chat_id, welcome_message, verification_enabled, question, answer, timeout, updated_at 
+	query := `SELECT chat_id, welcome_message, COALESCE(welcome_parse_mode, ''),
+			  COALESCE(welcome_media, ''), COALESCE(welcome_media_type, ''),
+			  verification_enabled, question, answer, timeout,
+			  COALESCE(verification_mode, 'group'), COALESCE(cleanup_delay, 0),
+			  COALESCE(delete_service_messages, 0), COALESCE(warnings_enabled, 0),
+			  COALESCE(warning_ladder, ''), COALESCE(warning_expiry, 0), COALESCE(purge_window, 0),
+			  COALESCE(raid_enabled, 0), COALESCE(raid_threshold, 0), COALESCE(raid_window, 0), COALESCE(raid_lockdown, 0),
+			  COALESCE(raid_restrict_chat, 0), COALESCE(screening_enabled, 0), COALESCE(screening_threshold, 0),
+			  COALESCE(screening_action, ''), COALESCE(screening_restrict_hours, 0), COALESCE(screening_new_account_id, 0),
+			  COALESCE(probation_enabled, 0), COALESCE(probation_duration, 0), COALESCE(probation_messages, 0),
+			  COALESCE(night_mode_enabled, 0), COALESCE(night_mode_start, ''), COALESCE(night_mode_end, ''), COALESCE(night_mode_days, ''),
+			  COALESCE(night_mode_timezone, ''), COALESCE(night_mode_profile, ''),
+			  COALESCE(media_policy, ''), COALESCE(document_blocklist, ''),
+			  COALESCE(forward_channel_policy, ''), COALESCE(forward_channel_allowlist, ''), COALESCE(forward_blocklist, ''),
+			  COALESCE(forward_block_hidden, 0), COALESCE(forward_action, ''), updated_at 
 			  FROM group_settings WHERE chat_id = ?`
 
 	var settings GroupSettings
 	err := d.db.QueryRow(query, chatID).Scan(
 		&settings.ChatID,
 		&settings.WelcomeMessage,
+		&settings.WelcomeParseMode,
+		&settings.WelcomeMedia,
+		&settings.WelcomeMediaType,
 		&settings.VerificationEnabled,
 		&settings.Question,
 		&settings.Answer,
 		&settings.Timeout,
+		&settings.VerificationMode,
+		&settings.CleanupDelay,
+		&settings.DeleteServiceMessages,
+		&settings.WarningsEnabled,
+		&settings.WarningLadder,
+		&settings.WarningExpiry,
+		&settings.PurgeWindow,
+		&settings.RaidEnabled,
+		&settings.RaidThreshold,
+		&settings.RaidWindow,
+		&settings.RaidLockdown,
+		&settings.RaidRestrictChat,
+		&settings.ScreeningEnabled,
+		&settings.ScreeningThreshold,
+		&settings.ScreeningAction,
+		&settings.ScreeningRestrictHours,
+		&settings.ScreeningNewAccountID,
+		&settings.ProbationEnabled,
+		&settings.ProbationDuration,
+		&settings.ProbationMessages,
+		&settings.NightModeEnabled,
+		&settings.NightModeStart,
+		&settings.NightModeEnd,
+		&settings.NightModeDays,
+		&settings.NightModeTimezone,
+		&settings.NightModeProfile,
+		&settings.MediaPolicy,
+		&settings.DocumentBlocklist,
+		&settings.ForwardChannelPolicy,
+		&settings.ForwardChannelAllowlist,
+		&settings.ForwardBlocklist,
+		&settings.ForwardBlockHidden,
+		&settings.ForwardAction,
 		&settings.UpdatedAt,
 	)
 
@@ -262,16 +1596,65 @@ func (d *Database) GetGroupSettings(chatID int64) (*GroupSettings, error) {
 
 func (d *Database) UpdateGroupSettings(settings *GroupSettings) error {
 	query := `INSERT OR REPLACE INTO group_settings 
-			  (chat_id, welcome_message, verification_enabled, question, answer, timeout, updated_at)
-			  VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+			  (chat_id, welcome_message, welcome_parse_mode, welcome_media, welcome_media_type,
+			  verification_enabled, question, answer, timeout, verification_mode,
+			  cleanup_delay, delete_service_messages, warnings_enabled, warning_ladder, warning_expiry,
+			  purge_window, raid_enabled, raid_threshold, raid_window, raid_lockdown, raid_restrict_chat,
+			  screening_enabled, screening_threshold, screening_action, screening_restrict_hours, screening_new_account_id,
+			  probation_enabled, probation_duration, probation_messages,
+			  night_mode_enabled, night_mode_start, night_mode_end, night_mode_days, night_mode_timezone, night_mode_profile,
+			  media_policy, document_blocklist,
+			  forward_channel_policy, forward_channel_allowlist, forward_blocklist, forward_block_hidden, forward_action,
+			  updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+
+	if settings.VerificationMode == "" {
+		settings.VerificationMode = "group"
+	}
 
 	_, err := d.db.Exec(query,
 		settings.ChatID,
 		settings.WelcomeMessage,
+		settings.WelcomeParseMode,
+		settings.WelcomeMedia,
+		settings.WelcomeMediaType,
 		settings.VerificationEnabled,
 		settings.Question,
 		settings.Answer,
 		settings.Timeout,
+		settings.VerificationMode,
+		settings.CleanupDelay,
+		settings.DeleteServiceMessages,
+		settings.WarningsEnabled,
+		settings.WarningLadder,
+		settings.WarningExpiry,
+		settings.PurgeWindow,
+		settings.RaidEnabled,
+		settings.RaidThreshold,
+		settings.RaidWindow,
+		settings.RaidLockdown,
+		settings.RaidRestrictChat,
+		settings.ScreeningEnabled,
+		settings.ScreeningThreshold,
+		settings.ScreeningAction,
+		settings.ScreeningRestrictHours,
+		settings.ScreeningNewAccountID,
+		settings.ProbationEnabled,
+		settings.ProbationDuration,
+		settings.ProbationMessages,
+		settings.NightModeEnabled,
+		settings.NightModeStart,
+		settings.NightModeEnd,
+		settings.NightModeDays,
+		settings.NightModeTimezone,
+		settings.NightModeProfile,
+		settings.MediaPolicy,
+		settings.DocumentBlocklist,
+		settings.ForwardChannelPolicy,
+		settings.ForwardChannelAllowlist,
+		settings.ForwardBlocklist,
+		settings.ForwardBlockHidden,
+		settings.ForwardAction,
 	)
 
 	return err
@@ -280,12 +1663,14 @@ func (d *Database) UpdateGroupSettings(settings *GroupSettings) error {
 // 添加消息记录
 func (d *Database) LogMessage(msg *Message) error {
 	query := `INSERT INTO messages (
-		timestamp, chat_id, chat_title, user_name, from_user_id,
-		message_type, message_content, file_path
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		timestamp, message_id, chat_id, chat_title, user_name, from_user_id,
+		message_type, message_content, file_path,
+		forward_type, forward_from_id, forward_from
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	_, err := d.db.Exec(query,
 		msg.Timestamp,
+		msg.MessageID,
 		msg.ChatID,
 		msg.ChatTitle,
 		msg.UserName,
@@ -293,15 +1678,43 @@ func (d *Database) LogMessage(msg *Message) error {
 		msg.MessageType,
 		msg.MessageContent,
 		msg.FilePath,
+		msg.ForwardType,
+		msg.ForwardFromID,
+		msg.ForwardFrom,
 	)
 	return err
 }
 
+// 获取用户在群组中 since 之后发送的消息ID
+func (d *Database) GetUserMessageIDs(chatID, userID int64, since time.Time) ([]int, error) {
+	query := `SELECT message_id FROM messages
+		WHERE chat_id = ? AND from_user_id = ? AND message_id > 0 AND timestamp >= ?
+		ORDER BY message_id`
+	rows, err := d.db.Query(query, chatID, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
 // 获取消息列表
 func (d *Database) GetMessages(chatID int64, page, perPage int, messageType string) ([]Message, int, error) {
 	// 构建基础查询
-	baseQuery := `SELECT id, timestamp, chat_id, chat_title, user_name, 
-		from_user_id, message_type, message_content, file_path 
+	baseQuery := `SELECT id, timestamp, COALESCE(message_id, 0), chat_id, chat_title, user_name, 
+		from_user_id, message_type, message_content, file_path,
+		COALESCE(forward_type, ''), COALESCE(forward_from_id, 0), COALESCE(forward_from, ''),
+		(SELECT COUNT(*) FROM message_edits e WHERE e.chat_id = messages.chat_id AND e.message_id = messages.message_id AND messages.message_id != 0)
 		FROM messages WHERE 1=1`
 	countQuery := `SELECT COUNT(*) FROM messages WHERE 1=1`
 	var params []interface{}
@@ -343,6 +1756,7 @@ func (d *Database) GetMessages(chatID int64, page, perPage int, messageType stri
 		err := rows.Scan(
 			&msg.ID,
 			&msg.Timestamp,
+			&msg.MessageID,
 			&msg.ChatID,
 			&msg.ChatTitle,
 			&msg.UserName,
@@ -350,6 +1764,10 @@ func (d *Database) GetMessages(chatID int64, page, perPage int, messageType stri
 			&msg.MessageType,
 			&msg.MessageContent,
 			&msg.FilePath,
+			&msg.ForwardType,
+			&msg.ForwardFromID,
+			&msg.ForwardFrom,
+			&msg.EditCount,
 		)
 		if err != nil {
 			return nil, 0, err
@@ -360,6 +1778,36 @@ func (d *Database) GetMessages(chatID int64, page, perPage int, messageType stri
 	return messages, total, nil
 }
 
+// LogMessageEdit 记录消息的一次编辑
+func (d *Database) LogMessageEdit(edit *MessageEdit) error {
+	query := `INSERT INTO message_edits (chat_id, message_id, user_name, from_user_id, message_content, edited_at)
+			  VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := d.db.Exec(query, edit.ChatID, edit.MessageID, edit.UserName, edit.FromUserID, edit.MessageContent, edit.EditedAt)
+	return err
+}
+
+// GetMessageEdits 获取消息的编辑历史，按时间顺序排列
+func (d *Database) GetMessageEdits(chatID int64, messageID int) ([]MessageEdit, error) {
+	query := `SELECT id, chat_id, message_id, COALESCE(user_name, ''), from_user_id, COALESCE(message_content, ''), edited_at
+			  FROM message_edits WHERE chat_id = ? AND message_id = ? ORDER BY edited_at, id`
+	rows, err := d.db.Query(query, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []MessageEdit
+	for rows.Next() {
+		var e MessageEdit
+		if err := rows.Scan(&e.ID, &e.ChatID, &e.MessageID, &e.UserName, &e.FromUserID, &e.MessageContent, &e.EditedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+
+	return edits, nil
+}
+
 // 获取所有群组列表
 func (d *Database) GetAllChats() ([]struct {
 	ChatID int64  `json:"chat_id"`
@@ -408,6 +1856,31 @@ func (d *Database) Migrate() error {
 		log.Printf("✅ 已添加 keywords.is_active 列")
 	}
 
+	keywordColumns := []struct{ name, definition string }{
+		{"duration", "INTEGER DEFAULT 0"},
+		{"delete_message", "BOOLEAN DEFAULT 1"},
+		{"notify_admin", "BOOLEAN DEFAULT 1"},
+		{"purge_recent", "BOOLEAN DEFAULT 0"},
+	}
+	for _, c := range keywordColumns {
+		if err := d.addColumnIfMissing("keywords", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// messages 表
+	messageColumns := []struct{ name, definition string }{
+		{"message_id", "INTEGER DEFAULT 0"},
+		{"forward_type", "TEXT DEFAULT ''"},
+		{"forward_from_id", "INTEGER DEFAULT 0"},
+		{"forward_from", "TEXT DEFAULT ''"},
+	}
+	for _, c := range messageColumns {
+		if err := d.addColumnIfMissing("messages", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
 	// 2. 创建新表（如果不存在）
 	// chats 表
 	if !d.tableExists("chats") {
@@ -431,10 +1904,46 @@ func (d *Database) Migrate() error {
 		CREATE TABLE group_settings (
 			chat_id INTEGER PRIMARY KEY,
 			welcome_message TEXT,
+			welcome_parse_mode TEXT DEFAULT '',
+			welcome_media TEXT DEFAULT '',
+			welcome_media_type TEXT DEFAULT '',
 			verification_enabled BOOLEAN DEFAULT 1,
 			question TEXT,
 			answer TEXT,
 			timeout INTEGER DEFAULT 300,
+			verification_mode TEXT DEFAULT 'group',
+			cleanup_delay INTEGER DEFAULT 0,
+			delete_service_messages BOOLEAN DEFAULT 0,
+			purge_window INTEGER DEFAULT 0,
+			warnings_enabled BOOLEAN DEFAULT 0,
+			warning_ladder TEXT DEFAULT '',
+			warning_expiry INTEGER DEFAULT 0,
+			raid_enabled BOOLEAN DEFAULT 0,
+			raid_threshold INTEGER DEFAULT 0,
+			raid_window INTEGER DEFAULT 0,
+			raid_lockdown INTEGER DEFAULT 0,
+			raid_restrict_chat BOOLEAN DEFAULT 0,
+			screening_enabled BOOLEAN DEFAULT 0,
+			screening_threshold INTEGER DEFAULT 0,
+			screening_action TEXT DEFAULT '',
+			screening_restrict_hours INTEGER DEFAULT 0,
+			screening_new_account_id INTEGER DEFAULT 0,
+			probation_enabled BOOLEAN DEFAULT 0,
+			probation_duration INTEGER DEFAULT 0,
+			probation_messages INTEGER DEFAULT 0,
+			night_mode_enabled BOOLEAN DEFAULT 0,
+			night_mode_start TEXT DEFAULT '',
+			night_mode_end TEXT DEFAULT '',
+			night_mode_days TEXT DEFAULT '',
+			night_mode_timezone TEXT DEFAULT '',
+			night_mode_profile TEXT DEFAULT '',
+			media_policy TEXT DEFAULT '',
+			document_blocklist TEXT DEFAULT '',
+			forward_channel_policy TEXT DEFAULT '',
+			forward_channel_allowlist TEXT DEFAULT '',
+			forward_blocklist TEXT DEFAULT '',
+			forward_block_hidden BOOLEAN DEFAULT 0,
+			forward_action TEXT DEFAULT '',
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);`
 		_, err = d.db.Exec(groupSettingsSchema)
@@ -444,6 +1953,51 @@ func (d *Database) Migrate() error {
 		log.Printf("✅ 已创建 group_settings 表")
 	}
 
+	// group_settings 表新增的列
+	groupSettingsColumns := []struct{ name, definition string }{
+		{"verification_mode", "TEXT DEFAULT 'group'"},
+		{"cleanup_delay", "INTEGER DEFAULT 0"},
+		{"delete_service_messages", "BOOLEAN DEFAULT 0"},
+		{"welcome_parse_mode", "TEXT DEFAULT ''"},
+		{"welcome_media", "TEXT DEFAULT ''"},
+		{"welcome_media_type", "TEXT DEFAULT ''"},
+		{"warnings_enabled", "BOOLEAN DEFAULT 0"},
+		{"warning_ladder", "TEXT DEFAULT ''"},
+		{"warning_expiry", "INTEGER DEFAULT 0"},
+		{"purge_window", "INTEGER DEFAULT 0"},
+		{"raid_enabled", "BOOLEAN DEFAULT 0"},
+		{"raid_threshold", "INTEGER DEFAULT 0"},
+		{"raid_window", "INTEGER DEFAULT 0"},
+		{"raid_lockdown", "INTEGER DEFAULT 0"},
+		{"raid_restrict_chat", "BOOLEAN DEFAULT 0"},
+		{"screening_enabled", "BOOLEAN DEFAULT 0"},
+		{"screening_threshold", "INTEGER DEFAULT 0"},
+		{"screening_action", "TEXT DEFAULT ''"},
+		{"screening_restrict_hours", "INTEGER DEFAULT 0"},
+		{"screening_new_account_id", "INTEGER DEFAULT 0"},
+		{"probation_enabled", "BOOLEAN DEFAULT 0"},
+		{"probation_duration", "INTEGER DEFAULT 0"},
+		{"probation_messages", "INTEGER DEFAULT 0"},
+		{"night_mode_enabled", "BOOLEAN DEFAULT 0"},
+		{"night_mode_start", "TEXT DEFAULT ''"},
+		{"night_mode_end", "TEXT DEFAULT ''"},
+		{"night_mode_days", "TEXT DEFAULT ''"},
+		{"night_mode_timezone", "TEXT DEFAULT ''"},
+		{"night_mode_profile", "TEXT DEFAULT ''"},
+		{"media_policy", "TEXT DEFAULT ''"},
+		{"document_blocklist", "TEXT DEFAULT ''"},
+		{"forward_channel_policy", "TEXT DEFAULT ''"},
+		{"forward_channel_allowlist", "TEXT DEFAULT ''"},
+		{"forward_blocklist", "TEXT DEFAULT ''"},
+		{"forward_block_hidden", "BOOLEAN DEFAULT 0"},
+		{"forward_action", "TEXT DEFAULT ''"},
+	}
+	for _, c := range groupSettingsColumns {
+		if err := d.addColumnIfMissing("group_settings", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
 	// violations 表
 	if !d.tableExists("violations") {
 		violationSchema := `
@@ -500,6 +2054,25 @@ func (d *Database) getTableColumns(tableName string) ([]string, error) {
 	return columns, nil
 }
 
+// 列不存在时添加列
+func (d *Database) addColumnIfMissing(table, column, definition string) error {
+	columns, err := d.getTableColumns(table)
+	if err != nil {
+		return err
+	}
+
+	if containsColumn(columns, column) {
+		return nil
+	}
+
+	_, err = d.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ 已添加 %s.%s 列", table, column)
+	return nil
+}
+
 // 检查列是否存在
 func containsColumn(columns []string, column string) bool {
 	for _, c := range columns {
@@ -526,6 +2099,28 @@ func (d *Database) UpsertChat(chat *Chat) error {
 	return err
 }
 
+// GetGroupChats 获取机器人所在的所有群组
+func (d *Database) GetGroupChats() ([]Chat, error) {
+	query := `SELECT chat_id, title, type, created_at FROM chats
+			  WHERE type IN ('group', 'supergroup') ORDER BY title`
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []Chat
+	for rows.Next() {
+		var chat Chat
+		if err := rows.Scan(&chat.ChatID, &chat.Title, &chat.Type, &chat.CreatedAt); err != nil {
+			return nil, err
+		}
+		chats = append(chats, chat)
+	}
+
+	return chats, nil
+}
+
 // GetChat 获取群组信息
 func (d *Database) GetChat(chatID int64) (*Chat, error) {
 	query := `SELECT chat_id, title, type, created_at FROM chats WHERE chat_id = ?`
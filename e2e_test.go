@@ -0,0 +1,654 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 端到端测试使用的群组和用户
+const (
+	e2eGroupID = -1001
+	e2eAdminID = 1
+)
+
+var (
+	e2eAdmin = tgbotapi.User{ID: e2eAdminID, FirstName: "Admin", UserName: "admin"}
+	e2eAlice = tgbotapi.User{ID: 42, FirstName: "Alice", UserName: "alice"}
+	e2eBob   = tgbotapi.User{ID: 43, FirstName: "Bob", UserName: "bob"}
+)
+
+// e2eHarness 连接到模拟 Bot API 并已启动的机器人
+type e2eHarness struct {
+	t   *testing.T
+	api *fakeBotAPI
+	tb  *TelegramBot
+	db  *Database
+}
+
+// newE2EHarness 启动机器人，configure 可以在启动前修改配置；测试结束时停止机器人
+func newE2EHarness(t *testing.T, configure func(*Config)) *e2eHarness {
+	t.Helper()
+	api := newFakeBotAPI(t)
+
+	config := &Config{}
+	config.Telegram.BotToken = fakeBotToken
+	config.Telegram.AdminUserID = e2eAdminID
+	config.Telegram.APIEndpoint = api.endpoint()
+	config.Settings.DefaultAction = ActionMute
+	config.Settings.MuteDuration = 3600
+	config.Settings.LogViolations = true
+	config.Groups.DefaultSettings.WelcomeMessage = "欢迎加入"
+	if configure != nil {
+		configure(config)
+	}
+
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatalf("打开数据库失败：%v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("迁移数据库失败：%v", err)
+	}
+
+	tb, err := NewTelegramBot(config, db)
+	if err != nil {
+		t.Fatalf("创建机器人失败：%v", err)
+	}
+	tb.bot.Debug = false
+
+	done := make(chan struct{})
+	go func() {
+		tb.Start()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		tb.Stop()
+		select {
+		case <-done:
+		case <-time.After(fakeWaitTimeout):
+			t.Error("机器人没有在超时前停止")
+		}
+		db.Close()
+	})
+
+	return &e2eHarness{t: t, api: api, tb: tb, db: db}
+}
+
+// newMessage 构造一条消息，以 / 开头的文本标记为命令
+func (h *e2eHarness) newMessage(chat *tgbotapi.Chat, from tgbotapi.User, text string) *tgbotapi.Message {
+	message := &tgbotapi.Message{
+		MessageID: h.api.newMessageID(),
+		From:      &from,
+		Chat:      chat,
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command := strings.Fields(text)[0]
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	return message
+}
+
+// sendGroup 注入一条群组消息
+func (h *e2eHarness) sendGroup(from tgbotapi.User, text string) *tgbotapi.Message {
+	message := h.newMessage(&tgbotapi.Chat{ID: e2eGroupID, Type: "supergroup", Title: "Test Group"}, from, text)
+	h.api.inject(tgbotapi.Update{Message: message})
+	return message
+}
+
+// sendPrivate 注入一条私聊消息
+func (h *e2eHarness) sendPrivate(from tgbotapi.User, text string) *tgbotapi.Message {
+	message := h.newMessage(&tgbotapi.Chat{ID: from.ID, Type: "private", FirstName: from.FirstName}, from, text)
+	h.api.inject(tgbotapi.Update{Message: message})
+	return message
+}
+
+// join 注入用户加入群组的 chat_member 更新
+func (h *e2eHarness) join(user tgbotapi.User) {
+	h.api.inject(tgbotapi.Update{ChatMember: &tgbotapi.ChatMemberUpdated{
+		Chat:          tgbotapi.Chat{ID: e2eGroupID, Type: "supergroup", Title: "Test Group"},
+		From:          user,
+		Date:          int(time.Now().Unix()),
+		OldChatMember: tgbotapi.ChatMember{User: &user, Status: "left"},
+		NewChatMember: tgbotapi.ChatMember{User: &user, Status: "member"},
+	}})
+}
+
+// click 注入按钮回调
+func (h *e2eHarness) click(id string, from tgbotapi.User, message *tgbotapi.Message, data string) {
+	h.api.inject(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      id,
+		From:    &from,
+		Message: message,
+		Data:    data,
+	}})
+}
+
+// waitRestrict 等待对用户的限制请求，canSend 区分禁言和解除禁言
+func (h *e2eHarness) waitRestrict(userID int64, canSend bool) url.Values {
+	h.t.Helper()
+	return h.api.waitFor("restrictChatMember", func(p url.Values) bool {
+		return isRestrictOf(p, userID, canSend)
+	})
+}
+
+// waitBan 等待封禁用户的请求
+func (h *e2eHarness) waitBan(userID int64) url.Values {
+	h.t.Helper()
+	return h.api.waitFor("banChatMember", func(p url.Values) bool {
+		return p.Get("chat_id") == strconv.Itoa(e2eGroupID) && p.Get("user_id") == strconv.FormatInt(userID, 10)
+	})
+}
+
+func isRestrictOf(p url.Values, userID int64, canSend bool) bool {
+	if p.Get("chat_id") != strconv.Itoa(e2eGroupID) || p.Get("user_id") != strconv.FormatInt(userID, 10) {
+		return false
+	}
+	var permissions tgbotapi.ChatPermissions
+	if err := json.Unmarshal([]byte(p.Get("permissions")), &permissions); err != nil {
+		return false
+	}
+	return permissions.CanSendMessages == canSend
+}
+
+// triggerViolation 添加关键词并让 Alice 触发，返回发给管理员的违规通知
+func (h *e2eHarness) triggerViolation() (*tgbotapi.Message, url.Values) {
+	h.t.Helper()
+	keyword := &Keyword{Keyword: "加群", MatchType: "fuzzy", Action: ActionMute, DeleteMessage: true, NotifyAdmin: true}
+	if err := h.db.AddKeyword(keyword); err != nil {
+		h.t.Fatalf("添加关键词失败：%v", err)
+	}
+	if err := h.tb.reloadKeywords(); err != nil {
+		h.t.Fatalf("加载关键词失败：%v", err)
+	}
+
+	message := h.sendGroup(e2eAlice, "快来加群领红包")
+	notification := h.api.waitForText(e2eAdminID, "违规检测")
+	return message, notification
+}
+
+// buttonData 从发给管理员的通知中取出按钮的回调数据，并返回按钮所在的消息（消息ID为 999）
+func buttonData(t *testing.T, notification url.Values, text string) (*tgbotapi.Message, string) {
+	t.Helper()
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(notification.Get("reply_markup")), &markup); err != nil {
+		t.Fatalf("解析通知按钮失败：%v", err)
+	}
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if button.Text == text && button.CallbackData != nil {
+				message := &tgbotapi.Message{
+					MessageID:   999,
+					Chat:        &tgbotapi.Chat{ID: e2eAdminID, Type: "private"},
+					Text:        notification.Get("text"),
+					ReplyMarkup: &markup,
+				}
+				return message, *button.CallbackData
+			}
+		}
+	}
+	t.Fatalf("通知中没有「%s」按钮：%s", text, notification.Get("reply_markup"))
+	return nil, ""
+}
+
+func TestE2EVerificationSuccess(t *testing.T) {
+	h := newE2EHarness(t, func(c *Config) {
+		c.Groups.DefaultSettings.Verification.Enabled = true
+		c.Groups.DefaultSettings.Verification.Question = "1+1=?"
+		c.Groups.DefaultSettings.Verification.Answer = "2"
+		c.Groups.DefaultSettings.Verification.Timeout = 300
+	})
+
+	h.join(e2eAlice)
+	h.waitRestrict(e2eAlice.ID, false)
+	h.api.waitForText(e2eGroupID, "1+1=?")
+
+	h.sendGroup(e2eAlice, "2")
+	h.waitRestrict(e2eAlice.ID, true)
+	h.api.waitForText(e2eGroupID, "验证成功")
+
+	if len(h.api.requests("banChatMember")) != 0 {
+		t.Error("验证成功的用户不应被移出")
+	}
+	if h.tb.verification(e2eGroupID, e2eAlice.ID) != nil {
+		t.Error("验证成功后应清除验证状态")
+	}
+}
+
+func TestE2EVerificationFailure(t *testing.T) {
+	h := newE2EHarness(t, func(c *Config) {
+		c.Groups.DefaultSettings.Verification.Enabled = true
+		c.Groups.DefaultSettings.Verification.Question = "1+1=?"
+		c.Groups.DefaultSettings.Verification.Answer = "2"
+		c.Groups.DefaultSettings.Verification.Timeout = 300
+	})
+
+	h.join(e2eBob)
+	h.api.waitForText(e2eGroupID, "1+1=?")
+
+	h.sendGroup(e2eBob, "3")
+	h.api.waitForText(e2eGroupID, "还有 2 次机会")
+	h.sendGroup(e2eBob, "4")
+	h.api.waitForText(e2eGroupID, "还有 1 次机会")
+	h.sendGroup(e2eBob, "5")
+
+	// 移出而不是永久封禁：封禁后立即解封，用户之后可以重新加入
+	ban := h.waitBan(e2eBob.ID)
+	if until := ban.Get("until_date"); until != "" && until != "0" {
+		t.Errorf("移出用户时不应设置封禁期限：%s", until)
+	}
+	h.api.waitFor("unbanChatMember", func(p url.Values) bool {
+		return p.Get("chat_id") == strconv.Itoa(e2eGroupID) && p.Get("user_id") == strconv.FormatInt(e2eBob.ID, 10) &&
+			p.Get("only_if_banned") == "true"
+	})
+
+	for _, p := range h.api.requests("restrictChatMember") {
+		if isRestrictOf(p, e2eBob.ID, true) {
+			t.Error("验证失败的用户不应解除限制")
+		}
+	}
+}
+
+func TestE2EKeywordViolation(t *testing.T) {
+	h := newE2EHarness(t, nil)
+
+	message, notification := h.triggerViolation()
+
+	h.api.waitFor("deleteMessage", func(p url.Values) bool {
+		return p.Get("chat_id") == strconv.Itoa(e2eGroupID) && p.Get("message_id") == strconv.Itoa(message.MessageID)
+	})
+	h.waitRestrict(e2eAlice.ID, false)
+
+	if !strings.Contains(notification.Get("text"), "加群") {
+		t.Errorf("通知中没有触发的关键词：%q", notification.Get("text"))
+	}
+	if notification.Get("reply_markup") == "" {
+		t.Error("通知应附带处理按钮")
+	}
+
+	violations, err := h.db.GetViolations(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 {
+		t.Fatalf("违规记录 %d 条，期望 1 条", len(violations))
+	}
+	if v := violations[0]; v.UserID != e2eAlice.ID || v.ChatID != e2eGroupID || v.Keyword != "加群" || v.Action != ActionMute {
+		t.Errorf("违规记录不正确：%+v", v)
+	}
+
+	// 没有触发关键词的消息不处理
+	clean := h.sendGroup(e2eBob, "大家好")
+	h.waitProcessed()
+	for _, p := range h.api.requests("deleteMessage") {
+		if p.Get("message_id") == strconv.Itoa(clean.MessageID) {
+			t.Error("正常消息不应被删除")
+		}
+	}
+}
+
+func TestE2ECallbacks(t *testing.T) {
+	h := newE2EHarness(t, nil)
+
+	_, notification := h.triggerViolation()
+	h.waitRestrict(e2eAlice.ID, false)
+
+	notice, undo := buttonData(t, notification, "↩️ 撤销处理")
+
+	// 普通成员不能使用按钮
+	h.click("cb-denied", e2eBob, notice, undo)
+	h.api.waitFor("answerCallbackQuery", func(p url.Values) bool {
+		return p.Get("callback_query_id") == "cb-denied" && p.Get("text") == "你没有权限执行此操作"
+	})
+	for _, p := range h.api.requests("restrictChatMember") {
+		if isRestrictOf(p, e2eAlice.ID, true) {
+			t.Fatal("无权限的按钮操作不应解除禁言")
+		}
+	}
+
+	// 篡改过的按钮数据不执行
+	h.click("cb-forged", e2eAdmin, notice, undo[:len(undo)-1]+"x")
+	h.api.waitFor("answerCallbackQuery", func(p url.Values) bool {
+		return p.Get("callback_query_id") == "cb-forged"
+	})
+
+	// 管理员撤销禁言
+	h.api.setMemberStatus(e2eGroupID, e2eAlice.ID, "restricted")
+	h.click("cb-undo", e2eAdmin, notice, undo)
+	h.waitRestrict(e2eAlice.ID, true)
+	h.api.waitFor("editMessageText", func(p url.Values) bool {
+		return p.Get("message_id") == "999" && strings.Contains(p.Get("text"), "已解除禁言")
+	})
+	h.api.waitFor("answerCallbackQuery", func(p url.Values) bool {
+		return p.Get("callback_query_id") == "cb-undo" && p.Get("text") == "已解除禁言"
+	})
+
+	// 白名单中记录用户名而不是用户ID
+	_, allow := buttonData(t, notification, "✅ 加入白名单")
+	h.click("cb-allow", e2eAdmin, notice, allow)
+	h.api.waitFor("answerCallbackQuery", func(p url.Values) bool {
+		return p.Get("callback_query_id") == "cb-allow" && p.Get("text") == "已加入白名单"
+	})
+	entries, err := h.db.GetAllowlist(e2eGroupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Username != e2eAlice.UserName {
+		t.Errorf("白名单记录不正确：%+v", entries)
+	}
+}
+
+func TestE2EAdminCommands(t *testing.T) {
+	h := newE2EHarness(t, nil)
+
+	h.sendPrivate(e2eAdmin, "/add_keyword 广告 fuzzy ban")
+	h.api.waitForText(e2eAdminID, "✅ 关键词已添加")
+
+	h.sendPrivate(e2eAdmin, "/list_keywords")
+	h.api.waitForText(e2eAdminID, "关键词: 广告")
+
+	// 普通用户的私聊命令不处理；之后的 /start 回复说明前一条已处理完
+	h.sendPrivate(e2eBob, "/list_keywords")
+	h.sendPrivate(e2eBob, "/start verify_"+strconv.Itoa(e2eGroupID))
+	h.api.waitForText(e2eBob.ID, "没有待完成的入群验证")
+	for _, p := range h.api.requests("sendMessage") {
+		if p.Get("chat_id") == strconv.FormatInt(e2eBob.ID, 10) && strings.Contains(p.Get("text"), "关键词") {
+			t.Errorf("普通用户不应能查看关键词：%q", p.Get("text"))
+		}
+	}
+
+	// 新添加的关键词立即生效
+	h.sendGroup(e2eAlice, "出售广告位")
+	h.waitBan(e2eAlice.ID)
+
+	// 回复消息禁言
+	target := h.sendGroup(e2eBob, "大家好")
+	reply := h.newMessage(&tgbotapi.Chat{ID: e2eGroupID, Type: "supergroup", Title: "Test Group"}, e2eAdmin, "/mute 1h")
+	reply.ReplyToMessage = target
+	h.api.inject(tgbotapi.Update{Message: reply})
+
+	restrict := h.waitRestrict(e2eBob.ID, false)
+	until, _ := strconv.ParseInt(restrict.Get("until_date"), 10, 64)
+	if d := time.Until(time.Unix(until, 0)); d < 59*time.Minute || d > 61*time.Minute {
+		t.Errorf("禁言时长 %v，期望 1h", d)
+	}
+	h.api.waitFor("deleteMessage", func(p url.Values) bool {
+		return p.Get("message_id") == strconv.Itoa(target.MessageID)
+	})
+}
+
+// waitProcessed 管理员在群组中发送 /status 并等待回复；同一群组的更新按顺序处理，回复后之前的消息都已处理完
+func (h *e2eHarness) waitProcessed() {
+	h.t.Helper()
+	h.sendGroup(e2eAdmin, "/status")
+	h.api.waitForText(e2eGroupID, "机器人状态")
+}
+
+// assertNotEscalated 策略违规不应计入警告，也不应升级为禁言或封禁
+func (h *e2eHarness) assertNotEscalated(userID int64) {
+	h.t.Helper()
+	if len(h.api.requests("banChatMember")) != 0 {
+		h.t.Error("策略违规不应封禁用户")
+	}
+	for _, p := range h.api.requests("restrictChatMember") {
+		if isRestrictOf(p, userID, false) {
+			h.t.Error("策略违规不应禁言用户")
+		}
+	}
+	for _, p := range h.api.requests("sendMessage") {
+		if strings.Contains(p.Get("text"), "收到警告") {
+			h.t.Errorf("策略违规不应发出警告：%q", p.Get("text"))
+		}
+	}
+	count, err := h.db.CountActiveWarnings(e2eGroupID, userID)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if count != 0 {
+		h.t.Errorf("警告 %d 次，期望 0 次", count)
+	}
+}
+
+func TestE2EMediaPolicyWithWarnings(t *testing.T) {
+	h := newE2EHarness(t, func(c *Config) {
+		c.Groups.DefaultSettings.Warnings.Enabled = true
+		c.Groups.DefaultSettings.Warnings.Ladder = "warn,ban"
+		c.Groups.DefaultSettings.MediaPolicy = "sticker:delete"
+	})
+
+	var stickers []*tgbotapi.Message
+	for i := 0; i < 3; i++ {
+		message := h.newMessage(&tgbotapi.Chat{ID: e2eGroupID, Type: "supergroup", Title: "Test Group"}, e2eAlice, "")
+		message.Sticker = &tgbotapi.Sticker{FileID: "sticker"}
+		h.api.inject(tgbotapi.Update{Message: message})
+		stickers = append(stickers, message)
+	}
+	for _, sticker := range stickers {
+		id := strconv.Itoa(sticker.MessageID)
+		h.api.waitFor("deleteMessage", func(p url.Values) bool { return p.Get("message_id") == id })
+	}
+	h.waitProcessed()
+
+	h.assertNotEscalated(e2eAlice.ID)
+}
+
+func TestE2EForwardPolicyWithWarnings(t *testing.T) {
+	h := newE2EHarness(t, func(c *Config) {
+		c.Groups.DefaultSettings.Warnings.Enabled = true
+		c.Groups.DefaultSettings.Warnings.Ladder = "warn,ban"
+		c.Groups.DefaultSettings.Forward.ChannelPolicy = ForwardChannelBlock
+	})
+
+	var forwards []*tgbotapi.Message
+	for i := 0; i < 3; i++ {
+		message := h.newMessage(&tgbotapi.Chat{ID: e2eGroupID, Type: "supergroup", Title: "Test Group"}, e2eAlice, "看看这个")
+		message.ForwardFromChat = &tgbotapi.Chat{ID: -1002, Type: "channel", Title: "广告频道", UserName: "ads"}
+		message.ForwardDate = int(time.Now().Unix())
+		h.api.inject(tgbotapi.Update{Message: message})
+		forwards = append(forwards, message)
+	}
+	for _, forward := range forwards {
+		id := strconv.Itoa(forward.MessageID)
+		h.api.waitFor("deleteMessage", func(p url.Values) bool { return p.Get("message_id") == id })
+	}
+	h.waitProcessed()
+
+	h.assertNotEscalated(e2eAlice.ID)
+}
+
+// setChatPermissionsOf 解析 setChatPermissions 请求中的权限
+func setChatPermissionsOf(t *testing.T, p url.Values) tgbotapi.ChatPermissions {
+	t.Helper()
+	var permissions tgbotapi.ChatPermissions
+	if err := json.Unmarshal([]byte(p.Get("permissions")), &permissions); err != nil {
+		t.Fatalf("解析群组权限失败：%v", err)
+	}
+	return permissions
+}
+
+func TestE2ELockdownWithoutChatPermissions(t *testing.T) {
+	h := newE2EHarness(t, func(c *Config) {
+		c.Groups.DefaultSettings.Raid.RestrictChat = true
+		c.Groups.DefaultSettings.Raid.Lockdown = 30
+	})
+	// getChat 没有返回群组权限
+	h.api.handle("getChat", func(p url.Values) string {
+		return `{"ok":true,"result":{"id":` + p.Get("chat_id") + `,"type":"supergroup","title":"Test Group"}}`
+	})
+
+	h.sendGroup(e2eAdmin, "/lockdown")
+	h.api.waitForText(e2eGroupID, "防护模式")
+	h.sendGroup(e2eAdmin, "/unlock")
+	h.api.waitForText(e2eGroupID, "防护模式已解除")
+
+	requests := h.api.requests("setChatPermissions")
+	if len(requests) != 2 {
+		t.Fatalf("设置群组权限 %d 次，期望 2 次", len(requests))
+	}
+	if restored := setChatPermissionsOf(t, requests[1]); restored != *memberPermissions() {
+		t.Errorf("解除锁定后应恢复普通成员的权限：%+v", restored)
+	}
+}
+
+func TestE2ENightModeOverlapsLockdown(t *testing.T) {
+	baseline := tgbotapi.ChatPermissions{CanSendMessages: true, CanSendMediaMessages: true, CanSendPolls: true}
+	muted := *mutedPermissions()
+
+	tests := []struct {
+		name           string
+		nightEndsFirst bool
+		want           []tgbotapi.ChatPermissions // 每次设置的群组权限
+	}{
+		// 只读的夜间模式期间开始防护模式不会放宽为只能发文字
+		{"防护模式先结束", false, []tgbotapi.ChatPermissions{muted, muted, muted, baseline}},
+		{"夜间模式先结束", true, []tgbotapi.ChatPermissions{muted, muted, *textOnlyPermissions(), baseline}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newE2EHarness(t, func(c *Config) {
+				c.Groups.DefaultSettings.Raid.RestrictChat = true
+				c.Groups.DefaultSettings.NightMode.Profile = NightReadOnly
+			})
+			data, _ := json.Marshal(baseline)
+			h.api.handle("getChat", func(p url.Values) string {
+				return `{"ok":true,"result":{"id":` + p.Get("chat_id") + `,"type":"supergroup","title":"Test Group","permissions":` + string(data) + `}}`
+			})
+
+			settings, err := h.tb.getGroupSettings(e2eGroupID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			schedule, err := parseNightSchedule(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h.tb.startNightMode(e2eGroupID, settings, schedule)
+			if err := h.tb.startLockdown(e2eGroupID, settings, 30*time.Minute, "测试", e2eAdminID); err != nil {
+				t.Fatal(err)
+			}
+			endNight := func() {
+				night, err := h.db.GetNightMode(e2eGroupID)
+				if err != nil || night == nil {
+					t.Fatalf("夜间模式没有生效：%v", err)
+				}
+				h.tb.endNightMode(night)
+			}
+			if tt.nightEndsFirst {
+				endNight()
+				h.tb.endLockdown(e2eGroupID)
+			} else {
+				h.tb.endLockdown(e2eGroupID)
+				endNight()
+			}
+
+			if n := len(h.api.requests("getChat")); n != 1 {
+				t.Errorf("获取原有权限 %d 次，期望只在第一次修改时获取", n)
+			}
+			requests := h.api.requests("setChatPermissions")
+			if len(requests) != len(tt.want) {
+				t.Fatalf("设置群组权限 %d 次，期望 %d 次", len(requests), len(tt.want))
+			}
+			for i, p := range requests {
+				if got := setChatPermissionsOf(t, p); got != tt.want[i] {
+					t.Errorf("第 %d 次设置的权限为 %+v，期望 %+v", i+1, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestE2EReportButtons(t *testing.T) {
+	h := newE2EHarness(t, nil)
+
+	target := h.sendGroup(e2eBob, "加我私聊")
+	report := h.newMessage(&tgbotapi.Chat{ID: e2eGroupID, Type: "supergroup", Title: "Test Group"}, e2eAlice, "/report 广告")
+	report.ReplyToMessage = target
+	h.api.inject(tgbotapi.Update{Message: report})
+
+	notification := h.api.waitForText(e2eAdminID, "举报 #")
+	notice, ban := buttonData(t, notification, "⛔ 封禁")
+	if !strings.HasPrefix(ban, signedCallbackPrefix) {
+		t.Fatalf("举报按钮没有签名：%s", ban)
+	}
+
+	// 旧格式的按钮数据不带签名，不执行
+	h.click("cb-unsigned", e2eAdmin, notice, "report_ban_1")
+	h.api.waitFor("answerCallbackQuery", func(p url.Values) bool {
+		return p.Get("callback_query_id") == "cb-unsigned" && p.Get("text") == errCallbackExpired.Error()
+	})
+	if len(h.api.requests("banChatMember")) != 0 {
+		t.Fatal("未签名的举报按钮不应执行")
+	}
+
+	// 普通成员不能处理举报
+	h.click("cb-member", e2eBob, notice, ban)
+	h.api.waitFor("answerCallbackQuery", func(p url.Values) bool {
+		return p.Get("callback_query_id") == "cb-member" && p.Get("text") == "只有管理员可以处理举报"
+	})
+
+	h.click("cb-ban", e2eAdmin, notice, ban)
+	h.waitBan(e2eBob.ID)
+	h.api.waitFor("answerCallbackQuery", func(p url.Values) bool {
+		return p.Get("callback_query_id") == "cb-ban" && strings.HasPrefix(p.Get("text"), "已处理")
+	})
+}
+
+func TestE2EEditedMessageMediaPolicy(t *testing.T) {
+	h := newE2EHarness(t, func(c *Config) {
+		c.Groups.DefaultSettings.MediaPolicy = "blocked_document:delete"
+		c.Groups.DefaultSettings.DocumentBlocklist = "exe"
+	})
+
+	// 先发送正常的文件，再把文件替换为被屏蔽的类型
+	message := h.newMessage(&tgbotapi.Chat{ID: e2eGroupID, Type: "supergroup", Title: "Test Group"}, e2eAlice, "")
+	message.Document = &tgbotapi.Document{FileID: "doc", FileName: "readme.txt"}
+	h.api.inject(tgbotapi.Update{Message: message})
+	h.waitProcessed()
+	if len(h.api.requests("deleteMessage")) != 0 {
+		t.Fatal("正常的文件不应被删除")
+	}
+
+	edited := *message
+	edited.Document = &tgbotapi.Document{FileID: "exe", FileName: "setup.exe"}
+	edited.EditDate = int(time.Now().Unix())
+	h.api.inject(tgbotapi.Update{EditedMessage: &edited})
+
+	h.api.waitFor("deleteMessage", func(p url.Values) bool {
+		return p.Get("message_id") == strconv.Itoa(message.MessageID)
+	})
+}
+
+func TestE2EProbationBlocksStickersAndPolls(t *testing.T) {
+	h := newE2EHarness(t, func(c *Config) {
+		c.Groups.DefaultSettings.Probation.Enabled = true
+		c.Groups.DefaultSettings.Probation.Duration = 60
+		c.Groups.DefaultSettings.Probation.Messages = 5
+	})
+
+	h.join(e2eAlice)
+	h.api.waitForText(e2eGroupID, "欢迎加入")
+
+	group := &tgbotapi.Chat{ID: e2eGroupID, Type: "supergroup", Title: "Test Group"}
+	sticker := h.newMessage(group, e2eAlice, "")
+	sticker.Sticker = &tgbotapi.Sticker{FileID: "sticker"}
+	poll := h.newMessage(group, e2eAlice, "")
+	poll.Poll = &tgbotapi.Poll{ID: "poll", Question: "加群领红包？"}
+	h.api.inject(tgbotapi.Update{Message: sticker})
+	h.api.inject(tgbotapi.Update{Message: poll})
+
+	for _, message := range []*tgbotapi.Message{sticker, poll} {
+		id := strconv.Itoa(message.MessageID)
+		h.api.waitFor("deleteMessage", func(p url.Values) bool { return p.Get("message_id") == id })
+	}
+	h.api.waitForText(e2eGroupID, "不能发送贴纸")
+	h.api.waitForText(e2eGroupID, "不能发送投票")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// messageText 消息的文字内容，媒体消息使用说明文字
+func messageText(message *tgbotapi.Message) string {
+	if message.Text != "" {
+		return message.Text
+	}
+	return message.Caption
+}
+
+// handleEditedMessage 处理群组消息和频道消息的编辑：记录编辑历史，并对编辑后的内容重新检查，
+// 防止先发送正常内容、之后再编辑成广告
+func (tb *TelegramBot) handleEditedMessage(message *tgbotapi.Message) {
+	if !message.Chat.IsGroup() && !message.Chat.IsSuperGroup() && !message.Chat.IsChannel() {
+		return
+	}
+
+	senderID, senderName := messageSender(message)
+	text := messageText(message)
+
+	editedAt := time.Now()
+	if message.EditDate != 0 {
+		editedAt = time.Unix(int64(message.EditDate), 0)
+	}
+
+	edit := &MessageEdit{
+		ChatID:         message.Chat.ID,
+		MessageID:      message.MessageID,
+		UserName:       senderName,
+		FromUserID:     senderID,
+		MessageContent: text,
+		EditedAt:       editedAt,
+	}
+	if err := tb.db.LogMessageEdit(edit); err != nil {
+		log.Printf("记录消息编辑失败：%v", err)
+	}
+
+	// 成员的消息与新消息走相同的检查，包括观察期限制、媒体和转发策略以及说明文字；管理员不检查
+	if message.From != nil {
+		if message.From.ID == tb.config.Telegram.AdminUserID {
+			return
+		}
+		tb.moderateMessage(message, true)
+		return
+	}
+
+	// 频道消息没有发送者，只检查关键词
+	if text == "" {
+		return
+	}
+
+	result := tb.filter.CheckMessage(text)
+	if result.IsViolation {
+		log.Printf("%s (ID: %d) 在 %d 中编辑的消息 %d 违规", senderName, senderID, message.Chat.ID, message.MessageID)
+		tb.handleViolation(message, result, text)
+	}
+}
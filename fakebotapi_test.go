@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 模拟的 Bot API 中机器人自身的信息
+const (
+	fakeBotID       = 1000
+	fakeBotUsername = "test_bot"
+	fakeBotToken    = "1000:test"
+)
+
+// fakeWaitTimeout 等待机器人发出请求的最长时间
+const fakeWaitTimeout = 5 * time.Second
+
+// fakeCall 机器人发出的一次请求
+type fakeCall struct {
+	Method string
+	Params url.Values
+}
+
+// fakeBotAPI 基于 httptest 的 Bot API：记录机器人发出的请求，为 getUpdates 提供注入的更新，
+// 常用方法返回合理的结果，其余方法返回 true，也可以按方法名覆盖响应
+type fakeBotAPI struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu            sync.Mutex
+	calls         []fakeCall
+	handlers      map[string]func(url.Values) string
+	updates       []tgbotapi.Update
+	nextUpdateID  int
+	nextMessageID int
+	members       map[string]string       // 群组成员的状态，键为 chatID:userID，默认 member
+	users         map[int64]tgbotapi.User // 注入的更新中出现过的用户，getChatMember 返回其资料
+	updateSignal  chan struct{}
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	f := &fakeBotAPI{
+		t:             t,
+		handlers:      make(map[string]func(url.Values) string),
+		nextUpdateID:  1,
+		nextMessageID: 1,
+		members:       make(map[string]string),
+		users:         make(map[int64]tgbotapi.User),
+		updateSignal:  make(chan struct{}, 1),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// endpoint 配置 api_endpoint 使用的地址
+func (f *fakeBotAPI) endpoint() string {
+	return f.server.URL + "/bot%s/%s"
+}
+
+// bot 连接到模拟服务器的 BotAPI
+func (f *fakeBotAPI) bot() *tgbotapi.BotAPI {
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(fakeBotToken, f.endpoint())
+	if err != nil {
+		f.t.Fatalf("连接模拟的 Bot API 失败：%v", err)
+	}
+	return bot
+}
+
+// handle 覆盖某个方法的响应，handler 返回完整的响应 JSON
+func (f *fakeBotAPI) handle(method string, handler func(url.Values) string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[method] = handler
+}
+
+// setMemberStatus 设置 getChatMember 返回的成员状态，如 administrator、restricted、kicked
+func (f *fakeBotAPI) setMemberStatus(chatID, userID int64, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members[fmt.Sprintf("%d:%d", chatID, userID)] = status
+}
+
+// inject 注入一个更新，由下一次 getUpdates 返回；UpdateID 自动分配
+func (f *fakeBotAPI) inject(update tgbotapi.Update) {
+	f.mu.Lock()
+	if update.Message != nil && update.Message.From != nil {
+		f.users[update.Message.From.ID] = *update.Message.From
+	}
+	if update.ChatMember != nil && update.ChatMember.NewChatMember.User != nil {
+		f.users[update.ChatMember.NewChatMember.User.ID] = *update.ChatMember.NewChatMember.User
+	}
+	update.UpdateID = f.nextUpdateID
+	f.nextUpdateID++
+	f.updates = append(f.updates, update)
+	f.mu.Unlock()
+
+	select {
+	case f.updateSignal <- struct{}{}:
+	default:
+	}
+}
+
+// newMessageID 分配消息ID，注入的消息和机器人发送的消息共用，避免重复
+func (f *fakeBotAPI) newMessageID() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.nextMessageID
+	f.nextMessageID++
+	return id
+}
+
+// requests 某个方法收到的所有请求参数
+func (f *fakeBotAPI) requests(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var params []url.Values
+	for _, call := range f.calls {
+		if call.Method == method {
+			params = append(params, call.Params)
+		}
+	}
+	return params
+}
+
+// waitFor 等待机器人发出满足条件的请求，超时时测试失败
+func (f *fakeBotAPI) waitFor(method string, match func(url.Values) bool) url.Values {
+	f.t.Helper()
+	deadline := time.Now().Add(fakeWaitTimeout)
+	for time.Now().Before(deadline) {
+		for _, params := range f.requests(method) {
+			if match == nil || match(params) {
+				return params
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.t.Fatalf("等待 %s 请求超时，已收到的请求：%s", method, f.describeCalls())
+	return nil
+}
+
+// waitForText 等待发送到 chatID 且包含 text 的消息
+func (f *fakeBotAPI) waitForText(chatID int64, text string) url.Values {
+	f.t.Helper()
+	return f.waitFor("sendMessage", func(p url.Values) bool {
+		return p.Get("chat_id") == strconv.FormatInt(chatID, 10) && strings.Contains(p.Get("text"), text)
+	})
+}
+
+func (f *fakeBotAPI) describeCalls() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var methods []string
+	for _, call := range f.calls {
+		if call.Method != "getUpdates" {
+			methods = append(methods, call.Method)
+		}
+	}
+	return strings.Join(methods, ", ")
+}
+
+func (f *fakeBotAPI) serve(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeCall{Method: method, Params: r.Form})
+	handler, ok := f.handlers[method]
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		fmt.Fprint(w, handler(r.Form))
+		return
+	}
+
+	result, err := f.result(method, r.Form)
+	if err != nil {
+		fmt.Fprintf(w, `{"ok":false,"error_code":400,"description":%q}`, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+// result 各方法的默认结果
+func (f *fakeBotAPI) result(method string, params url.Values) (interface{}, error) {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	userID, _ := strconv.ParseInt(params.Get("user_id"), 10, 64)
+
+	switch method {
+	case "getMe":
+		return tgbotapi.User{ID: fakeBotID, IsBot: true, FirstName: "Test", UserName: fakeBotUsername}, nil
+	case "getUpdates":
+		return f.pendingUpdates(params), nil
+	case "sendMessage", "sendPhoto", "sendVideo", "sendAnimation", "forwardMessage":
+		return tgbotapi.Message{
+			MessageID: f.newMessageID(),
+			From:      &tgbotapi.User{ID: fakeBotID, IsBot: true, FirstName: "Test", UserName: fakeBotUsername},
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: chatType(chatID)},
+			Date:      int(time.Now().Unix()),
+			Text:      params.Get("text"),
+			Caption:   params.Get("caption"),
+		}, nil
+	case "editMessageText":
+		messageID, _ := strconv.Atoi(params.Get("message_id"))
+		return tgbotapi.Message{
+			MessageID: messageID,
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: chatType(chatID)},
+			Date:      int(time.Now().Unix()),
+			Text:      params.Get("text"),
+		}, nil
+	case "getChatMember":
+		f.mu.Lock()
+		status, ok := f.members[fmt.Sprintf("%d:%d", chatID, userID)]
+		user, known := f.users[userID]
+		f.mu.Unlock()
+		if !ok {
+			status = "member"
+		}
+		if !known {
+			user = tgbotapi.User{ID: userID, FirstName: strconv.FormatInt(userID, 10)}
+		}
+		return tgbotapi.ChatMember{
+			User:               &user,
+			Status:             status,
+			CanRestrictMembers: status == "administrator",
+		}, nil
+	case "getChat":
+		return tgbotapi.Chat{ID: chatID, Type: chatType(chatID), Title: "Test Group", Permissions: memberPermissions()}, nil
+	case "getChatMembersCount", "getChatMemberCount":
+		return 10, nil
+	case "getUserProfilePhotos":
+		return tgbotapi.UserProfilePhotos{TotalCount: 1, Photos: [][]tgbotapi.PhotoSize{{{FileID: "photo"}}}}, nil
+	case "getWebhookInfo":
+		return tgbotapi.WebhookInfo{}, nil
+	}
+	return true, nil
+}
+
+// pendingUpdates 返回 offset 之后的更新；没有时等待一小段时间，模拟长轮询又不拖慢 Stop
+func (f *fakeBotAPI) pendingUpdates(params url.Values) []tgbotapi.Update {
+	offset, _ := strconv.Atoi(params.Get("offset"))
+
+	take := func() []tgbotapi.Update {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var pending []tgbotapi.Update
+		for _, update := range f.updates {
+			if update.UpdateID >= offset {
+				pending = append(pending, update)
+			}
+		}
+		f.updates = pending
+		return pending
+	}
+
+	if pending := take(); len(pending) > 0 {
+		return pending
+	}
+	select {
+	case <-f.updateSignal:
+	case <-time.After(50 * time.Millisecond):
+	}
+	if pending := take(); len(pending) > 0 {
+		return pending
+	}
+	return []tgbotapi.Update{}
+}
+
+func chatType(chatID int64) string {
+	if chatID > 0 {
+		return "private"
+	}
+	return "supergroup"
+}
@@ -4,9 +4,12 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 type MessageFilter struct {
+	// 重新加载关键词时与并发的检查互斥
+	mu       sync.RWMutex
 	keywords []Keyword
 	// 预编译的正则表达式
 	adPatterns []*regexp.Regexp
@@ -17,6 +20,17 @@ type FilterResult struct {
 	Keyword     string
 	Action      string
 	MatchType   string
+	Rule        Keyword // 命中的关键词规则，包含动作参数
+}
+
+func newViolation(keyword Keyword, matchType string) *FilterResult {
+	return &FilterResult{
+		IsViolation: true,
+		Keyword:     keyword.Keyword,
+		Action:      keyword.Action,
+		MatchType:   matchType,
+		Rule:        keyword,
+	}
 }
 
 func NewMessageFilter(keywords []Keyword) *MessageFilter {
@@ -53,9 +67,18 @@ func NewMessageFilter(keywords []Keyword) *MessageFilter {
 }
 
 func (f *MessageFilter) UpdateKeywords(keywords []Keyword) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.keywords = keywords
 }
 
+// rules 当前的关键词列表，重新加载时整体替换，调用方可以直接遍历
+func (f *MessageFilter) rules() []Keyword {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.keywords
+}
+
 func (f *MessageFilter) CheckMessage(messageText string) *FilterResult {
 	// 1. 检查是否包含广告特征
 	hasAdPattern := false
@@ -74,15 +97,10 @@ func (f *MessageFilter) CheckMessage(messageText string) *FilterResult {
 	if hasAdPattern && len(usernames) > 0 {
 		for _, username := range usernames {
 			cleanUsername := strings.TrimPrefix(username, "@")
-			for _, keyword := range f.keywords {
+			for _, keyword := range f.rules() {
 				cleanKeyword := strings.TrimPrefix(keyword.Keyword, "@")
 				if strings.EqualFold(cleanUsername, cleanKeyword) {
-					return &FilterResult{
-						IsViolation: true,
-						Keyword:     keyword.Keyword,
-						Action:      keyword.Action,
-						MatchType:   "ad_with_username",
-					}
+					return newViolation(keyword, "ad_with_username")
 				}
 			}
 		}
@@ -109,36 +127,21 @@ func (f *MessageFilter) CheckMessage(messageText string) *FilterResult {
 func (f *MessageFilter) checkTextMessage(text string) *FilterResult {
 	textLower := strings.ToLower(text)
 
-	for _, keyword := range f.keywords {
+	for _, keyword := range f.rules() {
 		keywordLower := strings.ToLower(keyword.Keyword)
 
 		switch keyword.MatchType {
 		case "exact":
 			if f.exactMatch(textLower, keywordLower) {
-				return &FilterResult{
-					IsViolation: true,
-					Keyword:     keyword.Keyword,
-					Action:      keyword.Action,
-					MatchType:   keyword.MatchType,
-				}
+				return newViolation(keyword, keyword.MatchType)
 			}
 		case "fuzzy":
 			if f.fuzzyMatch(textLower, keywordLower) {
-				return &FilterResult{
-					IsViolation: true,
-					Keyword:     keyword.Keyword,
-					Action:      keyword.Action,
-					MatchType:   keyword.MatchType,
-				}
+				return newViolation(keyword, keyword.MatchType)
 			}
 		case "regex":
 			if f.regexMatch(text, keyword.Keyword) {
-				return &FilterResult{
-					IsViolation: true,
-					Keyword:     keyword.Keyword,
-					Action:      keyword.Action,
-					MatchType:   keyword.MatchType,
-				}
+				return newViolation(keyword, keyword.MatchType)
 			}
 		}
 	}
@@ -152,14 +155,9 @@ func (f *MessageFilter) checkLinks(text string) *FilterResult {
 	matches := tmeRegex.FindAllString(text, -1)
 
 	for _, match := range matches {
-		for _, keyword := range f.keywords {
+		for _, keyword := range f.rules() {
 			if strings.Contains(strings.ToLower(match), strings.ToLower(keyword.Keyword)) {
-				return &FilterResult{
-					IsViolation: true,
-					Keyword:     keyword.Keyword,
-					Action:      keyword.Action,
-					MatchType:   "link",
-				}
+				return newViolation(keyword, "link")
 			}
 		}
 	}
@@ -174,15 +172,10 @@ func (f *MessageFilter) checkLinks(text string) *FilterResult {
 			continue
 		}
 
-		for _, keyword := range f.keywords {
+		for _, keyword := range f.rules() {
 			if strings.Contains(strings.ToLower(parsedURL.Host), strings.ToLower(keyword.Keyword)) ||
 				strings.Contains(strings.ToLower(parsedURL.Path), strings.ToLower(keyword.Keyword)) {
-				return &FilterResult{
-					IsViolation: true,
-					Keyword:     keyword.Keyword,
-					Action:      keyword.Action,
-					MatchType:   "link",
-				}
+				return newViolation(keyword, "link")
 			}
 		}
 	}
@@ -197,17 +190,12 @@ func (f *MessageFilter) checkUsernames(text string) *FilterResult {
 
 	for _, match := range matches {
 		username := strings.TrimPrefix(match, "@")
-		for _, keyword := range f.keywords {
+		for _, keyword := range f.rules() {
 			// 如果关键词以 @ 开头，移除它进行比较
 			keywordUsername := strings.TrimPrefix(keyword.Keyword, "@")
 
 			if strings.EqualFold(username, keywordUsername) {
-				return &FilterResult{
-					IsViolation: true,
-					Keyword:     keyword.Keyword,
-					Action:      keyword.Action,
-					MatchType:   "username",
-				}
+				return newViolation(keyword, "username")
 			}
 		}
 	}
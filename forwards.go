@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 转发来源类型
+const (
+	ForwardUser    = "user"
+	ForwardBot     = "bot"
+	ForwardChannel = "channel"
+	ForwardGroup   = "group"  // 以群组身份发言的匿名管理员
+	ForwardHidden  = "hidden" // 隐藏了账号的用户，只有名称
+)
+
+// 频道转发策略
+const (
+	ForwardChannelBlock     = "block"     // 禁止转发所有频道的消息
+	ForwardChannelAllowlist = "allowlist" // 只允许转发列表中频道的消息
+)
+
+// defaultForwardAction 违反转发策略时的默认动作
+const defaultForwardAction = ActionDelete
+
+var forwardTypeNames = map[string]string{
+	ForwardUser:    "用户",
+	ForwardBot:     "机器人",
+	ForwardChannel: "频道",
+	ForwardGroup:   "群组",
+	ForwardHidden:  "隐藏用户",
+}
+
+// ForwardOrigin 转发消息的来源
+type ForwardOrigin struct {
+	Type     string
+	ID       int64 // 隐藏用户没有 ID
+	Name     string
+	Username string
+}
+
+// forwardOrigin 消息的转发来源，不是转发的消息返回 nil
+func forwardOrigin(message *tgbotapi.Message) *ForwardOrigin {
+	switch {
+	case message.ForwardFromChat != nil:
+		chat := message.ForwardFromChat
+		origin := &ForwardOrigin{Type: ForwardGroup, ID: chat.ID, Name: chat.Title, Username: chat.UserName}
+		if chat.IsChannel() {
+			origin.Type = ForwardChannel
+		}
+		return origin
+	case message.ForwardFrom != nil:
+		user := message.ForwardFrom
+		origin := &ForwardOrigin{Type: ForwardUser, ID: user.ID, Name: strings.TrimSpace(user.FirstName + " " + user.LastName), Username: user.UserName}
+		if user.IsBot {
+			origin.Type = ForwardBot
+		}
+		return origin
+	case message.ForwardSenderName != "" || message.ForwardDate != 0:
+		return &ForwardOrigin{Type: ForwardHidden, Name: message.ForwardSenderName}
+	}
+	return nil
+}
+
+// String 转发来源的说明，如 频道 新闻 (@news)
+func (o *ForwardOrigin) String() string {
+	desc := forwardTypeNames[o.Type]
+	if o.Name != "" {
+		desc += " " + o.Name
+	}
+	if o.Username != "" {
+		desc += " (@" + o.Username + ")"
+	}
+	return desc
+}
+
+// originListed 来源是否在列表中，列表项为数字ID或用户名（可带 @），用户名不区分大小写
+func originListed(list string, origin *ForwardOrigin) bool {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if id, err := strconv.ParseInt(entry, 10, 64); err == nil {
+			if origin.ID != 0 && id == origin.ID {
+				return true
+			}
+			continue
+		}
+		if origin.Username != "" && strings.EqualFold(strings.TrimPrefix(entry, "@"), origin.Username) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardBlocked 按群组的转发策略判断来源是否被禁止
+func forwardBlocked(origin *ForwardOrigin, settings *GroupSettings) bool {
+	if originListed(settings.ForwardBlocklist, origin) {
+		return true
+	}
+
+	switch origin.Type {
+	case ForwardChannel:
+		switch settings.ForwardChannelPolicy {
+		case ForwardChannelBlock:
+			return true
+		case ForwardChannelAllowlist:
+			return !originListed(settings.ForwardChannelAllowlist, origin)
+		}
+	case ForwardHidden:
+		return settings.ForwardBlockHidden
+	}
+	return false
+}
+
+// checkForwardPolicy 按群组的转发策略检查消息的转发来源，返回与关键词相同格式的结果
+func checkForwardPolicy(message *tgbotapi.Message, settings *GroupSettings) *FilterResult {
+	origin := forwardOrigin(message)
+	if origin == nil || !forwardBlocked(origin, settings) {
+		return &FilterResult{IsViolation: false}
+	}
+
+	step := WarningStep{Action: defaultForwardAction}
+	if settings.ForwardAction != "" {
+		parsed, err := parseActionStep(settings.ForwardAction)
+		if err != nil {
+			log.Printf("群组 %d 的转发处理动作无效：%v", settings.ChatID, err)
+		} else {
+			step = parsed
+		}
+	}
+
+	return newPolicyViolation("转发来源: "+origin.String(), "forward", step)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// globalBan 将用户加入全局封禁列表，并在所有群组中封禁，返回成功和失败的群组数
+func (tb *TelegramBot) globalBan(user *tgbotapi.User, reason string, issuedBy int64) (int, int, error) {
+	username := user.UserName
+	if username == "" {
+		username = user.FirstName
+	}
+
+	err := tb.db.AddGlobalBan(&GlobalBan{
+		UserID:   user.ID,
+		Username: username,
+		Reason:   reason,
+		IssuedBy: issuedBy,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	applied, failed := tb.applyGlobalBan(user.ID)
+	log.Printf("用户 %s (ID: %d) 已被全局封禁，原因：%s，成功 %d 个群组，失败 %d 个群组", username, user.ID, reason, applied, failed)
+	return applied, failed, nil
+}
+
+// applyGlobalBan 在所有群组中封禁用户，并记录由全局封禁执行封禁的群组
+func (tb *TelegramBot) applyGlobalBan(userID int64) (int, int) {
+	chats, err := tb.db.GetGroupChats()
+	if err != nil {
+		log.Printf("获取群组列表失败：%v", err)
+		return 0, 0
+	}
+
+	applied, failed := 0, 0
+	for _, chat := range chats {
+		// 已被群组自行封禁的不记录，解除全局封禁时保留群组的封禁
+		if tb.isBanned(chat.ChatID, userID) {
+			applied++
+			continue
+		}
+		if err := tb.banUser(chat.ChatID, userID, 0); err != nil {
+			failed++
+			continue
+		}
+		tb.recordGlobalBanChat(userID, chat.ChatID)
+		applied++
+	}
+	return applied, failed
+}
+
+// isBanned 用户当前是否已在群组中被封禁，查询失败时视为未封禁
+func (tb *TelegramBot) isBanned(chatID, userID int64) bool {
+	member, err := tb.getChatMember(chatID, userID)
+	if err != nil {
+		log.Printf("获取用户 %d 在群组 %d 的状态失败：%v", userID, chatID, err)
+		return false
+	}
+	return member.Status == "kicked"
+}
+
+func (tb *TelegramBot) recordGlobalBanChat(userID, chatID int64) {
+	if err := tb.db.AddGlobalBanChat(userID, chatID); err != nil {
+		log.Printf("记录全局封禁的群组失败：%v", err)
+	}
+}
+
+// globalUnban 将用户移出全局封禁列表，只在由全局封禁执行封禁的群组中解除封禁，
+// 群组因其他原因的封禁保持不变
+func (tb *TelegramBot) globalUnban(userID int64) (bool, error) {
+	chatIDs, err := tb.db.GetGlobalBanChats(userID)
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := tb.db.RemoveGlobalBan(userID)
+	if err != nil || !removed {
+		return removed, err
+	}
+
+	for _, chatID := range chatIDs {
+		tb.unbanUser(chatID, userID)
+	}
+
+	log.Printf("用户 %d 已解除全局封禁", userID)
+	return true, nil
+}
+
+// enforceGlobalBan 用户在全局封禁列表中时，在该群组中封禁用户并返回 true
+func (tb *TelegramBot) enforceGlobalBan(chatID int64, user *tgbotapi.User) bool {
+	ban, err := tb.db.GetGlobalBan(user.ID)
+	if err != nil {
+		log.Printf("查询全局封禁失败：%v", err)
+		return false
+	}
+	if ban == nil {
+		return false
+	}
+
+	if err := tb.banUser(chatID, user.ID, 0); err != nil {
+		return true
+	}
+	tb.recordGlobalBanChat(user.ID, chatID)
+
+	log.Printf("全局封禁用户 %s (ID: %d) 加入群组 %d，已自动封禁", user.FirstName, user.ID, chatID)
+
+	if tb.config.Telegram.AdminUserID != 0 {
+		notice := fmt.Sprintf("🚫 全局封禁用户 %s (ID: %d) 尝试加入群组 %d，已自动封禁\n原因：%s",
+			user.FirstName, user.ID, chatID, ban.Reason)
+		tb.outbox.Post(tgbotapi.NewMessage(tb.config.Telegram.AdminUserID, notice))
+	}
+	return true
+}
+
+// handleGlobalBanCommand /gban [用户ID] [原因]，也可回复用户的消息
+func (tb *TelegramBot) handleGlobalBanCommand(message *tgbotapi.Message, args string) {
+	user, fields := commandTarget(message, args)
+	if user == nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 用法：回复用户的消息发送 /gban [原因]，或 /gban <用户ID> [原因]")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	reason := strings.Join(fields, " ")
+	if reason == "" {
+		reason = "管理员全局封禁"
+	}
+
+	if message.ReplyToMessage != nil {
+		tb.deleteMessages(message.Chat.ID, []int{message.ReplyToMessage.MessageID})
+	}
+
+	applied, failed, err := tb.globalBan(user, reason, message.From.ID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ 全局封禁失败：%v", err))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	text := fmt.Sprintf("🚫 %s (ID: %d) 已被全局封禁\n原因：%s\n已在 %d 个群组中封禁", user.FirstName, user.ID, reason, applied)
+	if failed > 0 {
+		text += fmt.Sprintf("，%d 个群组封禁失败", failed)
+	}
+	tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, text))
+}
+
+// handleGlobalUnbanCommand /ungban <用户ID>，也可回复用户的消息
+func (tb *TelegramBot) handleGlobalUnbanCommand(message *tgbotapi.Message, args string) {
+	user, _ := commandTarget(message, args)
+	if user == nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 用法：/ungban <用户ID>")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	removed, err := tb.globalUnban(user.ID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ 解除全局封禁失败：%v", err))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	if !removed {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("ℹ️ 用户 %d 不在全局封禁列表中", user.ID))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ 已解除用户 %d 的全局封禁", user.ID)))
+}
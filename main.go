@@ -11,6 +11,9 @@ import (
 	"time"
 )
 
+// shutdownTimeout 关闭时等待处理完已收到的更新的最长时间
+const shutdownTimeout = 60 * time.Second
+
 func testNetwork() {
 	fmt.Println("🔍 开始网络诊断...")
 
@@ -101,7 +104,7 @@ func main() {
 
 	// 启动Web管理界面
 	go func() {
-		webServer := NewWebServer(config, db, reloadChan, bot.bot)
+		webServer := NewWebServer(config, db, reloadChan, bot)
 		log.Printf("Web管理界面启动在端口 %s", config.Server.Port)
 		err := webServer.Start()
 		if err != nil {
@@ -130,12 +133,21 @@ func main() {
 	go func() {
 		<-c
 		log.Println("正在关闭机器人...")
-		close(reloadChan)
-		os.Exit(0)
+		// 不关闭 reloadChan：处理剩余更新期间 Web 服务仍在运行，向已关闭的通道发送会 panic
+		bot.Stop()
+
+		// 再次收到信号或处理超时时直接退出
+		select {
+		case <-c:
+		case <-time.After(shutdownTimeout):
+			log.Println("等待处理完成超时")
+		}
+		os.Exit(1)
 	}()
 
 	log.Println("机器人已启动，按 Ctrl+C 停止")
 
-	// 启动机器人
+	// 启动机器人，收到关闭信号后处理完已收到的更新再返回
 	bot.Start()
+	log.Println("机器人已停止")
 }
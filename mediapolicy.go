@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 媒体策略中的内容类型
+const (
+	ContentPhoto           = "photo"
+	ContentVideo           = "video"
+	ContentAnimation       = "animation" // GIF 动图
+	ContentSticker         = "sticker"
+	ContentVoice           = "voice"
+	ContentVideoNote       = "video_note"
+	ContentAudio           = "audio"
+	ContentDocument        = "document"
+	ContentBlockedDocument = "blocked_document" // 扩展名或 MIME 类型在屏蔽列表中的文件
+	ContentContact         = "contact"
+	ContentLocation        = "location"
+	ContentPoll            = "poll"
+	ContentDice            = "dice"
+	ContentGame            = "game"
+)
+
+var contentTypeNames = map[string]string{
+	ContentPhoto:           "图片",
+	ContentVideo:           "视频",
+	ContentAnimation:       "GIF 动图",
+	ContentSticker:         "贴纸",
+	ContentVoice:           "语音",
+	ContentVideoNote:       "视频消息",
+	ContentAudio:           "音频",
+	ContentDocument:        "文件",
+	ContentBlockedDocument: "被屏蔽的文件类型",
+	ContentContact:         "联系人",
+	ContentLocation:        "位置",
+	ContentPoll:            "投票",
+	ContentDice:            "骰子",
+	ContentGame:            "游戏",
+}
+
+// MediaPolicy 各类内容的处理动作，未列出的类型不处理
+type MediaPolicy map[string]WarningStep
+
+// parseMediaPolicy 解析媒体策略，如 "sticker:delete,voice:mute:1h,blocked_document:ban"
+func parseMediaPolicy(spec string) (MediaPolicy, error) {
+	policy := MediaPolicy{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		contentType, actionText, _ := strings.Cut(part, ":")
+		if _, ok := contentTypeNames[contentType]; !ok {
+			return nil, fmt.Errorf("未知的内容类型: %s", contentType)
+		}
+
+		step, err := parseActionStep(actionText)
+		if err != nil {
+			return nil, err
+		}
+		policy[contentType] = step
+	}
+	return policy, nil
+}
+
+// documentBlocked 文件是否在屏蔽列表中：列表项含 / 时按 MIME 类型匹配（支持 image/* 形式），否则按扩展名匹配
+func documentBlocked(document *tgbotapi.Document, blocklist string) bool {
+	fileName := strings.ToLower(document.FileName)
+	mimeType := strings.ToLower(document.MimeType)
+
+	for _, entry := range strings.Split(strings.ToLower(blocklist), ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			if matched, _ := path.Match(entry, mimeType); matched {
+				return true
+			}
+		case fileName != "" && strings.HasSuffix(fileName, "."+strings.TrimPrefix(entry, ".")):
+			return true
+		}
+	}
+	return false
+}
+
+// messageContentTypes 消息的内容类型，被屏蔽的文件同时属于 document 和 blocked_document
+func messageContentTypes(message *tgbotapi.Message, blocklist string) []string {
+	var types []string
+	switch {
+	case len(message.Photo) > 0:
+		types = append(types, ContentPhoto)
+	case message.Video != nil:
+		types = append(types, ContentVideo)
+	case message.Animation != nil:
+		// GIF 消息同时带有 Document 字段，按动图处理
+		types = append(types, ContentAnimation)
+	case message.Sticker != nil:
+		types = append(types, ContentSticker)
+	case message.Voice != nil:
+		types = append(types, ContentVoice)
+	case message.VideoNote != nil:
+		types = append(types, ContentVideoNote)
+	case message.Audio != nil:
+		types = append(types, ContentAudio)
+	case message.Document != nil:
+		if documentBlocked(message.Document, blocklist) {
+			types = append(types, ContentBlockedDocument)
+		}
+		types = append(types, ContentDocument)
+	case message.Contact != nil:
+		types = append(types, ContentContact)
+	case message.Location != nil, message.Venue != nil:
+		types = append(types, ContentLocation)
+	case message.Poll != nil:
+		types = append(types, ContentPoll)
+	case message.Dice != nil:
+		types = append(types, ContentDice)
+	case message.Game != nil:
+		types = append(types, ContentGame)
+	}
+	return types
+}
+
+// messageFileName 消息所带文件的文件名
+func messageFileName(message *tgbotapi.Message) string {
+	switch {
+	case message.Document != nil:
+		return message.Document.FileName
+	case message.Audio != nil:
+		return message.Audio.FileName
+	case message.Video != nil:
+		return message.Video.FileName
+	case message.Animation != nil:
+		return message.Animation.FileName
+	}
+	return ""
+}
+
+// checkMediaPolicy 按群组的媒体策略检查消息的内容类型，返回与关键词相同格式的结果
+func checkMediaPolicy(message *tgbotapi.Message, settings *GroupSettings) *FilterResult {
+	if settings.MediaPolicy == "" {
+		return &FilterResult{IsViolation: false}
+	}
+
+	policy, err := parseMediaPolicy(settings.MediaPolicy)
+	if err != nil {
+		log.Printf("群组 %d 的媒体策略无效：%v", settings.ChatID, err)
+		return &FilterResult{IsViolation: false}
+	}
+
+	for _, contentType := range messageContentTypes(message, settings.DocumentBlocklist) {
+		step, ok := policy[contentType]
+		if !ok {
+			continue
+		}
+
+		return newPolicyViolation("媒体类型: "+contentTypeNames[contentType], "media_type", step)
+	}
+	return &FilterResult{IsViolation: false}
+}
+
+// newPolicyViolation 将群组策略的处理动作转换为与关键词相同格式的违规结果，Rule.ID 为 0
+func newPolicyViolation(name, matchType string, step WarningStep) *FilterResult {
+	return &FilterResult{
+		IsViolation: true,
+		Keyword:     name,
+		Action:      step.Action,
+		MatchType:   matchType,
+		Rule: Keyword{
+			Keyword:       name,
+			MatchType:     matchType,
+			Action:        step.Action,
+			Duration:      int(step.Duration / time.Second),
+			DeleteMessage: true,
+			// 只删除消息时不通知管理员，避免贴纸等内容刷屏
+			NotifyAdmin: step.Action != ActionDelete,
+			IsActive:    true,
+		},
+	}
+}
+
+// describeContent 违规记录中媒体消息的内容说明
+func describeContent(message *tgbotapi.Message) string {
+	text := messageText(message)
+	types := messageContentTypes(message, "")
+	if len(types) == 0 {
+		return text
+	}
+
+	desc := "[" + contentTypeNames[types[0]]
+	if fileName := messageFileName(message); fileName != "" {
+		desc += " " + fileName
+	}
+	desc += "]"
+	if text != "" {
+		desc += " " + text
+	}
+	return desc
+}
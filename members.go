@@ -0,0 +1,206 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// allowedUpdates 订阅的更新类型，chat_member 必须显式列出才会推送
+var allowedUpdates = []string{
+	"message",
+	"edited_message",
+	"channel_post",
+	"edited_channel_post",
+	"callback_query",
+	"chat_member",
+}
+
+// 成员变动类型
+const (
+	MemberJoin       = "join"
+	MemberLeave      = "leave"
+	MemberBan        = "ban"
+	MemberPromote    = "promote"
+	MemberDemote     = "demote"
+	MemberRestrict   = "restrict"
+	MemberUnrestrict = "unrestrict"
+)
+
+// 成员变动的来源
+const (
+	sourceChatMember     = "chat_member"
+	sourceServiceMessage = "service_message"
+)
+
+// memberEventDedupWindow 同一次加入/离开可能同时收到 chat_member 更新和系统消息，此时间（秒）内只处理一次
+const memberEventDedupWindow = 60
+
+// isPresent 成员状态是否表示用户在群组中
+func isPresent(member tgbotapi.ChatMember) bool {
+	switch member.Status {
+	case "creator", "administrator", "member":
+		return true
+	case "restricted":
+		return member.IsMember
+	}
+	return false
+}
+
+func isAdminStatus(status string) bool {
+	return status == "creator" || status == "administrator"
+}
+
+// memberEvent 根据成员状态的变化判断变动类型，无需记录时返回空字符串
+func memberEvent(oldMember, newMember tgbotapi.ChatMember) string {
+	wasPresent, present := isPresent(oldMember), isPresent(newMember)
+
+	switch {
+	case !wasPresent && present:
+		return MemberJoin
+	case wasPresent && !present:
+		if newMember.Status == "kicked" {
+			return MemberBan
+		}
+		return MemberLeave
+	case !present:
+		// 不在群组中的状态变化，如离开后被封禁
+		if newMember.Status == "kicked" && oldMember.Status != "kicked" {
+			return MemberBan
+		}
+		return ""
+	case !isAdminStatus(oldMember.Status) && isAdminStatus(newMember.Status):
+		return MemberPromote
+	case isAdminStatus(oldMember.Status) && !isAdminStatus(newMember.Status):
+		return MemberDemote
+	case oldMember.Status != "restricted" && newMember.Status == "restricted":
+		return MemberRestrict
+	case oldMember.Status == "restricted" && newMember.Status != "restricted":
+		return MemberUnrestrict
+	}
+	return ""
+}
+
+// handleChatMemberUpdate 处理 chat_member 更新：记录成员变动，新成员加入时欢迎和验证
+func (tb *TelegramBot) handleChatMemberUpdate(update *tgbotapi.ChatMemberUpdated) {
+	event := memberEvent(update.OldChatMember, update.NewChatMember)
+	if event == "" {
+		return
+	}
+
+	chat := &update.Chat
+	user := update.NewChatMember.User
+	actor := &update.From
+	oldStatus, newStatus := update.OldChatMember.Status, update.NewChatMember.Status
+
+	switch event {
+	case MemberJoin:
+		tb.memberJoined(chat, user, actor, oldStatus, sourceChatMember)
+	case MemberLeave:
+		tb.memberLeft(chat, user, actor, oldStatus, newStatus, sourceChatMember)
+	default:
+		tb.recordMemberEvent(chat, user, actor, event, oldStatus, newStatus, sourceChatMember)
+	}
+}
+
+// memberJoined 处理新成员加入，同一次加入只处理一次；返回用户是否因全局封禁被封禁
+func (tb *TelegramBot) memberJoined(chat *tgbotapi.Chat, user, actor *tgbotapi.User, oldStatus, source string) bool {
+	if user.ID == tb.bot.Self.ID {
+		return false
+	}
+
+	if !tb.recordMemberEvent(chat, user, actor, MemberJoin, oldStatus, "member", source) {
+		return false
+	}
+
+	// 全局封禁的用户直接封禁，不再欢迎和验证
+	if tb.enforceGlobalBan(chat.ID, user) {
+		return true
+	}
+
+	settings, err := tb.getGroupSettings(chat.ID)
+	if err != nil {
+		log.Printf("获取群组设置失败: %v", err)
+		return false
+	}
+
+	// 入群筛查，可疑的成员按群组设置处理
+	screening := tb.screenMember(chat, user, actor, settings)
+	if screening == ScreeningBan {
+		return false
+	}
+	var restrictUntil time.Time
+	switch screening {
+	case ScreeningCaptcha:
+		settings.VerificationEnabled = true
+		settings.VerificationMode = "private"
+	case ScreeningRestrict:
+		restrictUntil = time.Now().Add(time.Duration(settings.ScreeningRestrictHours) * time.Hour)
+	}
+
+	if user.IsBot {
+		if !restrictUntil.IsZero() {
+			tb.restrictMedia(chat.ID, user.ID, restrictUntil)
+		}
+		return false
+	}
+
+	// 统计加入速度，突袭时锁定群组
+	lockdown := tb.trackJoin(chat.ID, settings)
+
+	tb.startProbation(chat.ID, user.ID, settings)
+	tb.welcomeMember(chat, user, settings, lockdown)
+
+	if !restrictUntil.IsZero() {
+		// 需要验证时在验证通过后再限制，否则立即限制
+		if status := tb.verification(chat.ID, user.ID); status != nil {
+			tb.verifyMu.Lock()
+			status.RestrictUntil = restrictUntil
+			tb.verifyMu.Unlock()
+		} else {
+			tb.restrictMedia(chat.ID, user.ID, restrictUntil)
+		}
+	}
+	return false
+}
+
+// memberLeft 处理成员离开
+func (tb *TelegramBot) memberLeft(chat *tgbotapi.Chat, user, actor *tgbotapi.User, oldStatus, newStatus, source string) {
+	if newStatus == "" {
+		newStatus = "left"
+	}
+	tb.recordMemberEvent(chat, user, actor, MemberLeave, oldStatus, newStatus, source)
+}
+
+// recordMemberEvent 记录成员变动，最近已记录过同一变动时跳过并返回 false
+func (tb *TelegramBot) recordMemberEvent(chat *tgbotapi.Chat, user, actor *tgbotapi.User, event, oldStatus, newStatus, source string) bool {
+	recent, err := tb.db.HasRecentMembershipEvent(chat.ID, user.ID, event, memberEventDedupWindow)
+	if err != nil {
+		log.Printf("查询成员变动记录失败：%v", err)
+	} else if recent {
+		return false
+	}
+
+	var actorID int64
+	if actor != nil {
+		actorID = actor.ID
+	}
+
+	err = tb.db.AddMembershipEvent(&MembershipEvent{
+		ChatID:    chat.ID,
+		UserID:    user.ID,
+		Username:  displayName(user),
+		Event:     event,
+		OldStatus: oldStatus,
+		NewStatus: newStatus,
+		ActorID:   actorID,
+		Source:    source,
+	})
+	if err != nil {
+		log.Printf("记录成员变动失败：%v", err)
+	}
+
+	log.Printf("群组 %d 成员变动：%s (ID: %d) %s", chat.ID, displayName(user), user.ID, event)
+	return true
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 部署环境可能没有时区数据
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 夜间模式的权限方案
+const (
+	NightReadOnly = "readonly"  // 全体成员不能发言
+	NightTextOnly = "text_only" // 全体成员只能发送文字
+)
+
+// 夜间模式设置未配置时的默认值
+const (
+	defaultNightModeStart    = "00:00"
+	defaultNightModeEnd      = "08:00"
+	defaultNightModeTimezone = "Asia/Shanghai"
+	defaultNightModeProfile  = NightReadOnly
+)
+
+// nightModeInterval 检查夜间模式的间隔
+const nightModeInterval = time.Minute
+
+var weekdayNames = []string{"日", "一", "二", "三", "四", "五", "六"}
+
+// NightSchedule 解析后的夜间模式时间表
+type NightSchedule struct {
+	Start    int // 开始时间，从 0 点起的分钟数
+	End      int // 结束时间，从 0 点起的分钟数
+	Days     [7]bool
+	Location *time.Location
+}
+
+// parseClock 解析 HH:MM 格式的时间，返回从 0 点起的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("时间格式应为 HH:MM：%s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseWeekdays 解析生效的星期，格式与 cron 的星期字段相同：0-6（0 为周日），
+// 支持逗号分隔和范围，如 1-5 或 0,6；空表示每天
+func parseWeekdays(s string) ([7]bool, error) {
+	var days [7]bool
+	s = strings.TrimSpace(s)
+	if s == "" || s == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(from)
+		if err != nil || start < 0 || start > 6 {
+			return days, fmt.Errorf("星期应为 0-6：%s", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(to)
+			if err != nil || end < start || end > 6 {
+				return days, fmt.Errorf("星期范围无效：%s", part)
+			}
+		}
+		for d := start; d <= end; d++ {
+			days[d] = true
+		}
+	}
+	return days, nil
+}
+
+// parseNightSchedule 根据群组设置解析夜间模式时间表
+func parseNightSchedule(settings *GroupSettings) (*NightSchedule, error) {
+	start, err := parseClock(settings.NightModeStart)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(settings.NightModeEnd)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("开始时间和结束时间不能相同")
+	}
+	days, err := parseWeekdays(settings.NightModeDays)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(settings.NightModeTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("未知的时区：%s", settings.NightModeTimezone)
+	}
+	switch settings.NightModeProfile {
+	case NightReadOnly, NightTextOnly:
+	default:
+		return nil, fmt.Errorf("未知的权限方案：%s", settings.NightModeProfile)
+	}
+
+	return &NightSchedule{Start: start, End: end, Days: days, Location: location}, nil
+}
+
+// Active 指定时间是否在夜间模式内；跨过 0 点的时间段按开始那天的星期判断
+func (s *NightSchedule) Active(now time.Time) bool {
+	t := now.In(s.Location)
+	minutes := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	if s.Start < s.End {
+		return s.Days[today] && minutes >= s.Start && minutes < s.End
+	}
+	return (s.Days[today] && minutes >= s.Start) || (s.Days[yesterday] && minutes < s.End)
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// nightPermissions 夜间模式期间全体成员的权限
+func nightPermissions(profile string) *tgbotapi.ChatPermissions {
+	if profile == NightTextOnly {
+		return textOnlyPermissions()
+	}
+	return mutedPermissions()
+}
+
+// runNightMode 定时检查各群组的夜间模式，按时间表开始和结束，Stop 后退出
+func (tb *TelegramBot) runNightMode() {
+	ticker := time.NewTicker(nightModeInterval)
+	defer ticker.Stop()
+
+	for {
+		tb.checkNightMode(time.Now())
+		select {
+		case <-ticker.C:
+		case <-tb.stopped:
+			return
+		}
+	}
+}
+
+func (tb *TelegramBot) checkNightMode(now time.Time) {
+	chats, err := tb.db.GetGroupChats()
+	if err != nil {
+		log.Printf("获取群组列表失败：%v", err)
+		return
+	}
+
+	for _, chat := range chats {
+		active, err := tb.db.GetNightMode(chat.ChatID)
+		if err != nil {
+			log.Printf("查询夜间模式失败：%v", err)
+			continue
+		}
+
+		settings, err := tb.getGroupSettings(chat.ChatID)
+		if err != nil {
+			log.Printf("获取群组设置失败: %v", err)
+			continue
+		}
+
+		var schedule *NightSchedule
+		if settings.NightModeEnabled {
+			if schedule, err = parseNightSchedule(settings); err != nil {
+				log.Printf("群组 %d 的夜间模式设置无效：%v", chat.ChatID, err)
+			}
+		}
+		due := schedule != nil && schedule.Active(now)
+
+		switch {
+		case due && active == nil:
+			tb.startNightMode(chat.ChatID, settings, schedule)
+		case !due && active != nil:
+			tb.endNightMode(active)
+		}
+	}
+}
+
+// startNightMode 切换到夜间模式的权限；防护模式同时生效时取两者中更严格的权限
+func (tb *TelegramBot) startNightMode(chatID int64, settings *GroupSettings, schedule *NightSchedule) {
+	if err := tb.holdPermissions(chatID, holdNightMode, nightPermissions(settings.NightModeProfile)); err != nil {
+		log.Printf("群组 %d 开启夜间模式失败：%v", chatID, err)
+		return
+	}
+
+	if err := tb.db.SaveNightMode(&NightMode{ChatID: chatID}); err != nil {
+		log.Printf("保存夜间模式失败：%v", err)
+	}
+
+	log.Printf("🌙 群组 %d 已开启夜间模式：%s", chatID, describeNightSchedule(schedule))
+
+	notice := "🌙 夜间模式已开启，全体成员暂时不能发言"
+	if settings.NightModeProfile == NightTextOnly {
+		notice = "🌙 夜间模式已开启，全体成员暂时只能发送文字"
+	}
+	notice += fmt.Sprintf("\n将于 %s 恢复", formatClock(schedule.End))
+	tb.outbox.Post(tgbotapi.NewMessage(chatID, notice))
+}
+
+// endNightMode 撤销夜间模式的权限，防护模式仍在生效时保持防护模式的权限，否则恢复原有权限
+func (tb *TelegramBot) endNightMode(nightMode *NightMode) {
+	restored := tb.releasePermissions(nightMode.ChatID, holdNightMode)
+	if err := tb.db.DeleteNightMode(nightMode.ChatID); err != nil {
+		log.Printf("删除夜间模式失败：%v", err)
+	}
+
+	log.Printf("☀️ 群组 %d 的夜间模式已结束", nightMode.ChatID)
+	notice := "☀️ 夜间模式已结束，群组权限已恢复"
+	if !restored {
+		notice = "☀️ 夜间模式已结束，群组仍处于防护模式"
+	}
+	tb.outbox.Post(tgbotapi.NewMessage(nightMode.ChatID, notice))
+}
+
+// describeNightSchedule 夜间模式时间表的说明，如 每天 00:00-08:00 (Asia/Shanghai)
+func describeNightSchedule(s *NightSchedule) string {
+	days := "每天"
+	var names []string
+	for d, on := range s.Days {
+		if on {
+			names = append(names, weekdayNames[d])
+		}
+	}
+	if len(names) < 7 {
+		days = "每周" + strings.Join(names, "、")
+	}
+	return fmt.Sprintf("%s %s-%s (%s)", days, formatClock(s.Start), formatClock(s.End), s.Location)
+}
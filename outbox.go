@@ -0,0 +1,444 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 发送优先级，数字越小越先发送
+const (
+	PriorityHigh   = iota // 删除消息、封禁、禁言和回调应答
+	PriorityNormal        // 通知、回复等普通消息
+	priorityLevels
+)
+
+// 发送队列未配置时的默认值，与 Telegram 的限制一致
+const (
+	defaultGlobalPerSecond = 30 // 全局每秒最多请求数
+	defaultChatPerMinute   = 20 // 每个群组每分钟最多发送的消息数
+	defaultOutboxWorkers   = 4
+	defaultMaxRetries      = 3
+)
+
+// retryBaseDelay 临时错误第一次重试前的等待时间，之后每次翻倍
+const retryBaseDelay = time.Second
+
+// outboxJob 队列中的一个请求
+type outboxJob struct {
+	chatID    int64 // 0 表示不属于具体的聊天，如回调应答
+	priority  int
+	kind      string // 请求类型，用于统计
+	do        func() error
+	attempts  int
+	notBefore time.Time  // 重试前等待到该时间
+	done      chan error // 同步调用等待结果，异步调用为 nil
+}
+
+// OutboxStats 发送队列的统计
+type OutboxStats struct {
+	Queued       int              `json:"queued"`
+	Sent         int64            `json:"sent"`
+	Retried      int64            `json:"retried"`
+	RateLimited  int64            `json:"rate_limited"` // 收到 429 的次数
+	Failed       int64            `json:"failed"`
+	FailedByKind map[string]int64 `json:"failed_by_kind"`
+	LastError    string           `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time       `json:"last_error_at,omitempty"`
+}
+
+// Outbox 所有发往 Telegram 的请求都经过此队列：按优先级排序，
+// 按全局和每个聊天限速，遵守 429 的 retry_after，临时错误退避重试；
+// 同一聊天同时只有一个请求在发送，保证同一优先级内的顺序
+type Outbox struct {
+	bot        *tgbotapi.BotAPI
+	maxRetries int
+
+	mu          sync.Mutex
+	queues      [priorityLevels][]*outboxJob
+	global      *tokenBucket
+	chatRate    float64 // 每个聊天每秒补充的令牌数
+	chatBurst   float64
+	chats       map[int64]*tokenBucket
+	busy        map[int64]bool
+	pausedUntil map[int64]time.Time // 收到 429 后暂停的聊天，键 0 表示暂停所有请求
+	pending     int                 // 已加入队列但还没有完成的请求，包括正在发送和等待重试的
+	stats       OutboxStats
+
+	wake    chan struct{}
+	workers chan struct{}
+}
+
+func NewOutbox(bot *tgbotapi.BotAPI, config *Config) *Outbox {
+	limits := config.RateLimit
+	if limits.GlobalPerSecond <= 0 {
+		limits.GlobalPerSecond = defaultGlobalPerSecond
+	}
+	if limits.ChatPerMinute <= 0 {
+		limits.ChatPerMinute = defaultChatPerMinute
+	}
+	if limits.Workers <= 0 {
+		limits.Workers = defaultOutboxWorkers
+	}
+	if limits.MaxRetries <= 0 {
+		limits.MaxRetries = defaultMaxRetries
+	}
+
+	o := &Outbox{
+		bot:         bot,
+		maxRetries:  limits.MaxRetries,
+		global:      newTokenBucket(float64(limits.GlobalPerSecond), float64(limits.GlobalPerSecond)),
+		chatRate:    float64(limits.ChatPerMinute) / 60,
+		chatBurst:   float64(limits.ChatPerMinute),
+		chats:       make(map[int64]*tokenBucket),
+		busy:        make(map[int64]bool),
+		pausedUntil: make(map[int64]time.Time),
+		stats:       OutboxStats{FailedByKind: make(map[string]int64)},
+		wake:        make(chan struct{}, 1),
+		workers:     make(chan struct{}, limits.Workers),
+	}
+	go o.run()
+	return o
+}
+
+// Send 发送消息并等待结果
+func (o *Outbox) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var message tgbotapi.Message
+	chatID, priority, kind := classifyRequest(c)
+	err := o.Do(chatID, priority, kind, func() error {
+		var err error
+		message, err = o.bot.Send(c)
+		return err
+	})
+	return message, err
+}
+
+// Request 发送请求并等待结果
+func (o *Outbox) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	chatID, priority, kind := classifyRequest(c)
+	err := o.Do(chatID, priority, kind, func() error {
+		var err error
+		resp, err = o.bot.Request(c)
+		return err
+	})
+	return resp, err
+}
+
+// Post 将请求加入队列后立即返回，不关心结果时使用，失败会记录日志和统计
+func (o *Outbox) Post(c tgbotapi.Chattable) {
+	chatID, priority, kind := classifyRequest(c)
+	o.enqueue(&outboxJob{
+		chatID:   chatID,
+		priority: priority,
+		kind:     kind,
+		do: func() error {
+			_, err := o.bot.Request(c)
+			return err
+		},
+	})
+}
+
+// Do 将任意请求加入队列并等待结果，用于 Chattable 以外的接口
+func (o *Outbox) Do(chatID int64, priority int, kind string, do func() error) error {
+	job := &outboxJob{chatID: chatID, priority: priority, kind: kind, do: do, done: make(chan error, 1)}
+	o.enqueue(job)
+	return <-job.done
+}
+
+// outboxFlushTimeout 关闭时等待队列发送完的最长时间
+const outboxFlushTimeout = 10 * time.Second
+
+// Flush 等待队列中的请求发送完，最多等待 timeout
+func (o *Outbox) Flush(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if o.pendingJobs() == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Printf("⚠️ 发送队列中还有 %d 个请求未发送", o.pendingJobs())
+}
+
+// pendingJobs 还没有完成的请求数；请求取出后到发送完成之间不在队列中，不能只看队列长度
+func (o *Outbox) pendingJobs() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending
+}
+
+// Stats 当前的统计
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stats := o.stats
+	stats.FailedByKind = make(map[string]int64, len(o.stats.FailedByKind))
+	for kind, n := range o.stats.FailedByKind {
+		stats.FailedByKind[kind] = n
+	}
+	for _, queue := range o.queues {
+		stats.Queued += len(queue)
+	}
+	return stats
+}
+
+func (o *Outbox) enqueue(job *outboxJob) {
+	o.mu.Lock()
+	o.queues[job.priority] = append(o.queues[job.priority], job)
+	o.pending++
+	o.mu.Unlock()
+	o.signal()
+}
+
+// signal 唤醒调度循环
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run 调度循环：取出下一个可以发送的请求交给空闲的 worker
+func (o *Outbox) run() {
+	for {
+		job, wait := o.next(time.Now())
+		if job == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-o.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		o.workers <- struct{}{}
+		go o.execute(job)
+	}
+}
+
+// idleWait 队列中没有等待中的请求时调度循环的最长休眠时间
+const idleWait = time.Minute
+
+// next 取出下一个可以发送的请求并消耗令牌；没有时返回需要等待的时间
+func (o *Outbox) next(now time.Time) (*outboxJob, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if until := o.pausedUntil[0]; now.Before(until) {
+		return nil, until.Sub(now)
+	}
+
+	wait := idleWait
+	later := func(d time.Duration) {
+		if d < wait {
+			wait = d
+		}
+	}
+
+	for priority, queue := range o.queues {
+		// 聊天的第一个请求不能发送时，同一优先级中它后面的请求也不发送，保证顺序
+		skipped := make(map[int64]bool)
+		for i, job := range queue {
+			chatID := job.chatID
+			if chatID != 0 && (skipped[chatID] || o.busy[chatID]) {
+				continue
+			}
+			if d := job.notBefore.Sub(now); d > 0 {
+				skipped[chatID] = chatID != 0
+				later(d)
+				continue
+			}
+			if until := o.pausedUntil[chatID]; now.Before(until) {
+				skipped[chatID] = true
+				later(until.Sub(now))
+				continue
+			}
+
+			// 每个聊天的限速只针对普通消息，删除和封禁等只受全局限速
+			var bucket *tokenBucket
+			if priority == PriorityNormal && chatID != 0 {
+				bucket = o.chatBucket(chatID)
+				if d := bucket.delay(now); d > 0 {
+					skipped[chatID] = true
+					later(d)
+					continue
+				}
+			}
+			if d := o.global.delay(now); d > 0 {
+				return nil, d
+			}
+
+			o.global.take(now)
+			if bucket != nil {
+				bucket.take(now)
+			}
+			if chatID != 0 {
+				o.busy[chatID] = true
+			}
+			o.queues[priority] = append(queue[:i:i], queue[i+1:]...)
+			return job, 0
+		}
+	}
+	return nil, wait
+}
+
+func (o *Outbox) chatBucket(chatID int64) *tokenBucket {
+	bucket, ok := o.chats[chatID]
+	if !ok {
+		bucket = newTokenBucket(o.chatRate, o.chatBurst)
+		o.chats[chatID] = bucket
+	}
+	return bucket
+}
+
+// execute 发送请求并处理结果：429 按 retry_after 暂停该聊天后重新排队，临时错误退避重试
+func (o *Outbox) execute(job *outboxJob) {
+	defer func() {
+		<-o.workers
+		o.signal()
+	}()
+
+	err := job.do()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.busy, job.chatID)
+	now := time.Now()
+
+	if err == nil {
+		o.stats.Sent++
+		o.finish(job, nil)
+		return
+	}
+
+	if retryAfter := retryAfter(err); retryAfter > 0 {
+		o.stats.RateLimited++
+		o.pausedUntil[job.chatID] = now.Add(retryAfter)
+		log.Printf("⏳ 请求过于频繁（%s，聊天 %d），%s 后重试", job.kind, job.chatID, retryAfter)
+		o.requeue(job)
+		return
+	}
+
+	if transientError(err) && job.attempts < o.maxRetries {
+		job.attempts++
+		job.notBefore = now.Add(retryBaseDelay << (job.attempts - 1))
+		o.stats.Retried++
+		log.Printf("🔁 请求失败（%s，聊天 %d），第 %d 次重试：%v", job.kind, job.chatID, job.attempts, err)
+		o.requeue(job)
+		return
+	}
+
+	o.stats.Failed++
+	o.stats.FailedByKind[job.kind]++
+	o.stats.LastError = fmt.Sprintf("%s（聊天 %d）：%v", job.kind, job.chatID, err)
+	o.stats.LastErrorAt = &now
+	// 同步调用由调用方处理错误，异步调用只能在这里记录
+	if job.done == nil {
+		log.Printf("❌ 请求失败（%s，聊天 %d）：%v", job.kind, job.chatID, err)
+	}
+	o.finish(job, err)
+}
+
+// requeue 将请求放回队首，保证同一聊天的顺序
+func (o *Outbox) requeue(job *outboxJob) {
+	o.queues[job.priority] = append([]*outboxJob{job}, o.queues[job.priority]...)
+}
+
+func (o *Outbox) finish(job *outboxJob, err error) {
+	o.pending--
+	if job.done != nil {
+		job.done <- err
+	}
+}
+
+// retryAfter 429 错误要求等待的时间
+func retryAfter(err error) time.Duration {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+	return 0
+}
+
+// transientError 是否为可以重试的临时错误：网络错误（包括超时）或 Telegram 服务端错误；
+// 解析响应失败、参数错误等重试也不会成功
+func transientError(err error) bool {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// classifyRequest 请求所属的聊天、优先级和类型名
+func classifyRequest(c tgbotapi.Chattable) (int64, int, string) {
+	priority := PriorityNormal
+	switch c.(type) {
+	case tgbotapi.DeleteMessageConfig, tgbotapi.BanChatMemberConfig, tgbotapi.UnbanChatMemberConfig,
+		tgbotapi.RestrictChatMemberConfig, tgbotapi.SetChatPermissionsConfig, tgbotapi.CallbackConfig:
+		priority = PriorityHigh
+	}
+
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", c), "tgbotapi.")
+	return chattableChatID(c), priority, kind
+}
+
+// chattableChatID 请求中的 ChatID 字段，各种 Config 都直接或通过嵌入的结构体带有该字段
+func chattableChatID(c tgbotapi.Chattable) int64 {
+	v := reflect.Indirect(reflect.ValueOf(c))
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	if field := v.FieldByName("ChatID"); field.IsValid() && field.Kind() == reflect.Int64 {
+		return field.Int()
+	}
+	return 0
+}
+
+// tokenBucket 令牌桶限速
+type tokenBucket struct {
+	tokens float64
+	rate   float64 // 每秒补充的令牌数
+	burst  float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{tokens: burst, rate: rate, burst: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// delay 获得一个令牌还需要等待的时间
+func (b *tokenBucket) delay(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take(now time.Time) {
+	b.refill(now)
+	b.tokens--
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 观察期设置未配置时的默认值
+const (
+	defaultProbationDuration = 1440 // 观察期时长（分钟）
+	defaultProbationMessages = 5    // 提前结束观察期需要的正常消息数
+)
+
+// probationNoticeDelay 观察期提示在群内保留的秒数
+const probationNoticeDelay = 30
+
+// hasEntity 消息或说明文字中是否含有指定类型的实体
+func hasEntity(message *tgbotapi.Message, types ...string) bool {
+	entities := append(append([]tgbotapi.MessageEntity{}, message.Entities...), message.CaptionEntities...)
+	for _, entity := range entities {
+		for _, t := range types {
+			if entity.Type == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// probationViolation 观察期内不允许发送的内容，允许时返回空字符串；
+// 媒体按媒体策略的内容类型判断，贴纸、GIF、投票、骰子等都不允许
+func probationViolation(message *tgbotapi.Message) string {
+	if message.ForwardDate != 0 {
+		return "转发消息"
+	}
+	if types := messageContentTypes(message, ""); len(types) > 0 {
+		return contentTypeNames[types[0]]
+	}
+
+	switch {
+	case hasEntity(message, "url", "text_link"):
+		return "链接"
+	case hasEntity(message, "mention", "text_mention"):
+		return "提及其他用户"
+	}
+	return ""
+}
+
+// startProbation 新成员加入时开始观察期
+func (tb *TelegramBot) startProbation(chatID, userID int64, settings *GroupSettings) {
+	if !settings.ProbationEnabled {
+		return
+	}
+	if err := tb.db.StartProbation(chatID, userID); err != nil {
+		log.Printf("记录观察期失败：%v", err)
+	}
+}
+
+// onProbation 用户是否处于观察期，观察期已满时结束观察期
+func (tb *TelegramBot) onProbation(chatID, userID int64, settings *GroupSettings) bool {
+	if !settings.ProbationEnabled {
+		return false
+	}
+
+	probation, err := tb.db.GetProbation(chatID, userID)
+	if err != nil {
+		log.Printf("查询观察期失败：%v", err)
+		return false
+	}
+	if probation == nil {
+		return false
+	}
+
+	duration := time.Duration(settings.ProbationDuration) * time.Minute
+	if time.Since(probation.JoinedAt) >= duration || probation.CleanMessages >= settings.ProbationMessages {
+		tb.endProbation(chatID, userID)
+		return false
+	}
+	return true
+}
+
+func (tb *TelegramBot) endProbation(chatID, userID int64) {
+	if err := tb.db.EndProbation(chatID, userID); err != nil {
+		log.Printf("结束观察期失败：%v", err)
+		return
+	}
+	log.Printf("用户 %d 在群组 %d 的观察期已结束", userID, chatID)
+}
+
+// enforceProbation 删除观察期成员发送的受限内容，返回消息是否被删除
+func (tb *TelegramBot) enforceProbation(message *tgbotapi.Message, settings *GroupSettings) bool {
+	violation := probationViolation(message)
+	if violation == "" {
+		return false
+	}
+
+	chatID := message.Chat.ID
+	if _, err := tb.outbox.Request(tgbotapi.NewDeleteMessage(chatID, message.MessageID)); err != nil {
+		log.Printf("删除观察期消息失败：%v", err)
+		return false
+	}
+
+	log.Printf("%s (ID: %d) 在观察期内于群组 %d 发送了%s，已删除", message.From.UserName, message.From.ID, chatID, violation)
+
+	if tb.config.Settings.LogViolations {
+		if err := tb.db.LogViolation(message.From.ID, message.From.UserName, chatID, messageText(message), "新成员观察期", ActionDelete); err != nil {
+			log.Printf("记录违规失败：%v", err)
+		}
+	}
+
+	notice := fmt.Sprintf("⏳ %s，新成员在加入 %s 内或发送 %d 条消息之前不能发送%s",
+		displayName(message.From), formatDuration(time.Duration(settings.ProbationDuration)*time.Minute),
+		settings.ProbationMessages, violation)
+	if sent, err := tb.outbox.Send(tgbotapi.NewMessage(chatID, notice)); err == nil {
+		tb.deleteMessagesLater(chatID, []int{sent.MessageID}, probationNoticeDelay)
+	}
+	return true
+}
+
+// countCleanMessage 观察期内的正常消息计数，达到设置的数量时提前结束观察期
+func (tb *TelegramBot) countCleanMessage(message *tgbotapi.Message, settings *GroupSettings) {
+	count, err := tb.db.AddProbationCleanMessage(message.Chat.ID, message.From.ID)
+	if err != nil {
+		log.Printf("更新观察期消息数失败：%v", err)
+		return
+	}
+	if count >= settings.ProbationMessages {
+		tb.endProbation(message.Chat.ID, message.From.ID)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 防突袭设置未配置时的默认值
+const (
+	defaultRaidThreshold = 10 // 统计时间内加入的人数
+	defaultRaidWindow    = 60 // 统计时间（秒）
+	defaultRaidLockdown  = 30 // 锁定时间（分钟）
+)
+
+// inLockdown 群组是否处于防突袭锁定状态
+func (tb *TelegramBot) inLockdown(chatID int64) bool {
+	tb.raidMu.Lock()
+	defer tb.raidMu.Unlock()
+	_, locked := tb.lockdowns[chatID]
+	return locked
+}
+
+// trackJoin 统计群组的加入速度，超过阈值时自动锁定群组，返回群组是否处于锁定状态
+func (tb *TelegramBot) trackJoin(chatID int64, settings *GroupSettings) bool {
+	if tb.inLockdown(chatID) {
+		return true
+	}
+	if !settings.RaidEnabled {
+		return false
+	}
+
+	now := time.Now()
+	window := time.Duration(settings.RaidWindow) * time.Second
+
+	tb.raidMu.Lock()
+	joins := tb.joinTimes[chatID]
+	// 丢弃统计时间之外的加入记录
+	expired := 0
+	for expired < len(joins) && now.Sub(joins[expired]) > window {
+		expired++
+	}
+	joins = append(joins[expired:], now)
+	raid := len(joins) >= settings.RaidThreshold
+	if raid {
+		delete(tb.joinTimes, chatID)
+	} else {
+		tb.joinTimes[chatID] = joins
+	}
+	tb.raidMu.Unlock()
+
+	if !raid {
+		return false
+	}
+
+	reason := fmt.Sprintf("%d 秒内有 %d 人加入", settings.RaidWindow, len(joins))
+	duration := time.Duration(settings.RaidLockdown) * time.Minute
+	if err := tb.startLockdown(chatID, settings, duration, reason, 0); err != nil {
+		log.Printf("群组 %d 自动锁定失败：%v", chatID, err)
+	}
+	return true
+}
+
+// startLockdown 锁定群组：新成员必须通过验证，可选地收紧全体成员权限，到期后自动解除
+func (tb *TelegramBot) startLockdown(chatID int64, settings *GroupSettings, duration time.Duration, reason string, startedBy int64) error {
+	lockdown := &Lockdown{
+		ChatID:    chatID,
+		Reason:    reason,
+		StartedBy: startedBy,
+		EndsAt:    time.Now().Add(duration),
+	}
+
+	tb.raidMu.Lock()
+	if _, locked := tb.lockdowns[chatID]; locked {
+		tb.raidMu.Unlock()
+		return fmt.Errorf("群组已处于锁定状态")
+	}
+	tb.lockdowns[chatID] = lockdown
+	tb.raidMu.Unlock()
+
+	var restricted bool
+	if settings.RaidRestrictChat {
+		// 解除时恢复原有权限；夜间模式同时生效时取两者中更严格的权限
+		if err := tb.holdPermissions(chatID, holdLockdown, textOnlyPermissions()); err != nil {
+			log.Printf("设置群组 %d 的权限失败：%v", chatID, err)
+		} else {
+			tb.raidMu.Lock()
+			current := tb.lockdowns[chatID] == lockdown
+			tb.raidMu.Unlock()
+
+			if !current {
+				// 修改权限期间锁定已被解除（如在 Web 界面中解除），由这里撤销修改
+				tb.releasePermissions(chatID, holdLockdown)
+				return nil
+			}
+			restricted = true
+		}
+	}
+
+	if err := tb.db.SaveLockdown(lockdown); err != nil {
+		log.Printf("保存锁定状态失败：%v", err)
+	}
+	tb.scheduleUnlock(lockdown)
+
+	log.Printf("🚨 群组 %d 已进入防护模式：%s，持续 %s", chatID, reason, formatDuration(duration))
+
+	notice := fmt.Sprintf("🚨 群组已进入防护模式（%s）\n持续 %s，期间新成员需要通过验证", reason, formatDuration(duration))
+	if restricted {
+		notice += "，全体成员暂时只能发送文字"
+	}
+	tb.outbox.Post(tgbotapi.NewMessage(chatID, notice))
+
+	if adminID := tb.config.Telegram.AdminUserID; adminID != 0 && startedBy == 0 {
+		text := fmt.Sprintf("🚨 防突袭\n\n群组 %d 已自动进入防护模式\n原因: %s\n解除时间: %s\n也可以在群组中发送 /unlock 提前解除",
+			chatID, reason, lockdown.EndsAt.Format("2006-01-02 15:04:05"))
+		msg := tgbotapi.NewMessage(adminID, text)
+		if keyboard, ok := tb.callbackKeyboard([]callbackButton{
+			actionButton("🔓 解除锁定", callbackUnlock, chatID, 0, 0),
+		}); ok {
+			msg.ReplyMarkup = keyboard
+		}
+		tb.outbox.Post(msg)
+	}
+	return nil
+}
+
+// scheduleUnlock 到期后自动解除锁定；锁定已被提前解除或替换时不做处理
+func (tb *TelegramBot) scheduleUnlock(lockdown *Lockdown) {
+	time.AfterFunc(time.Until(lockdown.EndsAt), func() {
+		tb.raidMu.Lock()
+		current := tb.lockdowns[lockdown.ChatID]
+		tb.raidMu.Unlock()
+
+		if current == lockdown {
+			tb.endLockdown(lockdown.ChatID)
+		}
+	})
+}
+
+// endLockdown 解除群组的锁定并恢复原有权限，返回群组之前是否处于锁定状态
+func (tb *TelegramBot) endLockdown(chatID int64) bool {
+	tb.raidMu.Lock()
+	_, locked := tb.lockdowns[chatID]
+	delete(tb.lockdowns, chatID)
+	tb.raidMu.Unlock()
+
+	if !locked {
+		return false
+	}
+
+	// 未修改群组权限时不做处理；夜间模式仍在生效时保持夜间模式的权限
+	tb.releasePermissions(chatID, holdLockdown)
+	if err := tb.db.DeleteLockdown(chatID); err != nil {
+		log.Printf("删除锁定状态失败：%v", err)
+	}
+
+	log.Printf("✅ 群组 %d 的防护模式已解除", chatID)
+	tb.outbox.Post(tgbotapi.NewMessage(chatID, "✅ 防护模式已解除"))
+	return true
+}
+
+// resumeLockdowns 启动时恢复未到期的锁定，已到期的立即解除
+func (tb *TelegramBot) resumeLockdowns() {
+	lockdowns, err := tb.db.GetLockdowns()
+	if err != nil {
+		log.Printf("读取锁定状态失败：%v", err)
+		return
+	}
+
+	for i := range lockdowns {
+		lockdown := &lockdowns[i]
+
+		tb.raidMu.Lock()
+		tb.lockdowns[lockdown.ChatID] = lockdown
+		tb.raidMu.Unlock()
+
+		if time.Now().After(lockdown.EndsAt) {
+			tb.endLockdown(lockdown.ChatID)
+			continue
+		}
+		tb.scheduleUnlock(lockdown)
+		log.Printf("群组 %d 的防护模式将于 %s 解除", lockdown.ChatID, lockdown.EndsAt.Local().Format("15:04:05"))
+	}
+}
+
+// handleLockdownCommand /lockdown [分钟]，手动锁定当前群组
+func (tb *TelegramBot) handleLockdownCommand(message *tgbotapi.Message, args string) {
+	chatID := message.Chat.ID
+	if !message.Chat.IsGroup() && !message.Chat.IsSuperGroup() {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 请在群组中使用 /lockdown"))
+		return
+	}
+
+	settings, err := tb.getGroupSettings(chatID)
+	if err != nil {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 获取群组设置失败：%v", err)))
+		return
+	}
+
+	minutes := settings.RaidLockdown
+	if args = strings.TrimSpace(args); args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n <= 0 {
+			tb.outbox.Post(tgbotapi.NewMessage(chatID, "❌ 分钟数必须是正整数"))
+			return
+		}
+		minutes = n
+	}
+
+	err = tb.startLockdown(chatID, settings, time.Duration(minutes)*time.Minute, "管理员手动开启", message.From.ID)
+	if err != nil {
+		tb.outbox.Post(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %v", err)))
+	}
+}
+
+// handleUnlockCommand /unlock，提前解除当前群组的锁定
+func (tb *TelegramBot) handleUnlockCommand(message *tgbotapi.Message) {
+	if !tb.endLockdown(message.Chat.ID) {
+		tb.outbox.Post(tgbotapi.NewMessage(message.Chat.ID, "ℹ️ 群组未处于防护模式"))
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 举报状态
+const (
+	ReportPending   = "pending"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// reportDismiss 驳回举报，不做任何处理
+const reportDismiss = "dismiss"
+
+// 举报频率限制
+const (
+	reportCooldown      = 60 // 两次举报之间的最短间隔（秒）
+	defaultReportLimit  = 5  // 未配置时每小时最多举报次数
+	reportNoticeTimeout = 10 // 群组中举报回执的保留时间（秒）
+)
+
+// reportActions 管理员处理举报时可选的动作
+var reportActions = []string{ActionDelete, ActionWarn, ActionMute, ActionBan, reportDismiss}
+
+func isReportAction(action string) bool {
+	for _, a := range reportActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReportCommand /report [原因]，所有成员都可以回复消息举报给管理员
+func (tb *TelegramBot) handleReportCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	reply := func(text string) {
+		if sent, err := tb.outbox.Send(tgbotapi.NewMessage(chatID, text)); err == nil {
+			tb.deleteMessagesLater(chatID, []int{sent.MessageID, message.MessageID}, reportNoticeTimeout)
+		}
+	}
+
+	target := message.ReplyToMessage
+	if target == nil || target.From == nil {
+		reply("❌ 用法：回复要举报的消息并发送 /report [原因]")
+		return
+	}
+	if target.From.ID == message.From.ID || target.From.ID == tb.bot.Self.ID || target.From.ID == tb.config.Telegram.AdminUserID {
+		reply("❌ 不能举报这条消息")
+		return
+	}
+
+	// 频率限制
+	limit := tb.config.Settings.ReportLimit
+	if limit <= 0 {
+		limit = defaultReportLimit
+	}
+	if recent, err := tb.db.CountReportsSince(message.From.ID, reportCooldown); err == nil && recent > 0 {
+		reply("⏳ 举报太频繁，请稍后再试")
+		return
+	}
+	if hourly, err := tb.db.CountReportsSince(message.From.ID, 3600); err == nil && hourly >= limit {
+		reply(fmt.Sprintf("⏳ 每小时最多举报 %d 次，请稍后再试", limit))
+		return
+	}
+
+	if pending, err := tb.db.HasPendingReport(chatID, target.MessageID); err == nil && pending {
+		reply("ℹ️ 这条消息已被举报，管理员会尽快处理")
+		return
+	}
+
+	text := target.Text
+	if text == "" {
+		text = target.Caption
+	}
+
+	report := &Report{
+		ChatID:           chatID,
+		ChatTitle:        message.Chat.Title,
+		MessageID:        target.MessageID,
+		MessageText:      text,
+		ReportedUserID:   target.From.ID,
+		ReportedUsername: displayName(target.From),
+		ReporterID:       message.From.ID,
+		ReporterUsername: displayName(message.From),
+		Reason:           strings.TrimSpace(message.CommandArguments()),
+	}
+
+	id, err := tb.db.AddReport(report)
+	if err != nil {
+		log.Printf("保存举报失败：%v", err)
+		reply("❌ 举报失败，请稍后重试")
+		return
+	}
+	report.ID = id
+
+	reply("✅ 已举报给管理员，感谢你的反馈")
+	log.Printf("用户 %s (ID: %d) 举报了群组 %d 中 %s 的消息 %d", report.ReporterUsername, report.ReporterID, chatID, report.ReportedUsername, report.MessageID)
+
+	tb.notifyReport(report)
+}
+
+// notifyReport 将被举报的消息转发给管理员，并附带处理按钮
+func (tb *TelegramBot) notifyReport(report *Report) {
+	adminID := tb.config.Telegram.AdminUserID
+	if adminID == 0 {
+		return
+	}
+
+	tb.outbox.Post(tgbotapi.NewForward(adminID, report.ChatID, report.MessageID))
+
+	reputation := "暂无记录"
+	if stats, err := tb.db.GetReporterStats(report.ReporterID); err == nil {
+		if r := stats.Reputation(); r >= 0 {
+			reputation = fmt.Sprintf("%.0f%%（采纳 %d / 驳回 %d）", r*100, stats.Resolved, stats.Dismissed)
+		}
+	}
+
+	reason := report.Reason
+	if reason == "" {
+		reason = "未填写"
+	}
+
+	text := fmt.Sprintf(`🚩 举报 #%d
+
+群组: %s (ID: %d)
+被举报用户: %s (ID: %d)
+举报人: %s (ID: %d)
+举报人信誉: %s
+举报原因: %s
+消息内容: %s`,
+		report.ID,
+		report.ChatTitle, report.ChatID,
+		report.ReportedUsername, report.ReportedUserID,
+		report.ReporterUsername, report.ReporterID,
+		reputation,
+		reason,
+		report.MessageText)
+
+	button := func(label, action string) callbackButton {
+		return callbackButton{Text: label, Payload: CallbackPayload{
+			Action:   callbackReportPrefix + action,
+			ChatID:   report.ChatID,
+			UserID:   report.ReportedUserID,
+			RecordID: report.ID,
+		}}
+	}
+
+	msg := tgbotapi.NewMessage(adminID, text)
+	if keyboard, ok := tb.callbackKeyboard(
+		[]callbackButton{
+			button("🗑 删除", ActionDelete),
+			button("⚠️ 警告", ActionWarn),
+			button("🔇 禁言", ActionMute),
+		},
+		[]callbackButton{
+			button("⛔ 封禁", ActionBan),
+			button("🙈 忽略", reportDismiss),
+		},
+	); ok {
+		msg.ReplyMarkup = keyboard
+	}
+	tb.outbox.Post(msg)
+}
+
+// resolveReport 按管理员选择的动作处理举报，返回动作的描述
+func (tb *TelegramBot) resolveReport(id int, action string, resolvedBy int64) (string, error) {
+	if !isReportAction(action) {
+		return "", fmt.Errorf("未知的动作: %s", action)
+	}
+
+	report, err := tb.db.GetReport(id)
+	if err != nil {
+		return "", err
+	}
+	if report == nil {
+		return "", fmt.Errorf("举报 #%d 不存在", id)
+	}
+	if report.Status != ReportPending {
+		return "", fmt.Errorf("举报 #%d 已处理", id)
+	}
+
+	status := ReportResolved
+	if action == reportDismiss {
+		status = ReportDismissed
+	}
+
+	// 先认领举报，同时在 Telegram 和 Web 管理界面中处理时只有一方会执行动作
+	resolved, err := tb.db.ResolveReport(id, status, action, resolvedBy)
+	if err != nil {
+		return "", err
+	}
+	if !resolved {
+		return "", fmt.Errorf("举报 #%d 已处理", id)
+	}
+
+	description := "忽略"
+	if action != reportDismiss {
+		tb.deleteMessages(report.ChatID, []int{report.MessageID})
+
+		user := &tgbotapi.User{ID: report.ReportedUserID, FirstName: report.ReportedUsername}
+		reason := fmt.Sprintf("被举报（#%d）", id)
+		if report.Reason != "" {
+			reason += "：" + report.Reason
+		}
+
+		description, err = tb.applyAction(report.ChatID, user, action, 0, reason, resolvedBy)
+		if err != nil {
+			// 执行失败时恢复为待处理，管理员可以重试
+			if reopenErr := tb.db.ReopenReport(id); reopenErr != nil {
+				log.Printf("恢复举报 #%d 为待处理失败：%v", id, reopenErr)
+			}
+			return "", err
+		}
+	}
+
+	log.Printf("举报 #%d 已由 %d 处理：%s", id, resolvedBy, description)
+	return description, nil
+}
+
+// handleReportCallback 处理举报通知上的按钮，按钮数据已由 handleActionCallback 校验签名
+func (tb *TelegramBot) handleReportCallback(callback *tgbotapi.CallbackQuery, payload *CallbackPayload) {
+	if callback.From.ID != tb.config.Telegram.AdminUserID {
+		tb.outbox.Post(tgbotapi.NewCallback(callback.ID, "只有管理员可以处理举报"))
+		return
+	}
+
+	action := strings.TrimPrefix(payload.Action, callbackReportPrefix)
+	description, err := tb.resolveReport(payload.RecordID, action, callback.From.ID)
+	if err != nil {
+		tb.outbox.Post(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("处理失败：%v", err)))
+		return
+	}
+
+	if callback.Message != nil {
+		edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, callback.Message.Text+"\n\n✅ 已处理："+description)
+		tb.outbox.Post(edit)
+	}
+	tb.outbox.Post(tgbotapi.NewCallback(callback.ID, "已处理："+description))
+}
+
+// displayName 用户名，没有用户名时使用名字
+func displayName(user *tgbotapi.User) string {
+	if user.UserName != "" {
+		return user.UserName
+	}
+	return user.FirstName
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 入群筛查的处理方式
+const (
+	ScreeningBan      = "ban"      // 直接封禁
+	ScreeningCaptcha  = "captcha"  // 强制私聊验证
+	ScreeningRestrict = "restrict" // 一段时间内只能发送文字
+)
+
+// 入群筛查设置未配置时的默认值
+const (
+	defaultScreeningThreshold     = 3
+	defaultScreeningAction        = ScreeningCaptcha
+	defaultScreeningRestrictHours = 24
+	// 用户 ID 大于此值视为新注册的账号（ID 随注册时间递增）
+	defaultNewAccountID int64 = 7000000000
+)
+
+// 各项可疑特征的分数
+const (
+	scoreKeywordName = 3 // 名字或用户名命中关键词
+	scoreRTLOverride = 2 // 名字中含有 RTL 控制字符
+	scoreZalgo       = 2 // 名字中叠加大量组合字符
+	scoreNoUsername  = 1 // 没有用户名
+	scoreNoPhoto     = 1 // 没有头像
+	scoreBot         = 2 // 机器人账号
+	scoreNewAccount  = 1 // 新注册的账号
+)
+
+// zalgoMarks 单个字符后连续出现多少个组合字符视为 zalgo 文字
+const zalgoMarks = 3
+
+// ScreeningResult 入群筛查的结果
+type ScreeningResult struct {
+	Score   int
+	Reasons []string
+}
+
+func (r *ScreeningResult) add(score int, reason string) {
+	r.Score += score
+	r.Reasons = append(r.Reasons, fmt.Sprintf("%s (+%d)", reason, score))
+}
+
+// hasRTLOverride 文本中是否含有改变显示方向的控制字符，常被用来伪装名字
+func hasRTLOverride(s string) bool {
+	for _, r := range s {
+		switch r {
+		case '\u202B', '\u202E', '\u2067', '\u200F', '\u061C':
+			return true
+		}
+	}
+	return false
+}
+
+// hasZalgo 文本中是否有字符叠加了大量组合字符
+func hasZalgo(s string) bool {
+	marks := 0
+	for _, r := range s {
+		if unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) {
+			marks++
+			if marks >= zalgoMarks {
+				return true
+			}
+		} else {
+			marks = 0
+		}
+	}
+	return false
+}
+
+// screenUser 根据新成员的资料和群组设置计算可疑分数
+// 当前使用的 Bot API 库不提供 is_premium 字段，因此不参与评分
+func (tb *TelegramBot) screenUser(chatID int64, user *tgbotapi.User, settings *GroupSettings) *ScreeningResult {
+	result := &ScreeningResult{}
+
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	for _, text := range []string{name, user.UserName} {
+		if text == "" {
+			continue
+		}
+		if check := tb.filter.CheckMessage(text); check.IsViolation {
+			result.add(scoreKeywordName, fmt.Sprintf("名字命中关键词「%s」", check.Keyword))
+			break
+		}
+	}
+
+	if hasRTLOverride(name) {
+		result.add(scoreRTLOverride, "名字含有 RTL 控制字符")
+	}
+	if hasZalgo(name) {
+		result.add(scoreZalgo, "名字含有叠加字符")
+	}
+	if user.UserName == "" {
+		result.add(scoreNoUsername, "没有用户名")
+	}
+
+	// 经发送队列限速，防突袭时大量成员同时加入也不会超出限制
+	var photos tgbotapi.UserProfilePhotos
+	err := tb.outbox.Do(chatID, PriorityNormal, "UserProfilePhotosConfig", func() error {
+		var err error
+		photos, err = tb.bot.GetUserProfilePhotos(tgbotapi.UserProfilePhotosConfig{UserID: user.ID, Limit: 1})
+		return err
+	})
+	if err != nil {
+		log.Printf("获取用户 %d 的头像失败：%v", user.ID, err)
+	} else if photos.TotalCount == 0 {
+		result.add(scoreNoPhoto, "没有头像")
+	}
+
+	if user.IsBot {
+		result.add(scoreBot, "机器人账号")
+	}
+
+	if user.ID > settings.ScreeningNewAccountID {
+		result.add(scoreNewAccount, "新注册的账号")
+	}
+
+	return result
+}
+
+// screenMember 对新成员进行入群筛查，分数达到阈值时按群组设置处理
+// 返回处理方式，未处理时返回空字符串
+func (tb *TelegramBot) screenMember(chat *tgbotapi.Chat, user, actor *tgbotapi.User, settings *GroupSettings) string {
+	if !settings.ScreeningEnabled || user.ID == tb.config.Telegram.AdminUserID {
+		return ""
+	}
+	// 由管理员拉入群组的成员不筛查
+	if actor != nil && actor.ID != user.ID && tb.canModerate(chat.ID, actor.ID) {
+		return ""
+	}
+	if allowed, err := tb.db.IsAllowlisted(chat.ID, user.ID); err != nil {
+		log.Printf("查询白名单失败：%v", err)
+	} else if allowed {
+		return ""
+	}
+
+	result := tb.screenUser(chat.ID, user, settings)
+	if result.Score < settings.ScreeningThreshold {
+		return ""
+	}
+
+	action := settings.ScreeningAction
+	reason := strings.Join(result.Reasons, "、")
+	log.Printf("🔎 群组 %d 的新成员 %s (ID: %d) 可疑分数 %d：%s", chat.ID, displayName(user), user.ID, result.Score, reason)
+
+	var description string
+	switch action {
+	case ScreeningBan:
+		if err := tb.banUser(chat.ID, user.ID, 0); err != nil {
+			return ""
+		}
+		description = "封禁"
+	case ScreeningRestrict:
+		description = fmt.Sprintf("%d 小时内只能发送文字", settings.ScreeningRestrictHours)
+	default:
+		action = ScreeningCaptcha
+		description = "要求私聊验证"
+	}
+
+	if tb.config.Settings.LogViolations {
+		if err := tb.db.LogViolation(user.ID, displayName(user), chat.ID, reason, "入群筛查", action); err != nil {
+			log.Printf("记录违规失败：%v", err)
+		}
+	}
+
+	if adminID := tb.config.Telegram.AdminUserID; adminID != 0 {
+		text := fmt.Sprintf(`🔎 入群筛查
+
+群组: %s (ID: %d)
+用户: %s (ID: %d)
+可疑分数: %d
+原因: %s
+处理: %s`,
+			chat.Title, chat.ID,
+			displayName(user), user.ID,
+			result.Score, reason, description)
+		msg := tgbotapi.NewMessage(adminID, text)
+		if keyboard, ok := tb.callbackKeyboard([]callbackButton{
+			actionButton("↩️ 撤销", callbackUndo, chat.ID, user.ID, 0),
+			actionButton("✅ 加入白名单", callbackAllow, chat.ID, user.ID, 0),
+		}); ok {
+			msg.ReplyMarkup = keyboard
+		}
+		tb.outbox.Post(msg)
+	}
+
+	return action
+}
+
+// restrictMedia 限制用户在指定时间之前只能发送文字
+func (tb *TelegramBot) restrictMedia(chatID, userID int64, until time.Time) error {
+	_, err := tb.outbox.Request(tgbotapi.RestrictChatMemberConfig{
+		ChatMemberConfig: tgbotapi.ChatMemberConfig{
+			ChatID: chatID,
+			UserID: userID,
+		},
+		UntilDate:   until.Unix(),
+		Permissions: textOnlyPermissions(),
+	})
+	if err != nil {
+		log.Printf("限制用户 %d 发送媒体失败：%v", userID, err)
+	}
+	return err
+}
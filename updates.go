@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 更新处理未配置时的默认值
+const (
+	defaultUpdateWorkers   = 8
+	defaultUpdateQueueSize = 100
+)
+
+// updateDispatcher 并发处理更新：按聊天ID分配到固定的 worker，
+// 不同群组互不阻塞，同一聊天中的更新仍按顺序处理
+type updateDispatcher struct {
+	shards []chan tgbotapi.Update
+	wg     sync.WaitGroup
+}
+
+// newUpdateDispatcher 启动 workers 个 worker，每个 worker 的队列最多容纳 queueSize 个更新，
+// 队列满时 dispatch 会阻塞，不再从 Telegram 拉取更新
+func newUpdateDispatcher(workers, queueSize int, handle func(tgbotapi.Update)) *updateDispatcher {
+	if workers <= 0 {
+		workers = defaultUpdateWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultUpdateQueueSize
+	}
+
+	d := &updateDispatcher{shards: make([]chan tgbotapi.Update, workers)}
+	for i := range d.shards {
+		shard := make(chan tgbotapi.Update, queueSize)
+		d.shards[i] = shard
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for update := range shard {
+				handle(update)
+			}
+		}()
+	}
+	return d
+}
+
+// dispatch 将更新交给其聊天对应的 worker
+func (d *updateDispatcher) dispatch(update tgbotapi.Update) {
+	chatID := updateChatID(update)
+	shard := uint64(chatID) % uint64(len(d.shards))
+	d.shards[shard] <- update
+}
+
+// drain 停止接收新的更新，等待队列中已有的更新处理完
+func (d *updateDispatcher) drain() {
+	for _, shard := range d.shards {
+		close(shard)
+	}
+	d.wg.Wait()
+}
+
+// updateChatID 更新所属的聊天，用于保证同一聊天中的更新按顺序处理
+func updateChatID(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat.ID
+	case update.ChannelPost != nil:
+		return update.ChannelPost.Chat.ID
+	case update.EditedChannelPost != nil:
+		return update.EditedChannelPost.Chat.ID
+	case update.ChatMember != nil:
+		return update.ChatMember.Chat.ID
+	case update.CallbackQuery != nil:
+		if update.CallbackQuery.Message != nil {
+			return update.CallbackQuery.Message.Chat.ID
+		}
+		// 内联消息的按钮没有所属的聊天，按点击的用户分配
+		return update.CallbackQuery.From.ID
+	}
+	return 0
+}
+
+// handleUpdate 按更新类型分发给对应的处理函数
+func (tb *TelegramBot) handleUpdate(update tgbotapi.Update) {
+	if update.Message != nil {
+		tb.handleMessage(update.Message)
+	} else if update.EditedMessage != nil {
+		tb.handleEditedMessage(update.EditedMessage)
+	} else if update.ChannelPost != nil {
+		tb.handleChannelPost(update.ChannelPost)
+	} else if update.EditedChannelPost != nil {
+		tb.handleEditedMessage(update.EditedChannelPost)
+	} else if update.ChatMember != nil {
+		tb.handleChatMemberUpdate(update.ChatMember)
+	} else if update.CallbackQuery != nil {
+		tb.handleCallback(update.CallbackQuery)
+	}
+}
+
+// Stop 停止后台任务和拉取更新；Start 会在处理完已收到的更新后返回
+func (tb *TelegramBot) Stop() {
+	tb.stopOnce.Do(func() {
+		log.Println("正在停止接收更新...")
+		close(tb.stopped)
+		tb.stopReceiving()
+	})
+}
+
+// runInBackground 启动随机器人运行的后台任务，run 在 tb.stopped 关闭后应尽快返回
+func (tb *TelegramBot) runInBackground(run func()) {
+	tb.background.Add(1)
+	go func() {
+		defer tb.background.Done()
+		run()
+	}()
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 未配置时使用的警告阶梯和有效期
+const (
+	defaultWarningLadder = "warn,mute:1h,mute:24h,ban"
+	defaultWarningExpiry = 7 * 24 * 3600
+)
+
+// WarningStep 警告阶梯中的一级
+type WarningStep struct {
+	Action   string // warn, delete, mute, tempban, kick, ban
+	Duration time.Duration
+}
+
+func (s WarningStep) String() string {
+	if s.Duration > 0 {
+		return fmt.Sprintf("%s(%s)", s.Action, formatDuration(s.Duration))
+	}
+	return s.Action
+}
+
+// parseWarningLadder 解析警告阶梯，如 "warn,mute:1h,mute:24h,ban"
+func parseWarningLadder(spec string) ([]WarningStep, error) {
+	var steps []WarningStep
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		action, durationText, _ := strings.Cut(part, ":")
+		step := WarningStep{Action: action}
+
+		switch action {
+		case ActionWarn, ActionDelete, ActionKick, ActionBan:
+		case ActionMute, ActionTempBan:
+			if durationText == "" {
+				return nil, fmt.Errorf("%s 需要指定时长: %s", action, part)
+			}
+		default:
+			return nil, fmt.Errorf("未知的动作: %s", action)
+		}
+
+		if durationText != "" {
+			duration, err := parseDuration(durationText)
+			if err != nil {
+				return nil, err
+			}
+			step.Duration = duration
+		}
+
+		steps = append(steps, step)
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("警告阶梯为空")
+	}
+	return steps, nil
+}
+
+// parseDuration 在 time.ParseDuration 的基础上支持以 d 表示天
+func parseDuration(text string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("无效的时长: %s", text)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("无效的时长: %s", text)
+	}
+	return duration, nil
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d天", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%d小时", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%d分钟", d/time.Minute)
+	}
+	return fmt.Sprintf("%d秒", int(d.Seconds()))
+}
+
+// issueWarning 给用户记一次警告，并按群组的警告阶梯执行对应动作，返回执行的动作
+func (tb *TelegramBot) issueWarning(chatID int64, user *tgbotapi.User, reason string, issuedBy int64) (string, error) {
+	settings, err := tb.getGroupSettings(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	ladder, err := parseWarningLadder(settings.WarningLadder)
+	if err != nil {
+		log.Printf("群组 %d 的警告阶梯无效，使用默认阶梯：%v", chatID, err)
+		ladder, _ = parseWarningLadder(defaultWarningLadder)
+	}
+
+	username := user.UserName
+	if username == "" {
+		username = user.FirstName
+	}
+
+	if err := tb.db.AddWarning(chatID, user.ID, username, reason, issuedBy, settings.WarningExpiry); err != nil {
+		return "", err
+	}
+
+	count, err := tb.db.CountActiveWarnings(chatID, user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	// 超过阶梯长度后一直执行最后一级
+	index := count - 1
+	if index >= len(ladder) {
+		index = len(ladder) - 1
+	}
+	step := ladder[index]
+
+	result := "警告"
+	if step.Action != ActionWarn {
+		result, err = tb.applyAction(chatID, user, step.Action, step.Duration, reason, issuedBy)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	notice := fmt.Sprintf("⚠️ %s 收到警告 (%d/%d)\n原因：%s\n处理：%s",
+		user.FirstName, count, len(ladder), reason, result)
+	msg := tgbotapi.NewMessage(chatID, notice)
+	tb.outbox.Post(msg)
+
+	log.Printf("用户 %s (ID: %d) 在群组 %d 收到第 %d 次警告，执行 %s", username, user.ID, chatID, count, step)
+	return step.String(), nil
+}
+
+// handleWarnCommand /warn [原因]，需回复目标用户的消息
+func (tb *TelegramBot) handleWarnCommand(message *tgbotapi.Message, args string) {
+	if message.ReplyToMessage == nil || message.ReplyToMessage.From == nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 用法：回复用户的消息并发送 /warn [原因]")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	reason := strings.TrimSpace(args)
+	if reason == "" {
+		reason = "管理员警告"
+	}
+
+	if _, err := tb.issueWarning(message.Chat.ID, message.ReplyToMessage.From, reason, message.From.ID); err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ 警告失败：%v", err))
+		tb.outbox.Post(msg)
+	}
+}
+
+// handleUnwarnCommand /unwarn，撤销被回复用户最近的一条警告
+func (tb *TelegramBot) handleUnwarnCommand(message *tgbotapi.Message) {
+	if message.ReplyToMessage == nil || message.ReplyToMessage.From == nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 用法：回复用户的消息并发送 /unwarn")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	user := message.ReplyToMessage.From
+	removed, err := tb.db.RemoveLatestWarning(message.Chat.ID, user.ID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ 撤销警告失败：%v", err))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	if !removed {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("ℹ️ %s 没有有效的警告", user.FirstName))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	count, _ := tb.db.CountActiveWarnings(message.Chat.ID, user.ID)
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ 已撤销 %s 的一条警告，当前有效警告 %d 条", user.FirstName, count))
+	tb.outbox.Post(msg)
+}
+
+// handleWarnsCommand /warns [用户ID]，查看用户的警告记录，也可回复用户的消息
+func (tb *TelegramBot) handleWarnsCommand(message *tgbotapi.Message, args string) {
+	var userID int64
+	if message.ReplyToMessage != nil && message.ReplyToMessage.From != nil {
+		userID = message.ReplyToMessage.From.ID
+	} else if id, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64); err == nil {
+		userID = id
+	} else {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 用法：回复用户的消息发送 /warns，或 /warns <用户ID>")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	// 私聊中查看所有群组的记录
+	var chatID int64
+	if message.Chat.IsGroup() || message.Chat.IsSuperGroup() {
+		chatID = message.Chat.ID
+	}
+
+	warnings, err := tb.db.GetWarnings(chatID, userID, 20)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ 获取警告记录失败：%v", err))
+		tb.outbox.Post(msg)
+		return
+	}
+
+	if len(warnings) == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "📋 暂无警告记录")
+		tb.outbox.Post(msg)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("📋 用户 %d 的警告记录：\n\n", userID))
+
+	for _, w := range warnings {
+		status := "有效"
+		if !w.IsActive {
+			status = "已失效"
+		}
+		text.WriteString(fmt.Sprintf("原因: %s\n", w.Reason))
+		text.WriteString(fmt.Sprintf("群组: %d\n", w.ChatID))
+		text.WriteString(fmt.Sprintf("状态: %s (到期 %s)\n", status, w.ExpiresAt.Format("2006-01-02 15:04:05")))
+		text.WriteString(fmt.Sprintf("时间: %s\n", w.CreatedAt.Format("2006-01-02 15:04:05")))
+		text.WriteString("─────────────\n")
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text.String())
+	tb.outbox.Post(msg)
+}
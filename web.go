@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
@@ -19,9 +20,10 @@ type WebServer struct {
 	store      *sessions.CookieStore
 	reloadChan chan struct{} // 添加重载通道
 	bot        *tgbotapi.BotAPI
+	telegram   *TelegramBot
 }
 
-func NewWebServer(config *Config, db *Database, reloadChan chan struct{}, bot *tgbotapi.BotAPI) *WebServer {
+func NewWebServer(config *Config, db *Database, reloadChan chan struct{}, telegram *TelegramBot) *WebServer {
 	// 使用配置的密码作为session密钥
 	store := sessions.NewCookieStore([]byte(config.Server.AdminPassword))
 
@@ -39,7 +41,8 @@ func NewWebServer(config *Config, db *Database, reloadChan chan struct{}, bot *t
 		db:         db,
 		store:      store,
 		reloadChan: reloadChan,
-		bot:        bot,
+		bot:        telegram.bot,
+		telegram:   telegram,
 	}
 }
 
@@ -49,6 +52,13 @@ func (ws *WebServer) Start() error {
 	// 静态文件
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
+	// webhook 模式且未配置独立监听时，在此接收 Telegram 推送的更新，由 secret_token 校验，不需要登录
+	if ws.telegram.webhook != nil && ws.config.Webhook.Listen == "" {
+		if path, err := webhookPath(ws.config); err == nil {
+			r.Handle(path, ws.telegram.webhook)
+		}
+	}
+
 	// 登录相关
 	r.HandleFunc("/login", ws.handleLogin).Methods("GET", "POST")
 	r.HandleFunc("/logout", ws.handleLogout)
@@ -64,15 +74,44 @@ func (ws *WebServer) Start() error {
 	api.HandleFunc("/keywords/{id:[0-9]+}", ws.handleAPIDeleteKeyword).Methods("DELETE")
 	api.HandleFunc("/reload", ws.handleAPIReload).Methods("POST")
 	api.HandleFunc("/group-settings/{chatID}", ws.handleAPIGroupSettings).Methods("GET", "POST")
+	api.HandleFunc("/group-settings/{chatID}/preview", ws.handleAPIWelcomePreview).Methods("POST")
 	api.HandleFunc("/messages/mute/{userID:[0-9]+}", ws.handleAPIMuteUser).Methods("POST")
 	api.HandleFunc("/messages/kick/{userID:[0-9]+}", ws.handleAPIKickUser).Methods("POST")
+	api.HandleFunc("/messages/purge/{userID:[0-9]+}", ws.handleAPIPurgeUser).Methods("POST")
+	api.HandleFunc("/actions", ws.handleAPIAction).Methods("POST")
 	api.HandleFunc("/messages", ws.handleAPIMessages).Methods("GET")
+	api.HandleFunc("/messages/{chatID}/{messageID:[0-9]+}/edits", ws.handleAPIMessageEdits).Methods("GET")
+	api.HandleFunc("/warnings", ws.handleAPIWarnings).Methods("GET")
+	api.HandleFunc("/warnings/{id:[0-9]+}", ws.handleAPIDeleteWarning).Methods("DELETE")
+	api.HandleFunc("/allowlist/{chatID}", ws.handleAPIAllowlist).Methods("GET", "POST")
+	api.HandleFunc("/allowlist/{chatID}/{userID:[0-9]+}", ws.handleAPIDeleteAllowlist).Methods("DELETE")
+	api.HandleFunc("/members", ws.handleAPIMembershipEvents).Methods("GET")
+	api.HandleFunc("/announcements", ws.handleAPIAnnouncements).Methods("GET", "POST")
+	api.HandleFunc("/announcements/{id:[0-9]+}", ws.handleAPIDeleteAnnouncement).Methods("DELETE")
+	api.HandleFunc("/announcements/{id:[0-9]+}/{state:enable|disable}", ws.handleAPIToggleAnnouncement).Methods("POST")
+	api.HandleFunc("/gbans", ws.handleAPIGlobalBans).Methods("GET", "POST")
+	api.HandleFunc("/gbans/export", ws.handleAPIExportGlobalBans).Methods("GET")
+	api.HandleFunc("/gbans/import", ws.handleAPIImportGlobalBans).Methods("POST")
+	api.HandleFunc("/gbans/{userID:[0-9]+}", ws.handleAPIDeleteGlobalBan).Methods("DELETE")
+	api.HandleFunc("/appeals", ws.handleAPIAppeals).Methods("GET")
+	api.HandleFunc("/appeals/{id:[0-9]+}/{decision:approve|reject}", ws.handleAPIResolveAppeal).Methods("POST")
+	api.HandleFunc("/reports", ws.handleAPIReports).Methods("GET")
+	api.HandleFunc("/reports/stats", ws.handleAPIReportStats).Methods("GET")
+	api.HandleFunc("/reports/{id:[0-9]+}/{action}", ws.handleAPIResolveReport).Methods("POST")
+	api.HandleFunc("/outbox", ws.handleAPIOutboxStats).Methods("GET")
 
 	// 页面路由
 	r.HandleFunc("/", ws.authMiddleware(ws.handleDashboard))
 	r.HandleFunc("/keywords", ws.authMiddleware(ws.handleKeywords))
 	r.HandleFunc("/violations", ws.authMiddleware(ws.handleViolations))
 	r.HandleFunc("/messages", ws.authMiddleware(ws.handleMessages))
+	r.HandleFunc("/groups", ws.authMiddleware(ws.handleGroups))
+	r.HandleFunc("/announcements", ws.authMiddleware(ws.handleAnnouncements))
+	r.HandleFunc("/warnings", ws.authMiddleware(ws.handleWarnings))
+	r.HandleFunc("/members", ws.authMiddleware(ws.handleMembers))
+	r.HandleFunc("/gbans", ws.authMiddleware(ws.handleGlobalBans))
+	r.HandleFunc("/appeals", ws.authMiddleware(ws.handleAppeals))
+	r.HandleFunc("/reports", ws.authMiddleware(ws.handleReports))
 
 	return http.ListenAndServe(ws.config.Server.Port, r)
 }
@@ -114,147 +153,901 @@ func (ws *WebServer) handleLogin(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 如果已经登录，直接跳转到首页
-	if auth, ok := session.Values["authenticated"].(bool); ok && auth {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	// 如果已经登录，直接跳转到首页
+	if auth, ok := session.Values["authenticated"].(bool); ok && auth {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	tmpl := `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>登录 - Telegram Bot 管理面板</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 0; padding: 0; background: #f5f5f5; }
+        .login-container { 
+            max-width: 400px; 
+            margin: 100px auto; 
+            padding: 20px;
+            background: white;
+            border-radius: 8px;
+            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
+        }
+        .form-group { margin-bottom: 15px; }
+        .form-group label { display: block; margin-bottom: 5px; }
+        .form-group input { 
+            width: 100%; 
+            padding: 8px; 
+            border: 1px solid #ddd; 
+            border-radius: 4px;
+            box-sizing: border-box;
+        }
+        .btn {
+            background: #007bff;
+            color: white;
+            padding: 10px 20px;
+            border: none;
+            border-radius: 4px;
+            cursor: pointer;
+            width: 100%;
+        }
+        .btn:hover { background: #0056b3; }
+        h1 { text-align: center; color: #333; }
+        .error-message {
+            color: #dc3545;
+            margin-bottom: 15px;
+            text-align: center;
+        }
+    </style>
+</head>
+<body>
+    <div class="login-container">
+        <h1>管理员登录</h1>
+        <form method="POST" action="/login">
+            <div class="form-group">
+                <label>密码:</label>
+                <input type="password" name="password" required>
+            </div>
+            <button type="submit" class="btn">登录</button>
+        </form>
+    </div>
+</body>
+</html>`
+
+	t := template.Must(template.New("login").Parse(tmpl))
+	t.Execute(w, nil)
+}
+
+func (ws *WebServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	session, err := ws.store.Get(r, "admin-session")
+	if err != nil {
+		http.Error(w, "Session错误", http.StatusInternalServerError)
+		return
+	}
+
+	session.Values["authenticated"] = false
+	session.Options.MaxAge = -1 // 使cookie立即过期
+	err = session.Save(r, w)
+	if err != nil {
+		http.Error(w, "保存Session失败", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (ws *WebServer) handleAPIReload(w http.ResponseWriter, r *http.Request) {
+	// 重新加载关键词
+	keywords, err := ws.db.GetKeywords()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 通知bot重新加载关键词
+	select {
+	case ws.reloadChan <- struct{}{}:
+		log.Printf("已发送重载信号")
+	default:
+		log.Printf("重载通道已满，跳过发送信号")
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "关键词已重新加载",
+		"count":   len(keywords),
+	})
+}
+
+func (ws *WebServer) handleAPIGroupSettings(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.ParseInt(vars["chatID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的群组ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "GET" {
+		settings, err := ws.db.GetGroupSettings(chatID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if settings == nil {
+			settings = ws.config.DefaultGroupSettings(chatID)
+		}
+		json.NewEncoder(w).Encode(settings)
+		return
+	}
+
+	if r.Method == "POST" {
+		var settings GroupSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if settings.WarningLadder != "" {
+			if _, err := parseWarningLadder(settings.WarningLadder); err != nil {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success": false,
+					"error":   "警告阶梯无效: " + err.Error(),
+				})
+				return
+			}
+		}
+
+		if _, err := parseMediaPolicy(settings.MediaPolicy); err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "媒体策略无效: " + err.Error(),
+			})
+			return
+		}
+
+		switch settings.ForwardChannelPolicy {
+		case "", ForwardChannelBlock, ForwardChannelAllowlist:
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "未知的频道转发策略: " + settings.ForwardChannelPolicy,
+			})
+			return
+		}
+		if settings.ForwardAction != "" {
+			if _, err := parseActionStep(settings.ForwardAction); err != nil {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success": false,
+					"error":   "转发处理动作无效: " + err.Error(),
+				})
+				return
+			}
+		}
+
+		if settings.NightModeEnabled {
+			if _, err := parseNightSchedule(&settings); err != nil {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success": false,
+					"error":   "夜间模式设置无效: " + err.Error(),
+				})
+				return
+			}
+		}
+
+		settings.ChatID = chatID
+		if err := ws.db.UpdateGroupSettings(&settings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}
+}
+
+// 预览欢迎消息模板，使用示例用户渲染
+func (ws *WebServer) handleAPIWelcomePreview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	chatID, err := strconv.ParseInt(vars["chatID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的群组ID", http.StatusBadRequest)
+		return
+	}
+
+	var settings GroupSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groupName := "示例群组"
+	if chat, err := ws.db.GetChat(chatID); err == nil && chat != nil {
+		groupName = chat.Title
+	}
+
+	memberCount, err := ws.bot.GetChatMembersCount(tgbotapi.ChatMemberCountConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+	})
+	if err != nil {
+		memberCount = 0
+	}
+
+	rendered, err := RenderWelcome(&settings, WelcomeData{
+		UserID:      123456789,
+		FirstName:   "张三",
+		UserName:    "example_user",
+		GroupName:   groupName,
+		MemberCount: memberCount,
+		Date:        time.Now(),
+	})
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"preview": rendered,
+	})
+}
+
+// 群组设置页面
+func (ws *WebServer) handleGroups(w http.ResponseWriter, r *http.Request) {
+	chats, err := ws.db.GetAllChats()
+	if err != nil {
+		http.Error(w, "获取群组列表失败", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/groups.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Chats": chats,
+	})
+}
+
+// 定时消息页面
+func (ws *WebServer) handleAnnouncements(w http.ResponseWriter, r *http.Request) {
+	chats, err := ws.db.GetAllChats()
+	if err != nil {
+		http.Error(w, "获取群组列表失败", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/announcements.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Chats": chats,
+	})
+}
+
+// 定时消息的API，GET 返回列表（可按群组过滤），POST 添加定时消息
+func (ws *WebServer) handleAPIAnnouncements(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "GET" {
+		chatID, _ := strconv.ParseInt(r.URL.Query().Get("chat_id"), 10, 64)
+		announcements, err := ws.db.GetAnnouncements(chatID)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "获取定时消息失败: " + err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":       true,
+			"announcements": announcements,
+		})
+		return
+	}
+
+	var req struct {
+		ChatID         int64  `json:"chat_id,string"`
+		Text           string `json:"text"`
+		ParseMode      string `json:"parse_mode"`
+		Media          string `json:"media"`
+		MediaType      string `json:"media_type"`
+		NextRun        string `json:"next_run"` // 2006-01-02T15:04，服务器本地时间
+		Interval       int    `json:"interval"`
+		Pin            bool   `json:"pin"`
+		DeletePrevious bool   `json:"delete_previous"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nextRun, err := time.ParseInLocation("2006-01-02T15:04", req.NextRun, time.Local)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的发送时间",
+		})
+		return
+	}
+
+	announcement := &Announcement{
+		ChatID:         req.ChatID,
+		Text:           req.Text,
+		ParseMode:      req.ParseMode,
+		Media:          req.Media,
+		MediaType:      req.MediaType,
+		NextRun:        nextRun,
+		Interval:       req.Interval,
+		Pin:            req.Pin,
+		DeletePrevious: req.DeletePrevious,
+		CreatedBy:      ws.config.Telegram.AdminUserID,
+	}
+	if err := validateAnnouncement(announcement); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if _, err := ws.db.AddAnnouncement(announcement); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// 启用或停用定时消息的API
+func (ws *WebServer) handleAPIToggleAnnouncement(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的ID", http.StatusBadRequest)
+		return
+	}
+
+	found, err := ws.db.SetAnnouncementEnabled(id, vars["state"] == "enable")
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !found {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "定时消息不存在",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// 删除定时消息的API
+func (ws *WebServer) handleAPIDeleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的ID", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := ws.db.DeleteAnnouncement(0, id)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !deleted {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "定时消息不存在",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// 查询警告记录的API，可按用户和群组过滤
+func (ws *WebServer) handleAPIWarnings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	chatID, _ := strconv.ParseInt(r.URL.Query().Get("chat_id"), 10, 64)
+
+	warnings, err := ws.db.GetWarnings(chatID, userID, 100)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取警告记录失败: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"warnings": warnings,
+	})
+}
+
+// 撤销警告的API
+func (ws *WebServer) handleAPIDeleteWarning(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "无效的ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := ws.db.RemoveWarning(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// 警告记录页面
+func (ws *WebServer) handleWarnings(w http.ResponseWriter, r *http.Request) {
+	chats, err := ws.db.GetAllChats()
+	if err != nil {
+		http.Error(w, "获取群组列表失败", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/warnings.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Chats":  chats,
+		"UserID": r.URL.Query().Get("user_id"),
+	})
+}
+
+// 成员变动记录的API，可按用户和群组过滤
+func (ws *WebServer) handleAPIMembershipEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	chatID, _ := strconv.ParseInt(r.URL.Query().Get("chat_id"), 10, 64)
+
+	events, err := ws.db.GetMembershipEvents(chatID, userID, 200)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取成员记录失败: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"events":  events,
+	})
+}
+
+// 成员记录页面
+func (ws *WebServer) handleMembers(w http.ResponseWriter, r *http.Request) {
+	chats, err := ws.db.GetAllChats()
+	if err != nil {
+		http.Error(w, "获取群组列表失败", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/members.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Chats":  chats,
+		"UserID": r.URL.Query().Get("user_id"),
+	})
+}
+
+// 全局封禁列表的API，GET 返回列表，POST 添加全局封禁并在所有群组中执行
+func (ws *WebServer) handleAPIGlobalBans(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "GET" {
+		bans, err := ws.db.GetGlobalBans()
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "获取全局封禁列表失败: " + err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"bans":    bans,
+		})
+		return
+	}
+
+	var req struct {
+		UserID   int64  `json:"user_id"`
+		Username string `json:"username"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.UserID == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "缺少用户ID",
+		})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "管理面板全局封禁"
+	}
+
+	user := &tgbotapi.User{ID: req.UserID, UserName: req.Username, FirstName: strconv.FormatInt(req.UserID, 10)}
+	applied, failed, err := ws.telegram.globalBan(user, req.Reason, ws.config.Telegram.AdminUserID)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("已在 %d 个群组中封禁，%d 个群组失败", applied, failed),
+	})
+}
+
+// 群组白名单的API
+func (ws *WebServer) handleAPIAllowlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	chatID, err := strconv.ParseInt(mux.Vars(r)["chatID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的群组ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "GET" {
+		entries, err := ws.db.GetAllowlist(chatID)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "获取白名单失败: " + err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"entries": entries,
+		})
+		return
+	}
+
+	var req struct {
+		UserID   int64  `json:"user_id"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.UserID == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "缺少用户ID",
+		})
+		return
+	}
+
+	err = ws.db.AddToAllowlist(&AllowlistEntry{
+		ChatID:   chatID,
+		UserID:   req.UserID,
+		Username: req.Username,
+		AddedBy:  ws.config.Telegram.AdminUserID,
+	})
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// 移出群组白名单的API
+func (ws *WebServer) handleAPIDeleteAllowlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	chatID, err := strconv.ParseInt(vars["chatID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的群组ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := strconv.ParseInt(vars["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的用户ID", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := ws.db.RemoveFromAllowlist(chatID, userID)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !removed {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "用户不在白名单中",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// 解除全局封禁的API
+func (ws *WebServer) handleAPIDeleteGlobalBan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseInt(vars["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的用户ID", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := ws.telegram.globalUnban(userID)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !removed {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "用户不在全局封禁列表中",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// 导出全局封禁列表为 JSON 文件
+func (ws *WebServer) handleAPIExportGlobalBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := ws.db.GetGlobalBans()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if bans == nil {
+		bans = []GlobalBan{}
+	}
+
+	filename := fmt.Sprintf("gbans-%s.json", time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(bans)
+}
+
+// 导入全局封禁列表，请求体为导出的 JSON 数组
+// 导入后在后台对所有群组执行封禁
+func (ws *WebServer) handleAPIImportGlobalBans(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var bans []GlobalBan
+	if err := json.NewDecoder(r.Body).Decode(&bans); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的 JSON: " + err.Error(),
+		})
+		return
+	}
+
+	var imported []int64
+	for i := range bans {
+		if bans[i].UserID == 0 {
+			continue
+		}
+		if err := ws.db.ImportGlobalBan(&bans[i]); err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("导入用户 %d 失败: %v", bans[i].UserID, err),
+			})
+			return
+		}
+		imported = append(imported, bans[i].UserID)
+	}
+
+	go func() {
+		for _, userID := range imported {
+			ws.telegram.applyGlobalBan(userID)
+		}
+		log.Printf("✅ 已导入 %d 条全局封禁记录并在各群组中执行", len(imported))
+	}()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("已导入 %d 条记录，正在各群组中执行封禁", len(imported)),
+	})
+}
+
+// 全局封禁页面
+func (ws *WebServer) handleGlobalBans(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/gbans.html"))
+	tmpl.Execute(w, nil)
+}
+
+// 申诉列表的API，可按状态过滤
+func (ws *WebServer) handleAPIAppeals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	appeals, err := ws.db.GetAppeals(r.URL.Query().Get("status"), 100)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取申诉列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"appeals": appeals,
+	})
+}
+
+// 处理申诉的API，通过时撤销原处理动作
+func (ws *WebServer) handleAPIResolveAppeal(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "无效的ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := ws.telegram.resolveAppeal(id, vars["decision"] == "approve", ws.config.Telegram.AdminUserID); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
 		return
 	}
 
-	tmpl := `<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>登录 - Telegram Bot 管理面板</title>
-    <style>
-        body { font-family: Arial, sans-serif; margin: 0; padding: 0; background: #f5f5f5; }
-        .login-container { 
-            max-width: 400px; 
-            margin: 100px auto; 
-            padding: 20px;
-            background: white;
-            border-radius: 8px;
-            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
-        }
-        .form-group { margin-bottom: 15px; }
-        .form-group label { display: block; margin-bottom: 5px; }
-        .form-group input { 
-            width: 100%; 
-            padding: 8px; 
-            border: 1px solid #ddd; 
-            border-radius: 4px;
-            box-sizing: border-box;
-        }
-        .btn {
-            background: #007bff;
-            color: white;
-            padding: 10px 20px;
-            border: none;
-            border-radius: 4px;
-            cursor: pointer;
-            width: 100%;
-        }
-        .btn:hover { background: #0056b3; }
-        h1 { text-align: center; color: #333; }
-        .error-message {
-            color: #dc3545;
-            margin-bottom: 15px;
-            text-align: center;
-        }
-    </style>
-</head>
-<body>
-    <div class="login-container">
-        <h1>管理员登录</h1>
-        <form method="POST" action="/login">
-            <div class="form-group">
-                <label>密码:</label>
-                <input type="password" name="password" required>
-            </div>
-            <button type="submit" class="btn">登录</button>
-        </form>
-    </div>
-</body>
-</html>`
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
 
-	t := template.Must(template.New("login").Parse(tmpl))
-	t.Execute(w, nil)
+// 申诉处理页面
+func (ws *WebServer) handleAppeals(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/appeals.html"))
+	tmpl.Execute(w, nil)
 }
 
-func (ws *WebServer) handleLogout(w http.ResponseWriter, r *http.Request) {
-	session, err := ws.store.Get(r, "admin-session")
+// 举报列表的API，可按状态过滤
+func (ws *WebServer) handleAPIReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	reports, err := ws.db.GetReports(r.URL.Query().Get("status"), 100)
 	if err != nil {
-		http.Error(w, "Session错误", http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取举报列表失败: " + err.Error(),
+		})
 		return
 	}
 
-	session.Values["authenticated"] = false
-	session.Options.MaxAge = -1 // 使cookie立即过期
-	err = session.Save(r, w)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"reports": reports,
+	})
+}
+
+// 举报统计的API：各状态数量和举报者信誉
+func (ws *WebServer) handleAPIReportStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	counts, err := ws.db.CountReportsByStatus()
 	if err != nil {
-		http.Error(w, "保存Session失败", http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
 		return
 	}
 
-	http.Redirect(w, r, "/login", http.StatusSeeOther)
-}
-
-func (ws *WebServer) handleAPIReload(w http.ResponseWriter, r *http.Request) {
-	// 重新加载关键词
-	keywords, err := ws.db.GetKeywords()
+	stats, err := ws.db.GetTopReporters(20)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
 		return
 	}
 
-	// 通知bot重新加载关键词
-	select {
-	case ws.reloadChan <- struct{}{}:
-		log.Printf("已发送重载信号")
-	default:
-		log.Printf("重载通道已满，跳过发送信号")
+	type reporter struct {
+		ReporterStats
+		Reputation float64 `json:"reputation"`
+	}
+	reporters := []reporter{}
+	for _, s := range stats {
+		reporters = append(reporters, reporter{ReporterStats: s, Reputation: s.Reputation()})
 	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "关键词已重新加载",
-		"count":   len(keywords),
+		"success":   true,
+		"counts":    counts,
+		"reporters": reporters,
 	})
 }
 
-func (ws *WebServer) handleAPIGroupSettings(w http.ResponseWriter, r *http.Request) {
+// 处理举报的API，action 为 delete, warn, mute, ban 或 dismiss
+func (ws *WebServer) handleAPIResolveReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
 	vars := mux.Vars(r)
-	chatID, err := strconv.ParseInt(vars["chatID"], 10, 64)
+	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "无效的群组ID", http.StatusBadRequest)
+		http.Error(w, "无效的ID", http.StatusBadRequest)
 		return
 	}
 
-	if r.Method == "GET" {
-		settings, err := ws.db.GetGroupSettings(chatID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		json.NewEncoder(w).Encode(settings)
+	description, err := ws.telegram.resolveReport(id, vars["action"], ws.config.Telegram.AdminUserID)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
 		return
 	}
 
-	if r.Method == "POST" {
-		var settings GroupSettings
-		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "已处理：" + description,
+	})
+}
 
-		settings.ChatID = chatID
-		if err := ws.db.UpdateGroupSettings(&settings); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+// 举报处理页面
+func (ws *WebServer) handleReports(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/reports.html"))
+	tmpl.Execute(w, nil)
+}
 
-		json.NewEncoder(w).Encode(map[string]bool{"success": true})
-	}
+// 发送队列统计的API：排队数量、重试、限流和各类请求的失败次数
+func (ws *WebServer) handleAPIOutboxStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"stats":   ws.telegram.outbox.Stats(),
+	})
 }
 
 // 仪表板页面
@@ -266,10 +1059,12 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		KeywordCount     int
 		ViolationCount   int
 		RecentViolations []Violation
+		Outbox           OutboxStats
 	}{
 		KeywordCount:     len(keywords),
 		ViolationCount:   len(violations),
 		RecentViolations: violations,
+		Outbox:           ws.telegram.outbox.Stats(),
 	}
 
 	tmpl := `<!DOCTYPE html>
@@ -303,6 +1098,13 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             <a href="/keywords">关键词管理</a>
             <a href="/violations">违规记录</a>
             <a href="/messages">消息列表</a>
+            <a href="/groups">群组设置</a>
+            <a href="/announcements">定时消息</a>
+            <a href="/warnings">警告记录</a>
+            <a href="/members">成员记录</a>
+            <a href="/gbans">全局封禁</a>
+            <a href="/appeals">申诉处理</a>
+            <a href="/reports">举报处理</a>
         </div>
         
         <div class="stats">
@@ -314,7 +1116,22 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 <h3>{{.ViolationCount}}</h3>
                 <p>最近违规</p>
             </div>
+            <div class="stat-card">
+                <h3>{{.Outbox.Queued}}</h3>
+                <p>发送队列</p>
+            </div>
+            <div class="stat-card">
+                <h3>{{.Outbox.RateLimited}}</h3>
+                <p>限流次数</p>
+            </div>
+            <div class="stat-card">
+                <h3>{{.Outbox.Failed}}</h3>
+                <p>发送失败</p>
+            </div>
         </div>
+        {{if .Outbox.LastError}}
+        <p>最近一次发送失败：{{.Outbox.LastError}}{{if .Outbox.LastErrorAt}}（{{.Outbox.LastErrorAt.Format "2006-01-02 15:04:05"}}）{{end}}</p>
+        {{end}}
         
         <h3>最近违规记录</h3>
         <table>
@@ -384,6 +1201,13 @@ func (ws *WebServer) handleKeywords(w http.ResponseWriter, r *http.Request) {
             <a href="/keywords">关键词管理</a>
             <a href="/violations">违规记录</a>
             <a href="/messages">消息列表</a>
+            <a href="/groups">群组设置</a>
+            <a href="/announcements">定时消息</a>
+            <a href="/warnings">警告记录</a>
+            <a href="/members">成员记录</a>
+            <a href="/gbans">全局封禁</a>
+            <a href="/appeals">申诉处理</a>
+            <a href="/reports">举报处理</a>
         </div>
         
         <div class="add-form">
@@ -404,10 +1228,23 @@ func (ws *WebServer) handleKeywords(w http.ResponseWriter, r *http.Request) {
                 <div class="form-group">
                     <label>动作:</label>
                     <select id="action">
+                        <option value="delete">仅删除</option>
+                        <option value="warn">警告</option>
                         <option value="mute">禁言</option>
-                        <option value="kick">踢出</option>
+                        <option value="tempban">临时封禁</option>
+                        <option value="ban">永久封禁</option>
+                        <option value="kick">移出（可重新加入）</option>
                     </select>
                 </div>
+                <div class="form-group">
+                    <label>时长（秒，仅禁言和临时封禁，0 使用全局设置）:</label>
+                    <input type="number" id="duration" min="0" value="0">
+                </div>
+                <div class="form-group">
+                    <label><input type="checkbox" id="deleteMessage" checked> 删除触发的消息</label>
+                    <label><input type="checkbox" id="notifyAdmin" checked> 通知管理员</label>
+                    <label><input type="checkbox" id="purgeRecent"> 同时删除该用户近期的消息</label>
+                </div>
                 <button type="submit" class="btn">添加关键词</button>
             </form>
         </div>
@@ -419,6 +1256,7 @@ func (ws *WebServer) handleKeywords(w http.ResponseWriter, r *http.Request) {
                     <th>关键词</th>
                     <th>匹配类型</th>
                     <th>动作</th>
+                    <th>参数</th>
                     <th>创建时间</th>
                     <th>操作</th>
                 </tr>
@@ -430,6 +1268,7 @@ func (ws *WebServer) handleKeywords(w http.ResponseWriter, r *http.Request) {
                     <td>{{.Keyword}}</td>
                     <td>{{.MatchType}}</td>
                     <td>{{.Action}}</td>
+                    <td>{{options .}}</td>
                     <td>{{.CreatedAt.Format "2006-01-02 15:04:05"}}</td>
                     <td>
                         <button class="btn btn-danger" onclick="deleteKeyword({{.ID}})">删除</button>
@@ -456,7 +1295,11 @@ func (ws *WebServer) handleKeywords(w http.ResponseWriter, r *http.Request) {
                 body: JSON.stringify({
                     keyword: keyword,
                     match_type: matchType,
-                    action: action
+                    action: action,
+                    duration: parseInt(document.getElementById('duration').value) || 0,
+                    delete_message: document.getElementById('deleteMessage').checked,
+                    notify_admin: document.getElementById('notifyAdmin').checked,
+                    purge_recent: document.getElementById('purgeRecent').checked
                 })
             })
             .then(response => response.json())
@@ -488,7 +1331,7 @@ func (ws *WebServer) handleKeywords(w http.ResponseWriter, r *http.Request) {
 </body>
 </html>`
 
-	t := template.Must(template.New("keywords").Parse(tmpl))
+	t := template.Must(template.New("keywords").Funcs(template.FuncMap{"options": describeKeywordOptions}).Parse(tmpl))
 	t.Execute(w, struct{ Keywords []Keyword }{Keywords: keywords})
 }
 
@@ -522,6 +1365,13 @@ func (ws *WebServer) handleViolations(w http.ResponseWriter, r *http.Request) {
             <a href="/keywords">关键词管理</a>
             <a href="/violations">违规记录</a>
             <a href="/messages">消息列表</a>
+            <a href="/groups">群组设置</a>
+            <a href="/announcements">定时消息</a>
+            <a href="/warnings">警告记录</a>
+            <a href="/members">成员记录</a>
+            <a href="/gbans">全局封禁</a>
+            <a href="/appeals">申诉处理</a>
+            <a href="/reports">举报处理</a>
         </div>
         
         <table>
@@ -611,6 +1461,37 @@ func (ws *WebServer) handleAPIMessages(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// 消息编辑历史的API
+func (ws *WebServer) handleAPIMessageEdits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	chatID, err := strconv.ParseInt(vars["chatID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的群组ID", http.StatusBadRequest)
+		return
+	}
+	messageID, err := strconv.Atoi(vars["messageID"])
+	if err != nil {
+		http.Error(w, "无效的消息ID", http.StatusBadRequest)
+		return
+	}
+
+	edits, err := ws.db.GetMessageEdits(chatID, messageID)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取编辑历史失败: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"edits":   edits,
+	})
+}
+
 // 修改消息列表页面模板
 func (ws *WebServer) handleMessages(w http.ResponseWriter, r *http.Request) {
 	// 获取所有群组列表供选择
@@ -626,38 +1507,76 @@ func (ws *WebServer) handleMessages(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// 处理禁言用户的API
+// 对用户执行处理动作的API
+// 请求体：{"chat_id": 群组ID, "user_id": 用户ID, "action": 动作, "duration": 时长（秒，可选）, "reason": 原因}
+func (ws *WebServer) handleAPIAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		ChatID   int64  `json:"chat_id"`
+		UserID   int64  `json:"user_id"`
+		Action   string `json:"action"`
+		Duration int    `json:"duration"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ws.executeAction(w, req.ChatID, req.UserID, req.Action, time.Duration(req.Duration)*time.Second, req.Reason)
+}
+
+// 处理禁言用户的API，群组ID通过 chat_id 参数传入
 func (ws *WebServer) handleAPIMuteUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
 	vars := mux.Vars(r)
 	userID, err := strconv.ParseInt(vars["userID"], 10, 64)
 	if err != nil {
 		http.Error(w, "无效的用户ID", http.StatusBadRequest)
 		return
 	}
+	chatID, _ := strconv.ParseInt(r.URL.Query().Get("chat_id"), 10, 64)
 
-	// 获取群组ID（从请求参数或session中）
-	chatID := ws.config.Telegram.AdminUserID // 临时使用管理员的chat ID
+	ws.executeAction(w, chatID, userID, ActionMute, 0, "管理面板操作")
+}
 
-	// 执行禁言操作
-	restrictConfig := tgbotapi.RestrictChatMemberConfig{
-		ChatMemberConfig: tgbotapi.ChatMemberConfig{
-			ChatID: chatID,
-			UserID: userID,
-		},
-		UntilDate: time.Now().Add(24 * time.Hour).Unix(), // 禁言24小时
-		Permissions: &tgbotapi.ChatPermissions{
-			CanSendMessages:       false,
-			CanSendMediaMessages:  false,
-			CanSendPolls:          false,
-			CanSendOtherMessages:  false,
-			CanAddWebPagePreviews: false,
-			CanChangeInfo:         false,
-			CanInviteUsers:        false,
-			CanPinMessages:        false,
-		},
+// 处理踢出用户的API，群组ID通过 chat_id 参数传入
+func (ws *WebServer) handleAPIKickUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseInt(vars["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的用户ID", http.StatusBadRequest)
+		return
+	}
+	chatID, _ := strconv.ParseInt(r.URL.Query().Get("chat_id"), 10, 64)
+
+	ws.executeAction(w, chatID, userID, ActionKick, 0, "管理面板操作")
+}
+
+// 清除用户近期消息的API，群组ID通过 chat_id 参数传入，minutes 为空时使用群组设置
+func (ws *WebServer) handleAPIPurgeUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseInt(vars["userID"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的用户ID", http.StatusBadRequest)
+		return
+	}
+	chatID, _ := strconv.ParseInt(r.URL.Query().Get("chat_id"), 10, 64)
+	if chatID == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "缺少群组ID",
+		})
+		return
 	}
 
-	_, err = ws.bot.Request(restrictConfig)
+	settings, err := ws.telegram.getGroupSettings(chatID)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -666,33 +1585,41 @@ func (ws *WebServer) handleAPIMuteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	minutes := settings.PurgeWindow
+	if m, err := strconv.Atoi(r.URL.Query().Get("minutes")); err == nil && m > 0 {
+		minutes = m
+	}
+
+	count := ws.telegram.purgeRecentMessages(chatID, userID, time.Duration(minutes)*time.Minute)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"message": "用户已被禁言",
+		"message": fmt.Sprintf("已清除最近 %d 分钟内的 %d 条消息", minutes, count),
 	})
 }
 
-// 处理踢出用户的API
-func (ws *WebServer) handleAPIKickUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID, err := strconv.ParseInt(vars["userID"], 10, 64)
-	if err != nil {
-		http.Error(w, "无效的用户ID", http.StatusBadRequest)
+func (ws *WebServer) executeAction(w http.ResponseWriter, chatID, userID int64, action string, duration time.Duration, reason string) {
+	if chatID == 0 || userID == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "缺少群组ID或用户ID",
+		})
 		return
 	}
 
-	// 获取群组ID（从请求参数或session中）
-	chatID := ws.config.Telegram.AdminUserID // 临时使用管理员的chat ID
+	if !isValidAction(action) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "未知的动作: " + action,
+		})
+		return
+	}
 
-	// 执行踢出操作
-	kickConfig := tgbotapi.KickChatMemberConfig{
-		ChatMemberConfig: tgbotapi.ChatMemberConfig{
-			ChatID: chatID,
-			UserID: userID,
-		},
+	if reason == "" {
+		reason = "管理面板操作"
 	}
 
-	_, err = ws.bot.Request(kickConfig)
+	user := &tgbotapi.User{ID: userID, FirstName: strconv.FormatInt(userID, 10)}
+	description, err := ws.telegram.applyAction(chatID, user, action, duration, reason, ws.config.Telegram.AdminUserID)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -703,7 +1630,7 @@ func (ws *WebServer) handleAPIKickUser(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"message": "用户已被踢出",
+		"message": "已" + description,
 	})
 }
 
@@ -736,18 +1663,31 @@ func (ws *WebServer) handleAPIKeywords(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == "POST" {
-		var keyword struct {
-			Keyword   string `json:"keyword"`
-			MatchType string `json:"match_type"`
-			Action    string `json:"action"`
-		}
+		// 未提供的参数使用默认值：删除消息并通知管理员
+		keyword := Keyword{DeleteMessage: true, NotifyAdmin: true}
 
 		if err := json.NewDecoder(r.Body).Decode(&keyword); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		err := ws.db.AddKeyword(keyword.Keyword, keyword.MatchType, keyword.Action)
+		if !isKeywordAction(keyword.Action) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "未知的动作: " + keyword.Action,
+			})
+			return
+		}
+
+		if keyword.Duration < 0 {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "时长不能为负数",
+			})
+			return
+		}
+
+		err := ws.db.AddKeyword(&keyword)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// webhookSecretHeader Telegram 推送更新时携带 secret_token 的请求头
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookSecretPattern Telegram 对 secret_token 的要求
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// webhookReceiver 接收 Telegram 推送的更新，校验 secret_token 后交给 Start 处理
+type webhookReceiver struct {
+	secret  string
+	updates chan tgbotapi.Update
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newWebhookReceiver(secret string, queueSize int) *webhookReceiver {
+	if queueSize <= 0 {
+		queueSize = defaultUpdateQueueSize
+	}
+	return &webhookReceiver{secret: secret, updates: make(chan tgbotapi.Update, queueSize)}
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.Header.Get(webhookSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(wr.secret)) != 1 {
+		log.Printf("⚠️ 收到 secret_token 不正确的 webhook 请求，来自 %s", r.RemoteAddr)
+		http.Error(w, "secret_token 不正确", http.StatusForbidden)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "无效的更新: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+	if wr.closed {
+		// 返回错误让 Telegram 稍后重试，重启后不会丢失更新
+		http.Error(w, "正在关闭", http.StatusServiceUnavailable)
+		return
+	}
+	// 队列满时阻塞，Telegram 会等待响应后再推送下一批
+	wr.updates <- update
+	w.WriteHeader(http.StatusOK)
+}
+
+// close 停止接收更新，之后的请求返回 503
+func (wr *webhookReceiver) close() {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	if !wr.closed {
+		wr.closed = true
+		close(wr.updates)
+	}
+}
+
+// webhookSecret 校验推送请求的 secret_token，未配置时由 bot_token 派生
+func (tb *TelegramBot) webhookSecret() string {
+	if tb.config.Webhook.SecretToken != "" {
+		return tb.config.Webhook.SecretToken
+	}
+	sum := sha256.Sum256([]byte("webhook:" + tb.config.Telegram.BotToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// webhookPath 接收更新的路径，取自 webhook URL
+func webhookPath(config *Config) (string, error) {
+	u, err := url.Parse(config.Webhook.URL)
+	if err != nil {
+		return "", fmt.Errorf("webhook URL 无效：%v", err)
+	}
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("webhook URL 必须使用 https：%s", config.Webhook.URL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		return "", fmt.Errorf("webhook URL 需要包含路径，如 /telegram/webhook")
+	}
+	return u.Path, nil
+}
+
+// receiveUpdates 按配置通过 webhook 或长轮询接收更新，设置 webhook 失败时回退到长轮询
+func (tb *TelegramBot) receiveUpdates() <-chan tgbotapi.Update {
+	if tb.webhook != nil {
+		err := tb.startWebhook()
+		if err == nil {
+			tb.stopReceiving = tb.stopWebhook
+			return tb.webhook.updates
+		}
+		log.Printf("❌ 设置 webhook 失败，改用长轮询：%v", err)
+
+		// 已挂载到 Web 管理界面的路由之后返回 503
+		tb.webhook.close()
+		// 保留 Telegram 中尚未推送的更新，由长轮询接收
+		if _, err := tb.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			log.Printf("❌ 删除webhook失败: %v", err)
+		}
+	}
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 30
+	// chat_member 更新默认不会推送，需要显式订阅
+	u.AllowedUpdates = allowedUpdates
+
+	log.Printf("📥 使用长轮询接收更新")
+	tb.stopReceiving = tb.bot.StopReceivingUpdates
+	return tb.bot.GetUpdatesChan(u)
+}
+
+// startWebhook 启动接收更新的监听（配置了 listen 时），并向 Telegram 注册 webhook
+func (tb *TelegramBot) startWebhook() error {
+	path, err := webhookPath(tb.config)
+	if err != nil {
+		return err
+	}
+	if !webhookSecretPattern.MatchString(tb.webhook.secret) {
+		return fmt.Errorf("secret_token 只能包含字母、数字、_ 和 -，长度 1-256")
+	}
+
+	// 未配置独立的监听地址时，由 Web 管理界面的路由接收更新
+	if listen := tb.config.Webhook.Listen; listen != "" {
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("监听 %s 失败：%v", listen, err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(path, tb.webhook)
+		tb.webhookServer = &http.Server{Handler: mux}
+
+		certFile, keyFile := tb.config.Webhook.CertFile, tb.config.Webhook.KeyFile
+		go func() {
+			var err error
+			if certFile != "" {
+				err = tb.webhookServer.ServeTLS(listener, certFile, keyFile)
+			} else {
+				err = tb.webhookServer.Serve(listener)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.Printf("❌ webhook 监听失败：%v", err)
+			}
+		}()
+		log.Printf("📡 webhook 监听在 %s%s", listen, path)
+	}
+
+	if err := tb.setWebhook(); err != nil {
+		if tb.webhookServer != nil {
+			tb.webhookServer.Close()
+			tb.webhookServer = nil
+		}
+		return err
+	}
+
+	log.Printf("📥 使用 webhook 接收更新：%s", tb.config.Webhook.URL)
+	return nil
+}
+
+// setWebhook 向 Telegram 注册 webhook；secret_token 参数较新，库中的 WebhookConfig 不支持，直接调用接口
+func (tb *TelegramBot) setWebhook() error {
+	params := tgbotapi.Params{}
+	params["url"] = tb.config.Webhook.URL
+	params["secret_token"] = tb.webhookSecret()
+	params.AddNonZero("max_connections", tb.config.Webhook.MaxConnections)
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return err
+	}
+
+	_, err := tb.bot.MakeRequest("setWebhook", params)
+	return err
+}
+
+// stopWebhook 停止接收推送的更新；webhook 保留在 Telegram 中，重启前的更新会在重启后推送
+func (tb *TelegramBot) stopWebhook() {
+	tb.webhook.close()
+	if tb.webhookServer != nil {
+		tb.webhookServer.Close()
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func newWebhookTestBot(f *fakeBotAPI) *TelegramBot {
+	config := &Config{}
+	config.Telegram.BotToken = fakeBotToken
+	config.Webhook.Enabled = true
+	config.Webhook.URL = "https://bot.example.com/telegram/webhook"
+
+	bot := f.bot()
+	tb := &TelegramBot{bot: bot, config: config, stopReceiving: bot.StopReceivingUpdates, stopped: make(chan struct{})}
+	tb.webhook = newWebhookReceiver(tb.webhookSecret(), 0)
+	return tb
+}
+
+func postUpdate(handler http.Handler, method, secret, body string) int {
+	req := httptest.NewRequest(method, "/telegram/webhook", strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set(webhookSecretHeader, secret)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func receiveUpdate(t *testing.T, updates <-chan tgbotapi.Update) tgbotapi.Update {
+	t.Helper()
+	select {
+	case update := <-updates:
+		return update
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有收到更新")
+	}
+	return tgbotapi.Update{}
+}
+
+func TestWebhookReceiverValidatesRequests(t *testing.T) {
+	receiver := newWebhookReceiver("secret", 1)
+	update := `{"update_id":7,"message":{"message_id":1,"chat":{"id":-100,"type":"supergroup"},"text":"hi"}}`
+
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   string
+		want   int
+	}{
+		{"GET 请求", http.MethodGet, "secret", update, http.StatusMethodNotAllowed},
+		{"缺少 secret_token", http.MethodPost, "", update, http.StatusForbidden},
+		{"secret_token 错误", http.MethodPost, "wrong", update, http.StatusForbidden},
+		{"无效的 JSON", http.MethodPost, "secret", "{", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := postUpdate(receiver, tt.method, tt.secret, tt.body); code != tt.want {
+				t.Errorf("状态码 = %d，期望 %d", code, tt.want)
+			}
+		})
+	}
+	if len(receiver.updates) != 0 {
+		t.Fatalf("被拒绝的请求不应产生更新，队列中有 %d 个", len(receiver.updates))
+	}
+
+	if code := postUpdate(receiver, http.MethodPost, "secret", update); code != http.StatusOK {
+		t.Fatalf("状态码 = %d，期望 200", code)
+	}
+	got := receiveUpdate(t, receiver.updates)
+	if got.UpdateID != 7 || got.Message == nil || got.Message.Text != "hi" {
+		t.Errorf("收到的更新不正确：%+v", got)
+	}
+
+	receiver.close()
+	if code := postUpdate(receiver, http.MethodPost, "secret", update); code != http.StatusServiceUnavailable {
+		t.Errorf("关闭后状态码 = %d，期望 503", code)
+	}
+}
+
+func TestWebhookRegistersWithSecretToken(t *testing.T) {
+	f := newFakeBotAPI(t)
+	tb := newWebhookTestBot(f)
+
+	updates := tb.receiveUpdates()
+
+	calls := f.requests("setWebhook")
+	if len(calls) != 1 {
+		t.Fatalf("setWebhook 调用了 %d 次，期望 1 次", len(calls))
+	}
+	params := calls[0]
+	if params.Get("url") != tb.config.Webhook.URL {
+		t.Errorf("url = %q", params.Get("url"))
+	}
+	if params.Get("secret_token") != tb.webhookSecret() || !webhookSecretPattern.MatchString(params.Get("secret_token")) {
+		t.Errorf("secret_token = %q", params.Get("secret_token"))
+	}
+	var allowed []string
+	if err := json.Unmarshal([]byte(params.Get("allowed_updates")), &allowed); err != nil || len(allowed) != len(allowedUpdates) {
+		t.Errorf("allowed_updates = %q", params.Get("allowed_updates"))
+	}
+	if len(f.requests("getUpdates")) != 0 {
+		t.Error("webhook 模式不应长轮询")
+	}
+
+	body := `{"update_id":42,"message":{"message_id":3,"chat":{"id":-100,"type":"supergroup"},"text":"hello"}}`
+	if code := postUpdate(tb.webhook, http.MethodPost, tb.webhookSecret(), body); code != http.StatusOK {
+		t.Fatalf("状态码 = %d，期望 200", code)
+	}
+	if got := receiveUpdate(t, updates); got.UpdateID != 42 {
+		t.Errorf("update_id = %d，期望 42", got.UpdateID)
+	}
+
+	tb.Stop()
+	if _, ok := <-updates; ok {
+		t.Error("Stop 之后更新通道应关闭")
+	}
+}
+
+func TestWebhookFallsBackToPolling(t *testing.T) {
+	f := newFakeBotAPI(t)
+	f.handle("setWebhook", func(url.Values) string {
+		return `{"ok":false,"error_code":400,"description":"Bad Request: bad webhook: Failed to resolve host"}`
+	})
+	var once sync.Once
+	f.handle("getUpdates", func(url.Values) string {
+		result := `[]`
+		once.Do(func() {
+			result = `[{"update_id":5,"message":{"message_id":1,"chat":{"id":-100,"type":"supergroup"},"text":"polled"}}]`
+		})
+		return `{"ok":true,"result":` + result + `}`
+	})
+	tb := newWebhookTestBot(f)
+
+	updates := tb.receiveUpdates()
+
+	if got := receiveUpdate(t, updates); got.UpdateID != 5 || got.Message.Text != "polled" {
+		t.Errorf("收到的更新不正确：%+v", got)
+	}
+	deletes := f.requests("deleteWebhook")
+	if len(deletes) != 1 {
+		t.Fatalf("deleteWebhook 调用了 %d 次，期望 1 次", len(deletes))
+	}
+	if deletes[0].Get("drop_pending_updates") == "true" {
+		t.Error("回退到长轮询时不应丢弃未推送的更新")
+	}
+	if code := postUpdate(tb.webhook, http.MethodPost, tb.webhookSecret(), `{"update_id":6}`); code != http.StatusServiceUnavailable {
+		t.Errorf("回退后 webhook 状态码 = %d，期望 503", code)
+	}
+
+	tb.Stop()
+	for range updates {
+	}
+}
+
+func TestWebhookRejectsInvalidConfig(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		secret string
+		listen string
+	}{
+		{"非 https", "http://bot.example.com/telegram/webhook", "", ""},
+		{"没有路径", "https://bot.example.com", "", ""},
+		{"secret_token 含非法字符", "https://bot.example.com/telegram/webhook", "not valid!", ""},
+		{"监听地址被占用", "https://bot.example.com/telegram/webhook", "", busy.Addr().String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBotAPI(t)
+			tb := newWebhookTestBot(f)
+			tb.config.Webhook.URL = tt.url
+			tb.config.Webhook.Listen = tt.listen
+			if tt.secret != "" {
+				tb.config.Webhook.SecretToken = tt.secret
+				tb.webhook = newWebhookReceiver(tb.webhookSecret(), 0)
+			}
+
+			if err := tb.startWebhook(); err == nil {
+				t.Fatal("期望返回错误")
+			}
+			if len(f.requests("setWebhook")) != 0 {
+				t.Error("配置无效时不应调用 setWebhook")
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 模板中的按钮定义：[按钮文字](buttonurl://https://example.com)
+// 在链接末尾加 :same 表示与上一个按钮放在同一行
+var welcomeButtonRegex = regexp.MustCompile(`\[([^\[\]]+)\]\(buttonurl://([^()\s]+?)(:same)?\)`)
+
+// markdownV2Escaper 转义 MarkdownV2 中的所有保留字符
+var markdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(",
+	")", "\\)", "~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+",
+	"-", "\\-", "=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.",
+	"!", "\\!",
+)
+
+// WelcomeData 渲染欢迎消息模板所需的数据
+type WelcomeData struct {
+	UserID      int64
+	FirstName   string
+	LastName    string
+	UserName    string
+	GroupName   string
+	MemberCount int
+	Date        time.Time
+}
+
+type WelcomeButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// RenderedWelcome 渲染后的欢迎消息
+type RenderedWelcome struct {
+	Text      string            `json:"text"`
+	ParseMode string            `json:"parse_mode"`
+	Buttons   [][]WelcomeButton `json:"buttons"`
+	MediaType string            `json:"media_type,omitempty"`
+	Media     string            `json:"media,omitempty"`
+}
+
+// RenderWelcome 渲染欢迎消息模板
+// 支持的变量：{user} {mention} {username} {user_id} {group_name} {member_count} {date}
+// 变量值会按照 parseMode 转义，模板本身的格式标记保持不变
+func RenderWelcome(settings *GroupSettings, data WelcomeData) (*RenderedWelcome, error) {
+	parseMode := settings.WelcomeParseMode
+	if parseMode != "" && parseMode != tgbotapi.ModeHTML && parseMode != tgbotapi.ModeMarkdownV2 {
+		return nil, fmt.Errorf("不支持的格式: %s", parseMode)
+	}
+
+	mediaType := settings.WelcomeMediaType
+	if settings.WelcomeMedia != "" && mediaType != "photo" && mediaType != "video" && mediaType != "animation" {
+		return nil, fmt.Errorf("不支持的媒体类型: %s", mediaType)
+	}
+
+	text, buttons, err := parseWelcomeButtons(settings.WelcomeMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	escape := func(value string) string {
+		switch parseMode {
+		case tgbotapi.ModeHTML:
+			return html.EscapeString(value)
+		case tgbotapi.ModeMarkdownV2:
+			return markdownV2Escaper.Replace(value)
+		}
+		return value
+	}
+
+	fullName := strings.TrimSpace(data.FirstName + " " + data.LastName)
+
+	username := data.FirstName
+	if data.UserName != "" {
+		username = "@" + data.UserName
+	}
+
+	// 提及用户：HTML/MarkdownV2 使用 tg://user 链接，纯文本使用 @用户名
+	var mention string
+	switch parseMode {
+	case tgbotapi.ModeHTML:
+		mention = fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, data.UserID, html.EscapeString(fullName))
+	case tgbotapi.ModeMarkdownV2:
+		mention = fmt.Sprintf("[%s](tg://user?id=%d)", markdownV2Escaper.Replace(fullName), data.UserID)
+	default:
+		mention = username
+	}
+
+	date := data.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	replacer := strings.NewReplacer(
+		"{user}", escape(data.FirstName),
+		"{mention}", mention,
+		"{username}", escape(username),
+		"{user_id}", strconv.FormatInt(data.UserID, 10),
+		"{group_name}", escape(data.GroupName),
+		"{member_count}", strconv.Itoa(data.MemberCount),
+		"{date}", escape(date.Format("2006-01-02")),
+	)
+
+	rendered := &RenderedWelcome{
+		Text:      replacer.Replace(text),
+		ParseMode: parseMode,
+		Buttons:   buttons,
+	}
+	if settings.WelcomeMedia != "" {
+		rendered.Media = settings.WelcomeMedia
+		rendered.MediaType = mediaType
+	}
+
+	return rendered, nil
+}
+
+// parseWelcomeButtons 从模板中取出按钮定义，返回去掉按钮后的文本
+func parseWelcomeButtons(template string) (string, [][]WelcomeButton, error) {
+	var buttons [][]WelcomeButton
+
+	for _, match := range welcomeButtonRegex.FindAllStringSubmatch(template, -1) {
+		link := match[2]
+		if !strings.Contains(link, "://") {
+			link = "https://" + link
+		}
+
+		parsed, err := url.Parse(link)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https" && parsed.Scheme != "tg") {
+			return "", nil, fmt.Errorf("无效的按钮链接: %s", match[2])
+		}
+
+		button := WelcomeButton{Text: match[1], URL: link}
+		if match[3] != "" && len(buttons) > 0 {
+			buttons[len(buttons)-1] = append(buttons[len(buttons)-1], button)
+		} else {
+			buttons = append(buttons, []WelcomeButton{button})
+		}
+	}
+
+	text := welcomeButtonRegex.ReplaceAllString(template, "")
+	text = strings.TrimRight(text, " \n")
+
+	return text, buttons, nil
+}
+
+// keyboard 将按钮转换为内联键盘，没有按钮时返回 nil
+func (w *RenderedWelcome) keyboard() *tgbotapi.InlineKeyboardMarkup {
+	if len(w.Buttons) == 0 {
+		return nil
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, row := range w.Buttons {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, b := range row {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonURL(b.Text, b.URL))
+		}
+		rows = append(rows, buttons)
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// Chattable 生成可发送的欢迎消息，extraRows 会追加在模板按钮之后
+func (w *RenderedWelcome) Chattable(chatID int64, extraRows ...[]tgbotapi.InlineKeyboardButton) tgbotapi.Chattable {
+	var markup interface{}
+	if keyboard := w.keyboard(); keyboard != nil || len(extraRows) > 0 {
+		if keyboard == nil {
+			keyboard = &tgbotapi.InlineKeyboardMarkup{}
+		}
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, extraRows...)
+		markup = *keyboard
+	}
+
+	var file tgbotapi.RequestFileData = tgbotapi.FileID(w.Media)
+	if strings.HasPrefix(w.Media, "http://") || strings.HasPrefix(w.Media, "https://") {
+		file = tgbotapi.FileURL(w.Media)
+	}
+
+	switch w.MediaType {
+	case "photo":
+		photo := tgbotapi.NewPhoto(chatID, file)
+		photo.Caption = w.Text
+		photo.ParseMode = w.ParseMode
+		photo.ReplyMarkup = markup
+		return photo
+	case "video":
+		video := tgbotapi.NewVideo(chatID, file)
+		video.Caption = w.Text
+		video.ParseMode = w.ParseMode
+		video.ReplyMarkup = markup
+		return video
+	case "animation":
+		animation := tgbotapi.NewAnimation(chatID, file)
+		animation.Caption = w.Text
+		animation.ParseMode = w.ParseMode
+		animation.ReplyMarkup = markup
+		return animation
+	}
+
+	msg := tgbotapi.NewMessage(chatID, w.Text)
+	msg.ParseMode = w.ParseMode
+	msg.ReplyMarkup = markup
+	return msg
+}